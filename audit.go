@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	logFormatText = "text"
+	logFormatJson = "json"
+
+	// maxAuditRequestLength limits request summaries, comments and descriptions are not stored in the audit log.
+	maxAuditRequestLength = 120
+)
+
+var logFormats = []string{logFormatText, logFormatJson}
+
+// auditLog appends a JSON line for every change made to Jira, so runs can be reconciled and undone.
+type auditLog struct {
+	file *os.File
+	enc  *json.Encoder
+}
+
+// auditRecord is a change made to Jira, successful or not.
+type auditRecord struct {
+	Time    time.Time `json:"time"`
+	JiraUrl string    `json:"jiraUrl"`
+	BuildId string    `json:"buildId,omitempty"`
+	// Action is one of the plan actions.
+	Action    string `json:"action"`
+	Key       string `json:"key,omitempty"`
+	CommentID string `json:"commentId,omitempty"`
+	LinkType  string `json:"linkType,omitempty"`
+	LinkTo    string `json:"linkTo,omitempty"`
+	// Request summarizes the request, e.g. the summary of a created issue or the first line of a comment.
+	Request    string `json:"request"`
+	Status     int    `json:"status,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+	Error      string `json:"error,omitempty"`
+}
+
+// openAuditLog opens the file for appending, a nil log records nothing.
+func openAuditLog(file string) (*auditLog, error) {
+	if file == "" {
+		return nil, nil
+	}
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open audit log %s: %w", file, err)
+	}
+	return &auditLog{file: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (a *auditLog) Close() error {
+	if a == nil {
+		return nil
+	}
+	return a.file.Close()
+}
+
+// record appends the change with the response and time since start. Failures to write are logged,
+// so an unwritable audit log does not fail changes that were already made.
+func (j junit2jira) record(r auditRecord, start time.Time, response *jira.Response, err error) {
+	if j.audit == nil {
+		return
+	}
+	r.Time = start.UTC()
+	r.DurationMs = time.Since(start).Milliseconds()
+	if j.jiraUrl != nil {
+		r.JiraUrl = j.jiraUrl.String()
+	}
+	r.BuildId = j.BuildId
+	r.Request = auditSummary(r.Request)
+	if response != nil {
+		r.Status = response.StatusCode
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if err := j.audit.enc.Encode(r); err != nil {
+		log.WithError(err).Error("Could not write audit log")
+	}
+}
+
+// auditSummary returns the first line of the text, truncated.
+func auditSummary(text string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	if runes := []rune(line); len(runes) > maxAuditRequestLength {
+		return string(runes[:maxAuditRequestLength]) + "..."
+	}
+	return line
+}
+
+// readAuditLog reads records of the audit log in the order they were written.
+func readAuditLog(file string) ([]auditRecord, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var records []auditRecord
+	dec := json.NewDecoder(f)
+	for {
+		r := auditRecord{}
+		if err := dec.Decode(&r); err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("could not read record %d: %w", len(records)+1, err)
+		}
+		records = append(records, r)
+	}
+}
+
+// fieldNames lists names of updated fields.
+func fieldNames(fields map[string]any) string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return "fields: " + strings.Join(names, ", ")
+}
+
+// configureLog sets the log level and format of the -debug and -log-format flags.
+func (f *runFlags) configureLog() {
+	switch f.logFormat {
+	case logFormatJson:
+		log.SetFormatter(&log.JSONFormatter{})
+	case logFormatText, "":
+	default:
+		inputFatalf("unknown log format %q, use one of: %s", f.logFormat, strings.Join(logFormats, ", "))
+	}
+	if f.debug {
+		log.SetLevel(log.DebugLevel)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/janisz/junit2jira/fakejira"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLog(t *testing.T) {
+	defer func(length int) { maxSummaryLength = length }(maxSummaryLength)
+	maxSummaryLength = 200
+	s, u := newFakeJira(t)
+	existing, err := testCase{
+		Suite: "github.com/stackrox/rox/sensor/kubernetes/localscanner",
+		Name:  "TestLocalScannerTLSIssuerIntegrationTests",
+	}.summary()
+	require.NoError(t, err)
+	existingKey := s.AddIssue(fakejira.Issue{Project: "ROX", Type: "Bug", Summary: existing, Labels: []string{"CI_Failure"}})
+
+	auditFile := filepath.Join(t.TempDir(), "audit.jsonl")
+	p := params{
+		jiraUrl:         u,
+		jiraProject:     "ROX",
+		junitReportsDir: "testdata/jira/report.xml",
+		BuildId:         "1",
+		threshold:       10,
+		linkStrategy:    linkStar,
+		linkType:        "Related",
+		runIssueType:    "Task",
+		auditLog:        auditFile,
+	}
+	require.NoError(t, run(p))
+
+	issues := s.Issues()
+	records, err := readAuditLog(auditFile)
+	require.NoError(t, err)
+	actions := map[string][]auditRecord{}
+	for _, r := range records {
+		assert.Equal(t, u.String(), r.JiraUrl)
+		assert.Equal(t, "1", r.BuildId)
+		assert.Empty(t, r.Error)
+		assert.False(t, r.Time.IsZero())
+		actions[r.Action] = append(actions[r.Action], r)
+	}
+	require.Len(t, actions[actionComment], 1)
+	comment := actions[actionComment][0]
+	assert.Equal(t, existingKey, comment.Key)
+	assert.Equal(t, issues[0].Comments[0].ID, comment.CommentID)
+	assert.Equal(t, http.StatusCreated, comment.Status)
+
+	// The CI run issue and new failures are created and linked to it.
+	require.NotEmpty(t, actions[actionCreate])
+	run := actions[actionCreate][0]
+	assert.Equal(t, "Task in ROX: CI run  1", run.Request)
+	assert.Equal(t, http.StatusCreated, run.Status)
+	for _, r := range actions[actionCreate] {
+		i, ok := s.Issue(r.Key)
+		require.True(t, ok)
+		assert.Equal(t, "ROX", i.Project)
+	}
+	require.NotEmpty(t, actions[actionLink])
+	for _, r := range actions[actionLink] {
+		assert.Equal(t, run.Key, r.Key)
+		assert.Equal(t, "Related", r.LinkType)
+		assert.Equal(t, run.Key+" -[Related]-> "+r.LinkTo, r.Request)
+	}
+
+	// Applied plans append to the log with their build, failures are recorded too.
+	planFile := writeFiles(t, t.TempDir(), map[string][]byte{
+		"plan.json": []byte(`{"jiraUrl":"` + u.String() + `","buildId":"7","actions":[{"action":"comment","key":"ROX-99","comment":"first line\nsecond line"}]}`),
+	})
+	err = applyCommand("apply", []string{"-plan", filepath.Join(planFile, "plan.json"), "-audit-log", auditFile})
+	require.Error(t, err)
+	appended, err := readAuditLog(auditFile)
+	require.NoError(t, err)
+	require.Len(t, appended, len(records)+1)
+	failed := appended[len(records)]
+	assert.Equal(t, "7", failed.BuildId)
+	assert.Equal(t, "ROX-99", failed.Key)
+	assert.Equal(t, "first line", failed.Request)
+	assert.Equal(t, http.StatusNotFound, failed.Status)
+	assert.NotEmpty(t, failed.Error)
+}
+
+func TestConfigureLog(t *testing.T) {
+	defer log.SetFormatter(log.StandardLogger().Formatter)
+	f := runFlags{logFormat: logFormatJson}
+	f.configureLog()
+	assert.IsType(t, &log.JSONFormatter{}, log.StandardLogger().Formatter)
+}
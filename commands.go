@@ -0,0 +1,276 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/carlmjohnson/versioninfo"
+	junit "github.com/joshdk/go-junit"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// command is a subcommand, run with its name and arguments.
+type command struct {
+	name        string
+	description string
+	run         func(name string, args []string) error
+}
+
+// commands lists subcommands in the order of the help. Offline commands never call Jira.
+func commands() []command {
+	return []command{
+		{"report", "Report failed tests to Jira and write all configured outputs (default)", reportCommand},
+		{"plan", "Record the Jira changes report would make without making them", planCommand},
+		{"apply", "Make the Jira changes recorded by plan", applyCommand},
+		{"rollback", "Delete or close issues, comments and links created for a build", rollbackCommand},
+		{"triage", "List failed tests with their open Jira issues without changing Jira", triageCommand},
+		{"check", "Validate the Jira configuration of report without changing Jira", checkCommand},
+		{"close-stale", "Comment, label or close open issues of tests that have not failed recently", closeStaleCommand},
+		{"csv", "Convert reports to CSV, NDJSON or Parquet offline", csvCommand},
+		{"html", "Write an HTML list of failed and slow tests offline", htmlCommand},
+		{"slack", "Write a Slack message of failed and slow tests offline", slackCommand},
+		{"summary", "Write a JSON summary of failed tests offline", summaryCommand},
+		{"fake-jira", "Serve an in-memory Jira for tests and local demos", fakeJiraCommand},
+	}
+}
+
+func usage(out io.Writer) {
+	fmt.Fprintf(out, "Usage: %s [command] [flags]\n\nCommands:\n", os.Args[0])
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, c := range commands() {
+		fmt.Fprintf(w, "  %s\t%s\n", c.name, c.description)
+	}
+	_ = w.Flush()
+	fmt.Fprintf(out, "\nRun %s <command> -help for flags of a command.\n", os.Args[0])
+}
+
+// newFlagSet creates flags of a command with its description in the help.
+func newFlagSet(name, description string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage of %s: %s\n", name, description)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func reportCommand(name string, args []string) error {
+	fs := newFlagSet(name, "Report failed tests to Jira and write all configured outputs.")
+	p := params{}
+	f := addRunFlags(fs, &p)
+	versioninfo.AddFlag(fs)
+	_ = fs.Parse(args)
+	f.apply(&p)
+	return run(p)
+}
+
+func planCommand(name string, args []string) error {
+	fs := newFlagSet(name, "Record the Jira changes report would make without making them.")
+	p := params{}
+	f := addRunFlags(fs, &p)
+	fs.StringVar(&p.planOutput, "plan-output", "-", "Write the plan to this file (use dash [-] for stdout)")
+	fs.StringVar(&p.planFormat, "plan-format", planFormatJson, "Format of the plan: "+planFormatJson+" or "+planFormatText)
+	_ = fs.Parse(args)
+	f.apply(&p)
+	return run(p)
+}
+
+// offlineTests reads reports and finds failed and slow tests without merging them.
+func offlineTests(p params) (junit2jira, []junit.Suite, []testCase, []slowTest, error) {
+	j := junit2jira{params: p}
+	testSuites, err := ingestReports(p)
+	if err != nil {
+		return j, nil, nil, nil, withExitCode(exitInputError, errors.Wrap(err, "could not read reports"))
+	}
+	failedTests := j.collectFailedTests(testSuites)
+	log.Infof("Found %d failed tests", len(failedTests))
+	d, err := loadDurations(p)
+	if err != nil {
+		return j, nil, nil, nil, withExitCode(exitInputError, err)
+	}
+	return j, testSuites, failedTests, d.findSlowTests(testSuites), nil
+}
+
+// unreported returns failed tests as issues that were not reported to Jira.
+func unreported(failedTests []testCase) []*testIssue {
+	issues := make([]*testIssue, 0, len(failedTests))
+	for _, tc := range failedTests {
+		issues = append(issues, &testIssue{testCase: tc})
+	}
+	return issues
+}
+
+const (
+	exportCsv     = "csv"
+	exportNdjson  = "ndjson"
+	exportParquet = "parquet"
+)
+
+func csvCommand(name string, args []string) error {
+	fs := newFlagSet(name, "Convert reports to CSV, NDJSON or Parquet without calling Jira.")
+	p := params{}
+	f := addInputFlags(fs, &p)
+	addBuildFlags(fs, &p)
+	var output, format string
+	fs.StringVar(&output, "output", "-", "Write tests to this file (use dash [-] for stdout)")
+	fs.StringVar(&format, "format", exportCsv, "Format of the output: "+exportCsv+", "+exportNdjson+" or "+exportParquet)
+	fs.StringVar(&f.csvColumns, "columns", strings.Join(defaultColumns, ","), "Comma separated columns, any of: "+strings.Join(columnNames, ", "))
+	_ = fs.Parse(args)
+	f.apply(&p)
+
+	switch format {
+	case exportCsv:
+		p.csvOutput = output
+	case exportNdjson:
+		p.ndjsonOutput = output
+	case exportParquet:
+		p.parquetOutput = output
+	default:
+		return withExitCode(exitInputError, errors.Errorf("unknown format %q, use one of: %s, %s, %s", format, exportCsv, exportNdjson, exportParquet))
+	}
+	j := junit2jira{params: p}
+	testSuites, err := ingestReports(p)
+	if err != nil {
+		return withExitCode(exitInputError, errors.Wrap(err, "could not read reports"))
+	}
+	return j.export(testSuites, nil)
+}
+
+func htmlCommand(name string, args []string) error {
+	fs := newFlagSet(name, "Write an HTML list of failed and slow tests without calling Jira.")
+	p := params{}
+	f := addInputFlags(fs, &p)
+	addDurationFlags(fs, &p)
+	addBuildFlags(fs, &p)
+	fs.StringVar(&p.htmlOutput, "output", "-", "Write HTML to this file (use dash [-] for stdout)")
+	_ = fs.Parse(args)
+	f.apply(&p)
+
+	j, _, failedTests, slowTests, err := offlineTests(p)
+	if err != nil {
+		return err
+	}
+	issues := make([]*jira.Issue, 0, len(failedTests))
+	suspects := make([]*sourceRef, 0, len(failedTests))
+	for _, tc := range failedTests {
+		summary, err := tc.summary()
+		if err != nil {
+			return errors.Wrap(err, "could not get summary")
+		}
+		issues = append(issues, &jira.Issue{Fields: &jira.IssueFields{Summary: summary}})
+		suspects = append(suspects, tc.SuspectFile())
+	}
+	return errors.Wrap(j.createHtml(issues, suspects, slowTests), "could not create HTML report")
+}
+
+func slackCommand(name string, args []string) error {
+	fs := newFlagSet(name, "Write a Slack message of failed and slow tests without calling Jira.")
+	p := params{}
+	f := addInputFlags(fs, &p)
+	addDurationFlags(fs, &p)
+	addBuildFlags(fs, &p)
+	fs.StringVar(&p.slackOutput, "output", "-", "Write the message to this file (use dash [-] for stdout)")
+	_ = fs.Parse(args)
+	f.apply(&p)
+
+	j, _, failedTests, slowTests, err := offlineTests(p)
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(j.createSlackMessage(unreported(failedTests), slowTests), "could not convert to slack")
+}
+
+func summaryCommand(name string, args []string) error {
+	fs := newFlagSet(name, "Write a JSON summary of failed tests without calling Jira.")
+	p := params{}
+	f := addInputFlags(fs, &p)
+	fs.StringVar(&p.summaryOutput, "output", "-", "Write the summary to this file (use dash [-] for stdout)")
+	_ = fs.Parse(args)
+	f.apply(&p)
+
+	j, _, failedTests, _, err := offlineTests(p)
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(j.writeSummary(nil, len(failedTests)), "could not write summary")
+}
+
+func triageCommand(name string, args []string) error {
+	fs := newFlagSet(name, "List failed tests, grouped as report would group them, with their open Jira issues. Jira is only searched.")
+	p := params{}
+	f := addInputFlags(fs, &p)
+	addJiraSearchFlags(fs, &p, f)
+	var output string
+	fs.StringVar(&output, "output", "-", "Write the list to this file (use dash [-] for stdout)")
+	_ = fs.Parse(args)
+	f.apply(&p)
+
+	jiraClient, err := newJiraClient(p)
+	if err != nil {
+		return err
+	}
+	j := junit2jira{params: p, jiraClient: jiraClient}
+	testSuites, err := ingestReports(p)
+	if err != nil {
+		return withExitCode(exitInputError, errors.Wrap(err, "could not read reports"))
+	}
+	failedTests, err := j.findFailedTests(testSuites)
+	if err != nil {
+		return errors.Wrap(err, "could not find failed tests")
+	}
+	triaged, err := j.triage(failedTests)
+	if err != nil {
+		return err
+	}
+	return writeOutput(output, func(out io.Writer) error {
+		return writeTriage(out, triaged, p)
+	})
+}
+
+// triaged is a failed test with its open issue, if any.
+type triaged struct {
+	summary string
+	issue   *jira.Issue
+}
+
+// triage searches open issues of failed tests.
+func (j junit2jira) triage(failedTests []testCase) ([]triaged, error) {
+	result := make([]triaged, 0, len(failedTests))
+	for _, tc := range failedTests {
+		summary, err := tc.summary()
+		if err != nil {
+			return nil, errors.Wrap(err, "could not get summary")
+		}
+		issue, err := j.findIssue(tc, summary)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, triaged{summary: summary, issue: issue})
+	}
+	return result, nil
+}
+
+func writeTriage(out io.Writer, triaged []triaged, p params) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ISSUE\tSTATUS\tTEST")
+	for _, t := range triaged {
+		key, status := "-", "new"
+		if t.issue != nil {
+			key, status = t.issue.Key, "open"
+			if t.issue.Fields != nil && t.issue.Fields.Status != nil {
+				status = t.issue.Fields.Status.Name
+			}
+			if p.jiraUrl != nil {
+				key = p.jiraUrl.JoinPath("browse", t.issue.Key).String()
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", key, status, t.summary)
+	}
+	return w.Flush()
+}
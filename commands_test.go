@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/janisz/junit2jira/fakejira"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOfflineCommands(t *testing.T) {
+	dir := t.TempDir()
+	input := "testdata/jira/TEST-DefaultPoliciesTest.xml"
+	read := func(name string) string {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	require.NoError(t, csvCommand("csv", []string{"-input", input, "-output", filepath.Join(dir, "tests.csv"), "-columns", "Name,Status", "-build-id", "1"}))
+	assert.Contains(t, read("tests.csv"), "Name,Status\nVerify policy Secure Shell (ssh) Port Exposed is triggered,passed\n")
+	require.NoError(t, csvCommand("csv", []string{"-input", input, "-output", filepath.Join(dir, "tests.ndjson"), "-format", exportNdjson, "-columns", "Name"}))
+	assert.Contains(t, read("tests.ndjson"), `{"Name":"Verify policy Latest tag is triggered"}`)
+	assert.Error(t, csvCommand("csv", []string{"-input", input, "-format", "xml"}))
+
+	require.NoError(t, htmlCommand("html", []string{"-input", input, "-output", filepath.Join(dir, "report.html")}))
+	assert.Contains(t, read("report.html"), "<li>DefaultPoliciesTest / Verify policy Apache Struts  CVE-2017-5638 is triggered FAILED\n")
+
+	require.NoError(t, slackCommand("slack", []string{"-input", input, "-output", filepath.Join(dir, "slack.json")}))
+	assert.Contains(t, read("slack.json"), "Verify policy Apache Struts: CVE-2017-5638 is triggered")
+
+	require.NoError(t, summaryCommand("summary", []string{"-input", input, "-output", filepath.Join(dir, "summary.json")}))
+	assert.JSONEq(t, `{"newJIRAs":0,"failedTests":1}`, read("summary.json"))
+}
+
+func TestTriageCommand(t *testing.T) {
+	s, u := newFakeJira(t)
+	existing, err := testCase{
+		Suite: "github.com/stackrox/rox/sensor/kubernetes/localscanner",
+		Name:  "TestLocalScannerTLSIssuerIntegrationTests",
+	}.summary()
+	require.NoError(t, err)
+	key := s.AddIssue(fakejira.Issue{Project: "ROX", Type: "Bug", Summary: existing, Labels: []string{"CI_Failure"}})
+
+	output := filepath.Join(t.TempDir(), "triage.txt")
+	require.NoError(t, triageCommand("triage", []string{"-jira-url", u.String(), "-input", "testdata/jira/report.xml", "-output", output}))
+	b, err := os.ReadFile(output)
+	require.NoError(t, err)
+	assert.Regexp(t, `(?m)^`+regexp.QuoteMeta(u.String()+"browse/"+key)+` +Open +`+regexp.QuoteMeta(existing)+`$`, string(b))
+	assert.Regexp(t, `(?m)^- +new +github.com/stackrox/rox/pkg/booleanpolicy/evaluator / TestDifferentBaseTypes FAILED$`, string(b))
+	assert.Len(t, s.Issues(), 1, "triage does not change Jira")
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	junit "github.com/joshdk/go-junit"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/slack-go/slack"
+)
+
+// slowTest is a test that took longer than its limit or regressed compared to its baseline.
+type slowTest struct {
+	Suite    string
+	Name     string
+	Duration time.Duration
+	// Baseline is the usual duration of the test, if known.
+	Baseline time.Duration
+	// Limit is the exceeded absolute limit, if any.
+	Limit time.Duration
+	// Key of the issue the slow test is reported in.
+	Key string
+}
+
+func (s slowTest) Reason() string {
+	if s.Limit > 0 {
+		return fmt.Sprintf("took %s, more than the limit of %s", s.Duration, s.Limit)
+	}
+	increase := 100 * (float64(s.Duration) / float64(s.Baseline))
+	return fmt.Sprintf("took %s, %.0f%% of the baseline %s", s.Duration, increase, s.Baseline)
+}
+
+// threshold is an absolute duration limit of tests matching the patterns.
+type threshold struct {
+	suite *regexp.Regexp
+	name  *regexp.Regexp
+	limit time.Duration
+}
+
+// durations finds slow tests.
+type durations struct {
+	baseline   map[string]time.Duration
+	thresholds []threshold
+	limit      time.Duration
+	// regression is the percentage of the baseline duration a test can take longer.
+	regression  float64
+	minDuration time.Duration
+}
+
+// loadDurations reads duration baselines and thresholds. It returns nil when slow tests are not detected.
+func loadDurations(p params) (*durations, error) {
+	d := &durations{
+		limit:       p.slowTestLimit,
+		regression:  p.slowTestRegression,
+		minDuration: p.slowTestMinDuration,
+	}
+	if len(p.durationBaselines) > 0 && d.regression > 0 {
+		var err error
+		d.baseline, err = loadBaseline(p.durationBaselines)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not read duration baseline")
+		}
+	}
+	if p.durationThresholds != "" {
+		var err error
+		d.thresholds, err = loadThresholds(p.durationThresholds)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not read duration thresholds %s", p.durationThresholds)
+		}
+	}
+	if d.baseline == nil && d.thresholds == nil && d.limit == 0 {
+		return nil, nil
+	}
+	return d, nil
+}
+
+func durationKey(suite, name string) string {
+	return suite + " / " + name
+}
+
+// loadBaseline reads CSV files written by -csv-output in previous runs and returns the median duration of each test.
+func loadBaseline(patterns []string) (map[string]time.Duration, error) {
+	samples := map[string][]time.Duration{}
+	for _, pattern := range patterns {
+		files := []string{pattern}
+		if hasMeta(pattern) {
+			var err error
+			files, err = glob(pattern)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for _, file := range files {
+			if err := readBaseline(file, samples); err != nil {
+				return nil, errors.Wrapf(err, "could not read %s", file)
+			}
+		}
+	}
+
+	baseline := make(map[string]time.Duration, len(samples))
+	for key, s := range samples {
+		sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+		baseline[key] = s[len(s)/2]
+	}
+	log.Debugf("Read duration baseline of %d tests", len(baseline))
+	return baseline, nil
+}
+
+func readBaseline(file string, samples map[string][]time.Duration) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	header, err := r.Read()
+	if err != nil {
+		return err
+	}
+	columns := map[string]int{}
+	for i, h := range header {
+		columns[h] = i
+	}
+	for _, c := range []string{"Classname", "Name", "Duration"} {
+		if _, ok := columns[c]; !ok {
+			return errors.Errorf("missing %s column", c)
+		}
+	}
+	status, hasStatus := columns["Status"]
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hasStatus && row[status] == string(junit.StatusSkipped) {
+			continue
+		}
+		ms, err := strconv.ParseInt(row[columns["Duration"]], 10, 64)
+		if err != nil {
+			return errors.Wrapf(err, "invalid duration of %s", row[columns["Name"]])
+		}
+		key := durationKey(row[columns["Classname"]], row[columns["Name"]])
+		samples[key] = append(samples[key], time.Duration(ms)*time.Millisecond)
+	}
+}
+
+// loadThresholds reads a CSV file with suite pattern, test name pattern and a duration limit on each line.
+// Patterns can contain * wildcards; the first matching line applies. Lines starting with # are ignored.
+func loadThresholds(file string) ([]threshold, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = 3
+	r.TrimLeadingSpace = true
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	thresholds := make([]threshold, 0, len(rows))
+	for _, row := range rows {
+		limit, err := time.ParseDuration(row[2])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid limit of %s", strings.Join(row[:2], " / "))
+		}
+		thresholds = append(thresholds, threshold{suite: wildcard(row[0]), name: wildcard(row[1]), limit: limit})
+	}
+	return thresholds, nil
+}
+
+// wildcard compiles a pattern in which * matches any text.
+func wildcard(pattern string) *regexp.Regexp {
+	return regexp.MustCompile("^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*") + "$")
+}
+
+// findSlowTests returns tests that exceeded their limit or regressed compared to the baseline.
+func (d *durations) findSlowTests(testSuites []junit.Suite) []slowTest {
+	if d == nil {
+		return nil
+	}
+	var slow []slowTest
+	for _, ts := range testSuites {
+		slow = append(slow, d.findSlowTests(ts.Suites)...)
+		for _, tc := range ts.Tests {
+			if tc.Status == junit.StatusSkipped {
+				continue
+			}
+			if s, ok := d.check(tc); ok {
+				slow = append(slow, s)
+			}
+		}
+	}
+	if len(slow) > 0 {
+		log.Infof("Found %d slow tests", len(slow))
+	}
+	return slow
+}
+
+func (d *durations) check(tc junit.Test) (slowTest, bool) {
+	s := slowTest{Suite: tc.Classname, Name: tc.Name, Duration: tc.Duration}
+	limit := d.limit
+	for _, t := range d.thresholds {
+		if t.suite.MatchString(tc.Classname) && t.name.MatchString(tc.Name) {
+			limit = t.limit
+			break
+		}
+	}
+	if limit > 0 && tc.Duration > limit {
+		s.Limit = limit
+		return s, true
+	}
+
+	baseline, ok := d.baseline[durationKey(tc.Classname, tc.Name)]
+	if !ok || baseline == 0 || tc.Duration < d.minDuration {
+		return s, false
+	}
+	s.Baseline = baseline
+	return s, float64(tc.Duration) > float64(baseline)*(1+d.regression/100)
+}
+
+// reportSlowTests creates or comments on slow test issues, labeled separately from failures.
+func (j junit2jira) reportSlowTests(slow []slowTest) error {
+	if !j.slowTestIssues || len(slow) == 0 {
+		return nil
+	}
+	tests := make([]testCase, 0, len(slow))
+	for _, s := range slow {
+		tc := NewTestCase(junit.Test{Name: s.Name, Classname: s.Suite}, j.params)
+		tc.Message = "Test " + s.Reason()
+		tc.Slow = true
+		tc.label = j.slowTestLabel
+		tests = append(tests, tc)
+	}
+	issues, err := j.createIssuesOrComments(tests, "")
+	index := make(map[string]int, len(slow))
+	for i, s := range slow {
+		index[durationKey(s.Suite, s.Name)] = i
+	}
+	for _, issue := range issues {
+		if issue.issue != nil {
+			slow[index[durationKey(issue.testCase.Suite, issue.testCase.Name)]].Key = issue.issue.Key
+		}
+	}
+	return err
+}
+
+// slowTestsToSlack returns an attachment listing slow tests.
+func slowTestsToSlack(slow []slowTest) []slack.Attachment {
+	if len(slow) == 0 {
+		return nil
+	}
+	blocks := []slack.Block{slack.NewHeaderBlock(slack.NewTextBlockObject("plain_text", "Slow tests", false, false))}
+	for _, s := range slow[:min(len(slow), slackSlowTestsLimit)] {
+		text := fmt.Sprintf("%s: %s %s", s.Suite, s.Name, s.Reason())
+		if s.Key != "" {
+			text = s.Key + ": " + text
+		}
+		blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject("plain_text", crop(text, slackTextLengthLimit), false, false), nil, nil))
+	}
+	return []slack.Attachment{{
+		Color:  "#f0ad4e",
+		Blocks: slack.Blocks{BlockSet: blocks},
+	}}
+}
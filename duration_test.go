@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+	junit "github.com/joshdk/go-junit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const baselineHeader = "BuildId,Timestamp,Classname,Name,Duration,Status,JobName,BuildTag\n"
+
+func TestFindSlowTests(t *testing.T) {
+	dir := writeFiles(t, t.TempDir(), map[string][]byte{
+		"history/1.csv": []byte(baselineHeader + "1,,s,TestA,1000,passed,,\n1,,s,TestB,2000,passed,,\n1,,s,TestC,100,passed,,\n"),
+		"history/2.csv": []byte(baselineHeader + "2,,s,TestA,1200,passed,,\n2,,s,TestB,60000,skipped,,\n2,,s,TestC,100,passed,,\n"),
+		"history/3.csv": []byte(baselineHeader + "3,,s,TestA,5000,failed,,\n"),
+		"thresholds.csv": []byte(`# suite, test, limit
+s, TestD*, 10s
+*, *, 1m
+`),
+	})
+	d, err := loadDurations(params{
+		durationBaselines:   []string{dir + "/history/*.csv"},
+		durationThresholds:  dir + "/thresholds.csv",
+		slowTestRegression:  50,
+		slowTestMinDuration: time.Second,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1200*time.Millisecond, d.baseline["s / TestA"])
+	assert.Equal(t, 2*time.Second, d.baseline["s / TestB"])
+
+	slow := d.findSlowTests([]junit.Suite{{Tests: []junit.Test{
+		{Name: "TestA", Classname: "s", Duration: 1500 * time.Millisecond, Status: junit.StatusPassed},
+		{Name: "TestB", Classname: "s", Duration: 4 * time.Second, Status: junit.StatusFailed},
+		{Name: "TestC", Classname: "s", Duration: 900 * time.Millisecond, Status: junit.StatusPassed},
+		{Name: "TestDeploy", Classname: "s", Duration: 11 * time.Second, Status: junit.StatusPassed},
+		{Name: "TestE", Classname: "s", Duration: 2 * time.Minute, Status: junit.StatusSkipped},
+		{Name: "TestF", Classname: "other", Duration: 2 * time.Minute, Status: junit.StatusPassed},
+	}}})
+	require.Len(t, slow, 3)
+	assert.Equal(t, "TestB", slow[0].Name)
+	assert.Equal(t, "took 4s, 200% of the baseline 2s", slow[0].Reason())
+	assert.Equal(t, "took 11s, more than the limit of 10s", slow[1].Reason())
+	assert.Equal(t, "TestF", slow[2].Name)
+	assert.Equal(t, time.Minute, slow[2].Limit)
+
+	d, err = loadDurations(params{})
+	require.NoError(t, err)
+	assert.Nil(t, d)
+	assert.Nil(t, d.findSlowTests([]junit.Suite{{Tests: []junit.Test{{Name: "TestA"}}}}))
+
+	_, err = loadDurations(params{durationBaselines: []string{dir + "/thresholds.csv"}, slowTestRegression: 50})
+	assert.Error(t, err)
+}
+
+func TestReportSlowTests(t *testing.T) {
+	s, u := newFakeJira(t)
+	j := junit2jira{params: params{jiraUrl: u, jiraProject: "ROX", BuildId: "1", slowTestIssues: true, slowTestLabel: "CI_Slow_Test"}}
+	var err error
+	j.jiraClient, err = jira.NewClient(nil, u.String())
+	require.NoError(t, err)
+
+	slow := []slowTest{{Suite: "s", Name: "TestA", Duration: 2 * time.Minute, Limit: time.Minute}}
+	require.NoError(t, j.reportSlowTests(slow))
+	issues := s.Issues()
+	require.Len(t, issues, 1)
+	assert.Equal(t, []string{"CI_Slow_Test"}, issues[0].Labels)
+	assert.Contains(t, issues[0].Description, "Test took 2m0s, more than the limit of 1m0s")
+	assert.Equal(t, issues[0].Key, slow[0].Key)
+
+	// Slow tests are only reported to Jira when enabled.
+	j.slowTestIssues = false
+	require.NoError(t, j.reportSlowTests(slow))
+	assert.Len(t, s.Issues(), 1)
+
+	attachments := slowTestsToSlack(slow)
+	require.Len(t, attachments, 1)
+	assert.Len(t, attachments[0].Blocks.BlockSet, 2)
+	assert.Nil(t, slowTestsToSlack(nil))
+	many := make([]slowTest, 2*slackSlowTestsLimit)
+	assert.Len(t, slowTestsToSlack(many)[0].Blocks.BlockSet, slackSlowTestsLimit+1)
+
+	j.jiraUrl, err = url.Parse("https://issues.redhat.com")
+	require.NoError(t, err)
+	buf := bytes.NewBufferString("")
+	require.NoError(t, j.renderHtml(nil, nil, slow, buf))
+	assert.Contains(t, buf.String(), "<h3>Slow tests</h3>")
+	assert.Contains(t, buf.String(), `href="https://issues.redhat.com/browse/`+slow[0].Key+`"`)
+	assert.Contains(t, buf.String(), "s: TestA took 2m0s, more than the limit of 1m0s")
+}
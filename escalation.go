@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/pkg/errors"
+)
+
+const (
+	escalatePriority = "priority"
+	escalateLabel    = "label"
+	escalateWatcher  = "watcher"
+)
+
+var escalationActions = []string{escalatePriority, escalateLabel, escalateWatcher}
+
+// escalationRule changes an issue once its failure is recorded count times within the escalation window.
+type escalationRule struct {
+	count  int
+	action string
+	value  string
+}
+
+// parseEscalationRule parses a rule in the <count>:<action>=<value> format, e.g. 10:priority=Critical.
+func parseEscalationRule(rule string) (escalationRule, error) {
+	count, action, ok := strings.Cut(rule, ":")
+	if !ok {
+		return escalationRule{}, errors.Errorf("invalid escalation rule %q, use <count>:<action>=<value>", rule)
+	}
+	r := escalationRule{}
+	var err error
+	r.count, err = strconv.Atoi(strings.TrimSpace(count))
+	if err != nil || r.count < 1 {
+		return escalationRule{}, errors.Errorf("invalid count of escalation rule %q", rule)
+	}
+	r.action, r.value, ok = strings.Cut(action, "=")
+	r.action, r.value = strings.TrimSpace(r.action), strings.TrimSpace(r.value)
+	if !ok || r.value == "" {
+		return escalationRule{}, errors.Errorf("invalid escalation rule %q, use <count>:<action>=<value>", rule)
+	}
+	for _, a := range escalationActions {
+		if a == r.action {
+			return r, nil
+		}
+	}
+	return escalationRule{}, errors.Errorf("unknown escalation action %q, use one of: %s", r.action, strings.Join(escalationActions, ", "))
+}
+
+// recurrences counts failures recorded on the issue within the window before now.
+// Only failures recorded with a build ID have markers, so other comments are not counted.
+func recurrences(issue *jira.Issue, window time.Duration, now time.Time) int {
+	since := now.Add(-window)
+	count := 0
+	for _, t := range failureTimes(issue) {
+		if t.After(since) {
+			count++
+		}
+	}
+	return count
+}
+
+// escalate applies rules whose count was crossed by the failure just recorded on the issue.
+// Rules fire once when crossed, so changes made by people afterwards are kept.
+func (j junit2jira) escalate(issue *jira.Issue, now time.Time) error {
+	if len(j.escalations) == 0 {
+		return nil
+	}
+	// The issue was fetched before the failure was commented.
+	count := recurrences(issue, j.escalationWindow, now) + 1
+	var changes, mentions []string
+	fields := map[string]any{}
+	labels := append([]string{}, issue.Fields.Labels...)
+	var watchers []string
+	for _, r := range j.escalations {
+		if count != r.count {
+			continue
+		}
+		switch r.action {
+		case escalatePriority:
+			fields["priority"] = map[string]string{"name": r.value}
+			changes = append(changes, "priority raised to "+r.value)
+		case escalateLabel:
+			if hasLabel(issue, r.value) {
+				continue
+			}
+			labels = append(labels, r.value)
+			fields["labels"] = labels
+			changes = append(changes, "labeled "+r.value)
+		case escalateWatcher:
+			watchers = append(watchers, r.value)
+			mentions = append(mentions, "[~"+r.value+"]")
+		}
+	}
+	if len(changes) == 0 && len(mentions) == 0 {
+		return nil
+	}
+
+	entry := logEntry(issue.Key, issue.Fields.Summary)
+	window := formatWindow(j.escalationWindow)
+	entry.Infof("Failure recorded %d times in the last %s, escalating", count, window)
+	comment := fmt.Sprintf("This failure was recorded %d times in the last %s.", count, window)
+	if len(changes) > 0 {
+		comment += " Escalating: " + strings.Join(changes, ", ") + "."
+	}
+	if len(mentions) > 0 {
+		comment += " " + strings.Join(mentions, " ")
+	}
+	if len(fields) > 0 {
+		if err := j.updateIssue(issue.Key, fields); err != nil {
+			return err
+		}
+	}
+	for _, w := range watchers {
+		if err := j.addWatcher(issue.Key, w); err != nil {
+			return err
+		}
+	}
+	return j.addComment(issue, comment)
+}
+
+// formatWindow formats whole days as days, e.g. 7 days instead of 168h0m0s.
+func formatWindow(d time.Duration) string {
+	day := 24 * time.Hour
+	switch {
+	case d == day:
+		return "day"
+	case d%day == 0:
+		return fmt.Sprintf("%d days", d/day)
+	}
+	return d.String()
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/janisz/junit2jira/fakejira"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEscalationRule(t *testing.T) {
+	r, err := parseEscalationRule("10:priority=Critical")
+	require.NoError(t, err)
+	assert.Equal(t, escalationRule{count: 10, action: escalatePriority, value: "Critical"}, r)
+
+	for _, invalid := range []string{"priority=Critical", "0:label=flake", "x:label=flake", "3:label", "3:label=", "3:assign=jdoe"} {
+		_, err := parseEscalationRule(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestEscalate(t *testing.T) {
+	s, u := newFakeJira(t)
+	summary, err := testCase{
+		Suite: "github.com/stackrox/rox/sensor/kubernetes/localscanner",
+		Name:  "TestLocalScannerTLSIssuerIntegrationTests",
+	}.summary()
+	require.NoError(t, err)
+	now := time.Now()
+	key := s.AddIssue(fakejira.Issue{Project: "ROX", Type: "Bug", Summary: summary, Labels: []string{"CI_Failure"}, Priority: "Minor",
+		Created: now.Add(-30 * 24 * time.Hour), Comments: []fakejira.Comment{
+			// Failures outside of the window and comments without markers are not counted.
+			{Body: "{anchor:junit2jira-1-0123456789ab}", Created: now.Add(-8 * 24 * time.Hour)},
+			{Body: "{anchor:junit2jira-2-0123456789ab}", Created: now.Add(-time.Hour)},
+			{Body: "any news?", Created: now.Add(-time.Hour)},
+		}})
+
+	p := params{
+		jiraUrl:          u,
+		jiraProject:      "ROX",
+		junitReportsDir:  "testdata/jira/report.xml",
+		BuildId:          "3",
+		threshold:        10,
+		linkStrategy:     linkNone,
+		escalationWindow: 7 * 24 * time.Hour,
+		escalations: []escalationRule{
+			{count: 2, action: escalateLabel, value: "frequent-flake"},
+			{count: 2, action: escalateWatcher, value: "jdoe"},
+			{count: 3, action: escalatePriority, value: "Critical"},
+		},
+	}
+	require.NoError(t, run(p))
+	issue, _ := s.Issue(key)
+	assert.Equal(t, []string{"CI_Failure", "frequent-flake"}, issue.Labels)
+	assert.Equal(t, []string{"jdoe"}, issue.Watchers)
+	assert.Equal(t, "Minor", issue.Priority)
+	require.Len(t, issue.Comments, 5)
+	assert.Equal(t, "This failure was recorded 2 times in the last 7 days. Escalating: labeled frequent-flake. [~jdoe]", issue.Comments[4].Body)
+
+	p.BuildId = "4"
+	require.NoError(t, run(p))
+	issue, _ = s.Issue(key)
+	assert.Equal(t, "Critical", issue.Priority)
+	require.Len(t, issue.Comments, 7)
+	assert.Equal(t, "This failure was recorded 3 times in the last 7 days. Escalating: priority raised to Critical.", issue.Comments[6].Body)
+
+	// Rules fire once, when their count is crossed.
+	p.BuildId = "5"
+	require.NoError(t, run(p))
+	issue, _ = s.Issue(key)
+	assert.Len(t, issue.Comments, 8)
+}
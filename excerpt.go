@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	excerptNone    = "none"
+	excerptGeneric = "generic"
+	excerptGo      = "go"
+	excerptGinkgo  = "ginkgo"
+	excerptPytest  = "pytest"
+	excerptSpock   = "spock"
+)
+
+var excerptPresets = []string{excerptNone, excerptGeneric, excerptGo, excerptGinkgo, excerptPytest, excerptSpock}
+
+// excerptMarkers are patterns of lines where failures of each test framework are reported.
+var excerptMarkers = map[string][]string{
+	excerptGeneric: {`\bFAIL(?:ED|URE)?\b`, `\bError\b`, `\bERROR\b`, `\bpanic:`},
+	excerptGo:      {`^\s*--- FAIL:`, `^panic:`, `^\s*Error Trace:`, `^FAIL\b`},
+	excerptGinkgo:  {`\[FAILED\]`, `\[PANICKED\]`, `\[TIMEDOUT\]`, `^\s*• Failure`},
+	excerptPytest:  {`^E\s`, `^_{3,} .+ _{3,}$`, `^FAILED `, `^Traceback \(most recent call last\)`},
+	excerptSpock:   {`Condition not satisfied:`, `ConditionNotSatisfiedError`, `\|\s*\S*ERROR\S*\s*\|`, `^\S+Exception:`},
+}
+
+// excerptConfig selects lines of long logs: lines around the first marker and the tail.
+type excerptConfig struct {
+	markers []*regexp.Regexp
+	before  int
+	after   int
+	tail    int
+}
+
+// newExcerptConfig returns the config of the preset with additional markers, or nil for the none preset.
+func newExcerptConfig(preset string, markers []string, before, after, tail int) (*excerptConfig, error) {
+	if preset == excerptNone {
+		return nil, nil
+	}
+	patterns, ok := excerptMarkers[preset]
+	if !ok {
+		return nil, errors.Errorf("unknown excerpt preset %q, use one of: %s", preset, strings.Join(excerptPresets, ", "))
+	}
+	c := &excerptConfig{before: before, after: after, tail: tail}
+	for _, p := range append(append([]string{}, patterns...), markers...) {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid excerpt marker %q", p)
+		}
+		c.markers = append(c.markers, re)
+	}
+	return c, nil
+}
+
+// firstMarker returns the index of the first line matching a marker, or -1.
+func (c *excerptConfig) firstMarker(lines []string) int {
+	for n, line := range lines {
+		for _, m := range c.markers {
+			if m.MatchString(line) {
+				return n
+			}
+		}
+	}
+	return -1
+}
+
+// excerpt returns lines around the first marker and the tail of a log too long for a text block,
+// with omitted lines noted. Logs that fit are returned whole.
+func (c *excerptConfig) excerpt(log string) string {
+	return c.excerptTo(log, maxTextBlockLength)
+}
+
+// excerptTo returns the excerpt of a log too long for the number of runes, e.g. a share of a text block.
+func (c *excerptConfig) excerptTo(log string, limit int) string {
+	if c == nil || utf8.RuneCountInString(log) <= limit {
+		return truncateTo(log, limit)
+	}
+	lines := strings.Split(log, "\n")
+	tailStart := max(0, len(lines)-c.tail)
+	windowStart, windowEnd, marker := tailStart, tailStart, -1
+	if m := c.firstMarker(lines); m >= 0 && m < tailStart {
+		windowStart, windowEnd, marker = max(0, m-c.before), min(tailStart, m+c.after+1), m
+	}
+
+	// The window and the tail are budgeted separately, so a long window does not push the tail out.
+	// The window gets at least half of the budget, the tail gets the rest.
+	budget := limit - 3*utf8.RuneCountInString(omittedLines(len(lines)))
+	if marker >= 0 {
+		windowBudget := min(textLength(lines[windowStart:windowEnd]), max(budget/2, budget-textLength(lines[tailStart:])))
+		windowStart, windowEnd = fitWindow(lines, windowStart, windowEnd, marker, windowBudget)
+		budget -= textLength(lines[windowStart:windowEnd])
+	}
+	tailStart = fitTail(lines, tailStart, budget)
+
+	var b strings.Builder
+	omitted := 0
+	for n, line := range lines {
+		if (n < windowStart || n >= windowEnd) && n < tailStart {
+			omitted++
+			continue
+		}
+		if omitted > 0 {
+			b.WriteString(omittedLines(omitted))
+			omitted = 0
+		}
+		b.WriteString(line + "\n")
+	}
+	if omitted > 0 {
+		b.WriteString(omittedLines(omitted))
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// fitWindow shortens the window to the budget, dropping lines after the marker first, then lines before it,
+// and cutting the end of the marker line last.
+func fitWindow(lines []string, start, end, marker, budget int) (int, int) {
+	for end > marker+1 && textLength(lines[start:end]) > budget {
+		end--
+	}
+	for start < marker && textLength(lines[start:end]) > budget {
+		start++
+	}
+	if textLength(lines[marker:marker+1]) > budget {
+		lines[marker] = string([]rune(lines[marker])[:max(0, budget-2)]) + "…"
+	}
+	return start, end
+}
+
+// fitTail returns the start of the tail that fits the budget, cutting the beginning of the last line if it is too long.
+func fitTail(lines []string, start, budget int) int {
+	last := len(lines) - 1
+	if start > last {
+		return start
+	}
+	for start < last && textLength(lines[start:]) > budget {
+		start++
+	}
+	if runes := []rune(lines[last]); textLength(lines[last:]) > budget {
+		lines[last] = "…" + string(runes[len(runes)-max(0, budget-2):])
+	}
+	return start
+}
+
+// textLength returns the number of runes of the lines joined with newlines, with a trailing newline.
+func textLength(lines []string) int {
+	n := len(lines)
+	for _, line := range lines {
+		n += utf8.RuneCountInString(line)
+	}
+	return n
+}
+
+func omittedLines(n int) string {
+	if n == 1 {
+		return " … 1 line omitted …\n"
+	}
+	return fmt.Sprintf(" … %d lines omitted …\n", n)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	junit "github.com/joshdk/go-junit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExcerpt(t *testing.T) {
+	defer func(length int) { maxTextBlockLength = length }(maxTextBlockLength)
+	maxTextBlockLength = 200
+	lines := make([]string, 100)
+	for n := range lines {
+		lines[n] = fmt.Sprintf("line %d", n)
+	}
+	lines[50] = "--- FAIL: TestExcerpt (0.01s)"
+	log := strings.Join(lines, "\n")
+
+	c, err := newExcerptConfig(excerptGo, nil, 2, 1, 3)
+	require.NoError(t, err)
+	assert.Equal(t, "short log\npanic: boom", c.excerpt("short log\npanic: boom"))
+	assert.Equal(t, ` … 48 lines omitted …
+line 48
+line 49
+--- FAIL: TestExcerpt (0.01s)
+line 51
+ … 45 lines omitted …
+line 97
+line 98
+line 99`, c.excerpt(log))
+
+	// Custom markers are matched along with the preset, the first matching line wins.
+	c, err = newExcerptConfig(excerptGo, []string{`^line 2\d$`}, 0, 0, 1)
+	require.NoError(t, err)
+	assert.Equal(t, " … 20 lines omitted …\nline 20\n … 78 lines omitted …\nline 99", c.excerpt(log))
+
+	// Without a marker only the tail is kept.
+	c, err = newExcerptConfig(excerptPytest, nil, 2, 2, 2)
+	require.NoError(t, err)
+	assert.Equal(t, " … 98 lines omitted …\nline 98\nline 99", c.excerpt(log))
+
+	c, err = newExcerptConfig(excerptNone, []string{"FAIL"}, 2, 2, 2)
+	require.NoError(t, err)
+	assert.Nil(t, c)
+	assert.Equal(t, truncate(log), c.excerpt(log))
+
+	// Windows and tails longer than a text block are shortened separately, so the end of the log is kept.
+	long := strings.Repeat("x", 150)
+	c, err = newExcerptConfig(excerptGo, nil, 2, 10, 5)
+	require.NoError(t, err)
+	assert.Equal(t, ` … 48 lines omitted …
+line 48
+line 49
+--- FAIL: TestExcerpt (0.01s)
+line 51
+line 52
+ … 49 lines omitted …
+exit status 1`, c.excerpt(log+"\n"+long+"\n"+long+"\nexit status 1"))
+	excerpt := c.excerpt(log + "\n" + long)
+	assert.LessOrEqual(t, len([]rune(excerpt)), maxTextBlockLength)
+	assert.True(t, strings.HasSuffix(excerpt, "line 52\n … 47 lines omitted …\n…"+long[:67]), excerpt)
+	c, err = newExcerptConfig(excerptGo, nil, 0, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, " … 50 lines omitted …\n--- FAIL: TestExcerpt (0.01s)\n … 49 lines omitted …", c.excerpt(log))
+
+	_, err = newExcerptConfig("junit", nil, 0, 0, 0)
+	assert.EqualError(t, err, `unknown excerpt preset "junit", use one of: none, generic, go, ginkgo, pytest, spock`)
+	_, err = newExcerptConfig(excerptGeneric, []string{"("}, 0, 0, 0)
+	assert.Error(t, err)
+}
+
+func TestExcerptSpock(t *testing.T) {
+	defer func(length int) { maxTextBlockLength = length }(maxTextBlockLength)
+	maxTextBlockLength = 1000
+	suites, err := junit.IngestFile("testdata/jira/TEST-DefaultPoliciesTest.xml")
+	require.NoError(t, err)
+	c, err := newExcerptConfig(excerptSpock, nil, 1, 3, 2)
+	require.NoError(t, err)
+	j := junit2jira{params: params{excerpt: c}}
+	failed, err := j.findFailedTests(suites)
+	require.NoError(t, err)
+	require.Len(t, failed, 1)
+
+	output, err := failed[0].output()
+	require.NoError(t, err)
+	stdout := output[strings.Index(output, "{code:title=STDOUT"):]
+	assert.Contains(t, stdout, "Failed to trigger Apache Struts: CVE-2017-5638 after waiting 60 seconds\n")
+	assert.Contains(t, stdout, "An exception occurred in test\norg.spockframework.runtime.ConditionNotSatisfiedError: Condition not satisfied:\n")
+	assert.Contains(t, stdout, "{code:title=STDOUT|borderStyle=solid}\n … 1 line omitted …\n")
+	assert.NotContains(t, stdout, "Starting testcase")
+}
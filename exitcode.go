@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Exit codes of commands. Gating codes take precedence over exitJiraErrors,
+// so partial Jira errors do not mask test results.
+const (
+	exitOK = 0
+	// exitFailure is returned when a command could not run, e.g. when Jira is unreachable.
+	exitFailure = 1
+	// exitInputError is returned for invalid flags and reports that cannot be read, like the flag package does.
+	exitInputError = 2
+	// exitJiraErrors is returned when some changes to Jira failed, while all outputs were still written.
+	exitJiraErrors = 3
+	// exitTestsFailed is returned with -fail-on=any-failure when any test failed.
+	exitTestsFailed = 4
+	// exitNewIssues is returned with -fail-on=new-issues when an issue was created, planned issues do not count.
+	exitNewIssues = 5
+)
+
+const (
+	failOnNever      = "never"
+	failOnAnyFailure = "any-failure"
+	failOnNewIssues  = "new-issues"
+)
+
+var failOnPolicies = []string{failOnNever, failOnAnyFailure, failOnNewIssues}
+
+func validFailOn(policy string) bool {
+	for _, p := range failOnPolicies {
+		if p == policy {
+			return true
+		}
+	}
+	return false
+}
+
+// exitError is an error with the exit code of the command.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e exitError) Unwrap() error {
+	return e.err
+}
+
+// withExitCode sets the exit code of a non-nil error.
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return exitError{code: code, err: err}
+}
+
+// exitCode returns the exit code of an error returned by a command.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var e exitError
+	if errors.As(err, &e) {
+		return e.code
+	}
+	return exitFailure
+}
+
+// exitWithError logs the error and exits with its exit code.
+func exitWithError(err error) {
+	log.Error(err)
+	os.Exit(exitCode(err))
+}
+
+// inputFatalf logs an invalid input and exits with exitInputError.
+func inputFatalf(format string, args ...any) {
+	exitWithError(withExitCode(exitInputError, fmt.Errorf(format, args...)))
+}
+
+// gate applies the -fail-on policy to results of a run. When the policy passes, errors of outputs not
+// sent are returned with exitFailure, otherwise Jira errors are returned.
+func (j junit2jira) gate(failedTests int, issues []*testIssue, jiraErrors, outputErrors error) error {
+	switch j.failOn {
+	case failOnAnyFailure:
+		if failedTests > 0 {
+			return withExitCode(exitTestsFailed, j.gateError(fmt.Sprintf("%d tests failed", failedTests), jiraErrors, outputErrors))
+		}
+	case failOnNewIssues:
+		created := 0
+		for _, i := range issues {
+			if i.outcome == outcomeCreated {
+				created++
+			}
+		}
+		if created > 0 {
+			return withExitCode(exitNewIssues, j.gateError(fmt.Sprintf("%d new issues created", created), jiraErrors, outputErrors))
+		}
+	}
+	if outputErrors != nil {
+		if jiraErrors != nil {
+			log.Errorf("Some changes to Jira failed: %s", jiraErrors)
+		}
+		return outputErrors
+	}
+	return withExitCode(exitJiraErrors, jiraErrors)
+}
+
+func (j junit2jira) gateError(msg string, jiraErrors, outputErrors error) error {
+	if jiraErrors != nil {
+		log.Errorf("Some changes to Jira failed: %s", jiraErrors)
+	}
+	if outputErrors != nil {
+		log.Errorf("Some outputs could not be sent: %s", outputErrors)
+	}
+	return errors.Errorf("%s (-fail-on=%s)", msg, j.failOn)
+}
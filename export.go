@@ -0,0 +1,323 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	junit "github.com/joshdk/go-junit"
+	"github.com/parquet-go/parquet-go"
+	"github.com/pkg/errors"
+)
+
+// exportRow is a test written to the CSV, NDJSON and Parquet outputs.
+type exportRow struct {
+	test junit.Test
+	// suites are names of the suite of the test and its parents, outermost first.
+	suites []string
+	// suiteProperties are properties of the suite of the test and its parents, outermost first.
+	suiteProperties []map[string]string
+	// issue the test is reported in, if any.
+	issue *testIssue
+	p     params
+}
+
+// exportColumn is a column of the CSV, NDJSON and Parquet outputs.
+type exportColumn struct {
+	// number columns are written as integers to NDJSON and Parquet.
+	number bool
+	value  func(r exportRow) string
+}
+
+var exportColumns = map[string]exportColumn{
+	"BuildId":      {value: func(r exportRow) string { return r.p.BuildId }},
+	"Timestamp":    {value: func(r exportRow) string { return r.p.timestamp }},
+	"Classname":    {value: func(r exportRow) string { return r.test.Classname }},
+	"Name":         {value: func(r exportRow) string { return r.test.Name }},
+	"Duration":     {number: true, value: func(r exportRow) string { return fmt.Sprintf("%d", r.test.Duration.Milliseconds()) }},
+	"Status":       {value: func(r exportRow) string { return string(r.test.Status) }},
+	"JobName":      {value: func(r exportRow) string { return r.p.JobName }},
+	"BuildTag":     {value: func(r exportRow) string { return r.p.BuildTag }},
+	"BuildLink":    {value: func(r exportRow) string { return r.p.BuildLink }},
+	"BaseLink":     {value: func(r exportRow) string { return r.p.BaseLink }},
+	"Orchestrator": {value: func(r exportRow) string { return r.p.Orchestrator }},
+	"Suite":        {value: func(r exportRow) string { return r.suites[len(r.suites)-1] }},
+	"ParentSuite":  {value: func(r exportRow) string { return strings.Join(r.suites[:len(r.suites)-1], " / ") }},
+	"Message":      {value: func(r exportRow) string { return r.test.Message }},
+	"ErrorType":    {value: errorType},
+	"MessageHash":  {value: messageHash},
+	"JiraKey": {value: func(r exportRow) string {
+		if r.issue == nil || r.issue.issue == nil {
+			return ""
+		}
+		return r.issue.issue.Key
+	}},
+	"JiraOutcome": {value: func(r exportRow) string {
+		if r.issue == nil {
+			return ""
+		}
+		return string(r.issue.outcome)
+	}},
+}
+
+// propertyColumn is the prefix of columns with a property of the test, or of the innermost suite that has it.
+const propertyColumn = "Property:"
+
+// exportColumnOf returns the column of the name.
+func exportColumnOf(name string) (exportColumn, bool) {
+	if property, ok := strings.CutPrefix(name, propertyColumn); ok && property != "" {
+		return exportColumn{value: func(r exportRow) string { return r.property(property) }}, true
+	}
+	c, ok := exportColumns[name]
+	return c, ok
+}
+
+func (r exportRow) property(name string) string {
+	if v, ok := r.test.Properties[name]; ok {
+		return v
+	}
+	for i := len(r.suiteProperties) - 1; i >= 0; i-- {
+		if v, ok := r.suiteProperties[i][name]; ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// defaultColumns are the columns written before they were configurable.
+var defaultColumns = []string{"BuildId", "Timestamp", "Classname", "Name", "Duration", "Status", "JobName", "BuildTag"}
+
+// columnNames lists columns in the order of the documentation.
+var columnNames = append(append([]string{}, defaultColumns...),
+	"BuildLink", "BaseLink", "Orchestrator", "Suite", "ParentSuite", "Message", "ErrorType", "MessageHash", "JiraKey", "JiraOutcome", propertyColumn+"<name>")
+
+// parseColumns parses a comma separated list of columns.
+func parseColumns(list string) ([]string, error) {
+	var columns []string
+	for _, c := range strings.Split(list, ",") {
+		c = strings.TrimSpace(c)
+		if _, ok := exportColumnOf(c); !ok {
+			return nil, errors.Errorf("unknown column %q, use any of: %s", c, strings.Join(columnNames, ", "))
+		}
+		columns = append(columns, c)
+	}
+	return columns, nil
+}
+
+func errorType(r exportRow) string {
+	var e junit.Error
+	if errors.As(r.test.Error, &e) {
+		return e.Type
+	}
+	return ""
+}
+
+// messageHash identifies failures with the same cause, the way -merge-strategy=signature groups them.
+func messageHash(r exportRow) string {
+	if r.test.Status != junit.StatusFailed && r.test.Status != junit.StatusError {
+		return ""
+	}
+	signature := errorSignature(NewTestCase(r.test, r.p))
+	if signature == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(signature))
+	return hex.EncodeToString(sum[:8])
+}
+
+// exportRows lists tests of all suites with the issues they are reported in.
+func exportRows(testSuites []junit.Suite, issues []*testIssue, p params) []exportRow {
+	return addExportRows(nil, testSuites, nil, nil, reportedTests(issues), p)
+}
+
+// reportedTests maps suite and name of reported tests to their issues.
+func reportedTests(issues []*testIssue) map[string]*testIssue {
+	reported := map[string]*testIssue{}
+	for _, i := range issues {
+		// Failures of merged issues point to the merged issue, unless reported on their own as well.
+		for _, tc := range i.testCase.Tests {
+			if _, ok := reported[durationKey(tc.Suite, tc.Name)]; !ok {
+				reported[durationKey(tc.Suite, tc.Name)] = i
+			}
+		}
+		reported[durationKey(i.testCase.Suite, i.testCase.Name)] = i
+	}
+	return reported
+}
+
+func addExportRows(rows []exportRow, testSuites []junit.Suite, parents []string, parentProperties []map[string]string, reported map[string]*testIssue, p params) []exportRow {
+	for _, ts := range testSuites {
+		suites := append(parents[:len(parents):len(parents)], ts.Name)
+		properties := append(parentProperties[:len(parentProperties):len(parentProperties)], ts.Properties)
+		for _, tc := range ts.Tests {
+			row := exportRow{test: tc, suites: suites, suiteProperties: properties, p: p}
+			if tc.Status == junit.StatusFailed || tc.Status == junit.StatusError || tc.Status == junit.StatusSkipped {
+				row.issue = reported[durationKey(tc.Classname, tc.Name)]
+			}
+			rows = append(rows, row)
+		}
+		rows = addExportRows(rows, ts.Suites, suites, properties, reported, p)
+	}
+	return rows
+}
+
+// export writes tests to the CSV, NDJSON and Parquet outputs.
+func (j junit2jira) export(testSuites []junit.Suite, issues []*testIssue) error {
+	for _, o := range []struct {
+		file  string
+		write func([]junit.Suite, []*testIssue, params, io.Writer) error
+	}{
+		{j.csvOutput, junit2csv},
+		{j.ndjsonOutput, junit2ndjson},
+		{j.parquetOutput, junit2parquet},
+	} {
+		if o.file == "" {
+			continue
+		}
+		if err := writeOutput(o.file, func(out io.Writer) error {
+			return o.write(testSuites, issues, j.params, out)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeOutput writes to a file or stdout for a dash.
+func writeOutput(file string, write func(io.Writer) error) error {
+	if file == "-" {
+		return write(os.Stdout)
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return fmt.Errorf("could not create file %s: %w", file, err)
+	}
+	if err := write(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (p params) columns() []string {
+	if len(p.csvColumns) == 0 {
+		return defaultColumns
+	}
+	return p.csvColumns
+}
+
+// issueColumns are columns filled from issues the tests are reported in.
+var issueColumns = []string{"JiraKey", "JiraOutcome"}
+
+// exportsIssues tells if the exports have issue columns, so they are written after failures are reported.
+func (p params) exportsIssues() bool {
+	for _, c := range p.columns() {
+		for _, ic := range issueColumns {
+			if c == ic {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func junit2csv(testSuites []junit.Suite, issues []*testIssue, p params, output io.Writer) error {
+	w := csv.NewWriter(output)
+	columns := p.columns()
+	err := w.Write(columns)
+	if err != nil {
+		return fmt.Errorf("coud not write header: %w", err)
+	}
+	for _, r := range exportRows(testSuites, issues, p) {
+		row := make([]string, 0, len(columns))
+		for _, c := range columns {
+			column, _ := exportColumnOf(c)
+			row = append(row, column.value(r))
+		}
+		err := w.Write(row)
+		if err != nil {
+			return fmt.Errorf("coud not write row: %w", err)
+		}
+	}
+	w.Flush()
+	if w.Error() != nil {
+		return fmt.Errorf("could not flush CSV: %w", w.Error())
+	}
+	return nil
+}
+
+// junit2ndjson writes a JSON object per test with the same columns as the CSV.
+func junit2ndjson(testSuites []junit.Suite, issues []*testIssue, p params, output io.Writer) error {
+	enc := json.NewEncoder(output)
+	columns := p.columns()
+	for _, r := range exportRows(testSuites, issues, p) {
+		// json.RawMessage keeps the order of columns.
+		fields := make([]string, 0, len(columns))
+		for _, c := range columns {
+			column, _ := exportColumnOf(c)
+			value := column.value(r)
+			if !column.number {
+				b, err := json.Marshal(value)
+				if err != nil {
+					return err
+				}
+				value = string(b)
+			}
+			name, err := json.Marshal(c)
+			if err != nil {
+				return err
+			}
+			fields = append(fields, string(name)+":"+value)
+		}
+		if err := enc.Encode(json.RawMessage("{" + strings.Join(fields, ",") + "}")); err != nil {
+			return fmt.Errorf("could not write row: %w", err)
+		}
+	}
+	return nil
+}
+
+// junit2parquet writes a Parquet file with the same columns as the CSV.
+func junit2parquet(testSuites []junit.Suite, issues []*testIssue, p params, output io.Writer) error {
+	group := parquet.Group{}
+	for _, c := range p.columns() {
+		if column, _ := exportColumnOf(c); column.number {
+			group[c] = parquet.Int(64)
+		} else {
+			group[c] = parquet.String()
+		}
+	}
+	schema := parquet.NewSchema("test", group)
+	w := parquet.NewWriter(output, schema)
+
+	// Parquet orders columns of a group by name.
+	var columns []string
+	for _, path := range schema.Columns() {
+		columns = append(columns, path[0])
+	}
+	for _, r := range exportRows(testSuites, issues, p) {
+		row := make(parquet.Row, 0, len(columns))
+		for i, c := range columns {
+			column, _ := exportColumnOf(c)
+			var value parquet.Value
+			if column.number {
+				var n int64
+				if _, err := fmt.Sscan(column.value(r), &n); err != nil {
+					return fmt.Errorf("invalid %s: %w", c, err)
+				}
+				value = parquet.ValueOf(n)
+			} else {
+				value = parquet.ValueOf(column.value(r))
+			}
+			row = append(row, value.Level(0, 0, i))
+		}
+		if _, err := w.WriteRows([]parquet.Row{row}); err != nil {
+			return fmt.Errorf("could not write row: %w", err)
+		}
+	}
+	return w.Close()
+}
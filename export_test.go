@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+	junit "github.com/joshdk/go-junit"
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var exportSuites = []junit.Suite{{Name: "e2e", Suites: []junit.Suite{{Name: "policies", Tests: []junit.Test{
+	{Name: "TestA", Classname: "policies", Duration: 1500 * time.Millisecond, Status: junit.StatusPassed},
+	{Name: "TestB", Classname: "policies", Duration: 2 * time.Second, Status: junit.StatusFailed, Message: "timed out after 2s",
+		Error: junit.Error{Message: "timed out after 2s", Type: "TimeoutError"}},
+}}}}}
+
+var exportIssues = []*testIssue{{
+	issue:    &jira.Issue{Key: "ROX-1"},
+	outcome:  outcomeCreated,
+	testCase: testCase{Suite: "policies", Name: "TestB"},
+}}
+
+func TestCsvColumns(t *testing.T) {
+	columns, err := parseColumns("Name, ParentSuite,Suite,Duration,ErrorType,MessageHash,JiraKey,JiraOutcome,Orchestrator")
+	require.NoError(t, err)
+	p := params{csvColumns: columns, Orchestrator: "GKE"}
+
+	buf := bytes.NewBufferString("")
+	require.NoError(t, junit2csv(exportSuites, exportIssues, p, buf))
+	assert.Equal(t, `Name,ParentSuite,Suite,Duration,ErrorType,MessageHash,JiraKey,JiraOutcome,Orchestrator
+TestA,e2e,policies,1500,,,,,GKE
+TestB,e2e,policies,2000,TimeoutError,`+messageHash(exportRow{test: exportSuites[0].Suites[0].Tests[1]})+`,ROX-1,created,GKE
+`, buf.String())
+
+	_, err = parseColumns("Name,Unknown")
+	assert.EqualError(t, err, `unknown column "Unknown", use any of: `+
+		"BuildId, Timestamp, Classname, Name, Duration, Status, JobName, BuildTag, BuildLink, BaseLink, Orchestrator, Suite, ParentSuite, Message, ErrorType, MessageHash, JiraKey, JiraOutcome, Property:<name>")
+}
+
+func TestPropertyColumn(t *testing.T) {
+	columns, err := parseColumns("Name,Property:team,Property:file")
+	require.NoError(t, err)
+	suites := []junit.Suite{{Name: "e2e", Properties: map[string]string{"team": "platform"}, Suites: []junit.Suite{
+		{Name: "policies", Properties: map[string]string{"team": "policies"}, Tests: []junit.Test{
+			{Name: "TestA", Properties: map[string]string{"file": "a_test.go"}},
+		}},
+		{Name: "sensor", Tests: []junit.Test{{Name: "TestB"}}},
+	}}}
+
+	// Tests have properties of the innermost suite that has them.
+	buf := bytes.NewBufferString("")
+	require.NoError(t, junit2csv(suites, nil, params{csvColumns: columns}, buf))
+	assert.Equal(t, `Name,Property:team,Property:file
+TestA,policies,a_test.go
+TestB,platform,
+`, buf.String())
+
+	_, err = parseColumns("Property:")
+	assert.Error(t, err)
+}
+
+func TestMessageHash(t *testing.T) {
+	hash := func(message string) string {
+		return messageHash(exportRow{test: junit.Test{Status: junit.StatusFailed, Message: message}})
+	}
+	assert.Len(t, hash("timed out after 2s"), 16)
+	assert.Equal(t, hash("timed out after 2s"), hash("timed out after 5s"))
+	assert.NotEqual(t, hash("timed out after 2s"), hash("connection refused"))
+	assert.Empty(t, messageHash(exportRow{test: junit.Test{Status: junit.StatusPassed, Message: "ok"}}))
+}
+
+func TestNdjsonOutput(t *testing.T) {
+	p := params{csvColumns: []string{"Name", "Duration", "JiraKey"}}
+	buf := bytes.NewBufferString("")
+	require.NoError(t, junit2ndjson(exportSuites, exportIssues, p, buf))
+	assert.Equal(t, `{"Name":"TestA","Duration":1500,"JiraKey":""}
+{"Name":"TestB","Duration":2000,"JiraKey":"ROX-1"}
+`, buf.String())
+}
+
+func TestParquetOutput(t *testing.T) {
+	p := params{csvColumns: []string{"Name", "Duration", "Status", "JiraKey"}}
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, junit2parquet(exportSuites, exportIssues, p, buf))
+
+	type row struct {
+		Name     string `parquet:"Name"`
+		Duration int64  `parquet:"Duration"`
+		Status   string `parquet:"Status"`
+		JiraKey  string `parquet:"JiraKey"`
+	}
+	rows, err := parquet.Read[row](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	assert.Equal(t, []row{
+		{Name: "TestA", Duration: 1500, Status: "passed"},
+		{Name: "TestB", Duration: 2000, Status: "failed", JiraKey: "ROX-1"},
+	}, rows)
+}
@@ -0,0 +1,756 @@
+// Package fakejira implements an in-memory subset of the Jira REST API v2
+// good enough to exercise junit2jira in tests and local demos.
+package fakejira
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	StatusOpen       = "Open"
+	StatusInProgress = "In Progress"
+	StatusClosed     = "Closed"
+
+	jiraTimeLayout = "2006-01-02T15:04:05.000-0700"
+)
+
+// Issue is an issue stored by the fake server.
+type Issue struct {
+	ID          string
+	Key         string
+	Project     string
+	Type        string
+	Summary     string
+	Description string
+	Status      string
+	Priority    string
+	Labels      []string
+	Parent      string
+	Created     time.Time
+	Updated     time.Time
+	Comments    []Comment
+	Links       []Link
+	Attachments []Attachment
+	Watchers    []string
+	// Fields holds fields without a dedicated attribute, such as custom fields.
+	Fields map[string]any
+
+	id int
+}
+
+// Comment is a comment of an issue.
+type Comment struct {
+	ID      string
+	Body    string
+	Created time.Time
+}
+
+// Link is a link between two issues.
+type Link struct {
+	ID      string
+	Type    string
+	Inward  string
+	Outward string
+}
+
+// Attachment is a file attached to an issue.
+type Attachment struct {
+	ID       string
+	Filename string
+	Content  []byte
+}
+
+// transition is a workflow transition available from any status but its target.
+type transition struct {
+	ID string
+	To string
+}
+
+var transitions = []transition{
+	{ID: "11", To: StatusOpen},
+	{ID: "21", To: StatusInProgress},
+	{ID: "31", To: StatusClosed},
+}
+
+// Server is an in-memory fake Jira. The zero value is not usable, use New.
+type Server struct {
+	mu       sync.Mutex
+	issues   []*Issue
+	nextID   int
+	counters map[string]int
+	// Now returns the current time, it can be replaced to control issue dates.
+	Now func() time.Time
+	// LinkTypes are the names of link types the server accepts.
+	LinkTypes []string
+	// Priorities are the names of issue priorities.
+	Priorities []string
+	// Projects are keys of projects issues can be created in, any project when empty.
+	Projects []string
+	// IssueTypes are the names of issue types of every project.
+	IssueTypes []string
+	// RequiredFields are names of custom fields required to create issues.
+	RequiredFields []string
+	// LegacyCreateMeta serves create metadata only like Jira before 8.4, without the endpoints per project.
+	LegacyCreateMeta bool
+}
+
+// New returns an empty fake Jira.
+func New() *Server {
+	return &Server{
+		counters:   make(map[string]int),
+		Now:        time.Now,
+		LinkTypes:  []string{"Related", "Blocks", "Duplicate", "Cloners"},
+		IssueTypes: []string{"Bug", "Task", "Story", "Epic", "Sub-task"},
+		Priorities: []string{"Blocker", "Critical", "Major", "Minor", "Trivial"},
+	}
+}
+
+// AddIssue stores the issue, assigning its ID and key, and returns the key.
+func (s *Server) AddIssue(i Issue) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addIssue(&i)
+}
+
+func (s *Server) addIssue(i *Issue) string {
+	s.nextID++
+	s.counters[i.Project]++
+	i.id = s.nextID
+	i.ID = strconv.Itoa(s.nextID)
+	i.Key = fmt.Sprintf("%s-%d", i.Project, s.counters[i.Project])
+	if i.Status == "" {
+		i.Status = StatusOpen
+	}
+	if i.Created.IsZero() {
+		i.Created = s.Now()
+	}
+	if i.Updated.IsZero() {
+		i.Updated = i.Created
+	}
+	s.issues = append(s.issues, i)
+	return i.Key
+}
+
+// Issues returns copies of all stored issues in order of creation.
+func (s *Server) Issues() []Issue {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]Issue, 0, len(s.issues))
+	for _, i := range s.issues {
+		result = append(result, *i)
+	}
+	return result
+}
+
+// Issue returns a copy of the issue with the given key or ID.
+func (s *Server) Issue(key string) (Issue, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.find(key)
+	if i == nil {
+		return Issue{}, false
+	}
+	return *i, true
+}
+
+func (s *Server) find(key string) *Issue {
+	for _, i := range s.issues {
+		if i.Key == key || i.ID == key {
+			return i
+		}
+	}
+	return nil
+}
+
+// ServeHTTP implements the supported subset of the Jira REST API.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/rest/api/2"), "/"), "/")
+	route := r.Method + " " + path[0]
+	switch {
+	case route == "GET search" && len(path) == 1:
+		s.search(w, r)
+	case route == "POST issue" && len(path) == 1:
+		s.create(w, r)
+	case route == "POST issueLink" && len(path) == 1:
+		s.link(w, r)
+	case route == "DELETE issueLink" && len(path) == 2:
+		s.unlink(w, path[1])
+	case route == "GET issueLinkType" && len(path) == 1:
+		s.linkTypes(w)
+	case route == "GET priority" && len(path) == 1:
+		s.priorities(w)
+	case route == "GET issue" && len(path) == 2 && path[1] == "createmeta":
+		s.createMeta(w, r)
+	case route == "GET issue" && len(path) >= 4 && path[1] == "createmeta" && path[3] == "issuetypes" && !s.LegacyCreateMeta:
+		s.projectCreateMeta(w, r, path[2], path[4:])
+	case path[0] == "issue" && len(path) >= 2:
+		i := s.find(path[1])
+		if i == nil {
+			writeError(w, http.StatusNotFound, "Issue does not exist or you do not have permission to see it.")
+			return
+		}
+		s.issue(w, r, i, path[2:])
+	default:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("%s %s is not supported by fake Jira", r.Method, r.URL.Path))
+	}
+}
+
+func (s *Server) issue(w http.ResponseWriter, r *http.Request, i *Issue, path []string) {
+	route := r.Method
+	if len(path) > 0 {
+		route += " " + path[0]
+	}
+	switch {
+	case route == "GET" && len(path) == 0:
+		writeJSON(w, http.StatusOK, s.render(i))
+	case route == "PUT" && len(path) == 0:
+		s.update(w, r, i)
+	case route == "DELETE" && len(path) == 0:
+		s.delete(i)
+		w.WriteHeader(http.StatusNoContent)
+	case route == "GET comment" && len(path) == 1:
+		writeJSON(w, http.StatusOK, renderComments(i.Comments))
+	case route == "POST comment" && len(path) == 1:
+		s.comment(w, r, i)
+	case route == "PUT comment" && len(path) == 2:
+		s.updateComment(w, r, i, path[1])
+	case route == "DELETE comment" && len(path) == 2:
+		s.deleteComment(w, i, path[1])
+	case route == "GET transitions" && len(path) == 1:
+		writeJSON(w, http.StatusOK, map[string]any{"transitions": renderTransitions(i)})
+	case route == "POST transitions" && len(path) == 1:
+		s.transition(w, r, i)
+	case route == "POST watchers" && len(path) == 1:
+		s.watch(w, r, i)
+	case route == "POST attachments" && len(path) == 1:
+		s.attach(w, r, i)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("%s %s is not supported by fake Jira", r.Method, r.URL.Path))
+	}
+}
+
+func (s *Server) search(w http.ResponseWriter, r *http.Request) {
+	q, err := parseQuery(r.URL.Query().Get("jql"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var found []*Issue
+	for _, i := range s.issues {
+		if q.matches(i, s.Now()) {
+			found = append(found, i)
+		}
+	}
+	q.sort(found)
+
+	startAt, _ := strconv.Atoi(r.URL.Query().Get("startAt"))
+	maxResults, err := strconv.Atoi(r.URL.Query().Get("maxResults"))
+	if err != nil || maxResults <= 0 {
+		maxResults = 50
+	}
+	page := make([]map[string]any, 0, maxResults)
+	for n := startAt; n < len(found) && n < startAt+maxResults; n++ {
+		page = append(page, s.render(found[n]))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"startAt":    startAt,
+		"maxResults": maxResults,
+		"total":      len(found),
+		"issues":     page,
+	})
+}
+
+type issueRequest struct {
+	Fields map[string]any              `json:"fields"`
+	Update map[string][]map[string]any `json:"update"`
+}
+
+func (s *Server) create(w http.ResponseWriter, r *http.Request) {
+	req := issueRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	i := &Issue{Fields: make(map[string]any)}
+	setFields(i, req.Fields)
+	missing := make(map[string]string)
+	for name, value := range map[string]string{"project": i.Project, "summary": i.Summary, "issuetype": i.Type} {
+		if value == "" {
+			missing[name] = name + " is required"
+		}
+	}
+	if i.Project != "" && len(s.Projects) > 0 && !contains(s.Projects, i.Project) {
+		missing["project"] = "valid project is required"
+	}
+	if i.Type != "" && !contains(s.IssueTypes, i.Type) {
+		missing["issuetype"] = "valid issue type is required"
+	}
+	for n, name := range s.RequiredFields {
+		if i.Fields[customField(n)] == nil {
+			missing[customField(n)] = name + " is required."
+		}
+	}
+	if len(missing) > 0 {
+		writeFieldErrors(w, missing)
+		return
+	}
+	if i.Parent != "" {
+		parent := s.find(i.Parent)
+		if parent == nil {
+			writeFieldErrors(w, map[string]string{"parent": "Could not find issue by id or key."})
+			return
+		}
+		i.Parent = parent.Key
+	}
+	s.addIssue(i)
+	writeJSON(w, http.StatusCreated, map[string]string{"id": i.ID, "key": i.Key, "self": s.self(i)})
+}
+
+func (s *Server) update(w http.ResponseWriter, r *http.Request, i *Issue) {
+	req := issueRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	setFields(i, req.Fields)
+	for _, op := range req.Update["labels"] {
+		if label, ok := op["add"].(string); ok && !contains(i.Labels, label) {
+			i.Labels = append(i.Labels, label)
+		}
+		if label, ok := op["remove"].(string); ok {
+			i.Labels = remove(i.Labels, label)
+		}
+	}
+	i.Updated = s.Now()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) delete(i *Issue) {
+	for n, issue := range s.issues {
+		if issue == i {
+			s.issues = append(s.issues[:n], s.issues[n+1:]...)
+			break
+		}
+	}
+	for _, issue := range s.issues {
+		var links []Link
+		for _, l := range issue.Links {
+			if l.Inward != i.Key && l.Outward != i.Key {
+				links = append(links, l)
+			}
+		}
+		issue.Links = links
+	}
+}
+
+// setFields sets issue attributes from Jira fields, storing unknown fields as they are.
+func setFields(i *Issue, fields map[string]any) {
+	if i.Fields == nil {
+		i.Fields = make(map[string]any)
+	}
+	for name, value := range fields {
+		switch name {
+		case "project":
+			i.Project = nested(value, "key")
+		case "issuetype":
+			i.Type = nested(value, "name")
+		case "summary":
+			i.Summary, _ = value.(string)
+		case "description":
+			i.Description, _ = value.(string)
+		case "priority":
+			i.Priority = nested(value, "name")
+		case "parent":
+			i.Parent = nested(value, "key")
+		case "labels":
+			i.Labels = nil
+			values, _ := value.([]any)
+			for _, v := range values {
+				if label, ok := v.(string); ok {
+					i.Labels = append(i.Labels, label)
+				}
+			}
+		default:
+			i.Fields[name] = value
+		}
+	}
+}
+
+func nested(value any, key string) string {
+	if m, ok := value.(map[string]any); ok {
+		if v, ok := m[key].(string); ok {
+			return v
+		}
+		if v, ok := m["id"].(string); ok {
+			return v
+		}
+	}
+	return ""
+}
+
+func (s *Server) comment(w http.ResponseWriter, r *http.Request, i *Issue) {
+	c := struct {
+		Body string `json:"body"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.nextID++
+	comment := Comment{ID: strconv.Itoa(s.nextID), Body: c.Body, Created: s.Now()}
+	i.Comments = append(i.Comments, comment)
+	i.Updated = comment.Created
+	writeJSON(w, http.StatusCreated, renderComment(comment))
+}
+
+func (s *Server) updateComment(w http.ResponseWriter, r *http.Request, i *Issue, id string) {
+	c := struct {
+		Body string `json:"body"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	for n := range i.Comments {
+		if i.Comments[n].ID == id {
+			i.Comments[n].Body = c.Body
+			i.Updated = s.Now()
+			writeJSON(w, http.StatusOK, renderComment(i.Comments[n]))
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "Comment does not exist.")
+}
+
+func (s *Server) deleteComment(w http.ResponseWriter, i *Issue, id string) {
+	for n, c := range i.Comments {
+		if c.ID == id {
+			i.Comments = append(i.Comments[:n], i.Comments[n+1:]...)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "Comment does not exist.")
+}
+
+func (s *Server) link(w http.ResponseWriter, r *http.Request) {
+	req := struct {
+		Type         struct{ Name string } `json:"type"`
+		InwardIssue  struct{ Key string }  `json:"inwardIssue"`
+		OutwardIssue struct{ Key string }  `json:"outwardIssue"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !contains(s.LinkTypes, req.Type.Name) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("No issue link type with name '%s' found.", req.Type.Name))
+		return
+	}
+	inward, outward := s.find(req.InwardIssue.Key), s.find(req.OutwardIssue.Key)
+	if inward == nil || outward == nil {
+		writeError(w, http.StatusNotFound, "Issue does not exist or you do not have permission to see it.")
+		return
+	}
+	s.nextID++
+	l := Link{ID: strconv.Itoa(s.nextID), Type: req.Type.Name, Inward: inward.Key, Outward: outward.Key}
+	inward.Links = append(inward.Links, l)
+	outward.Links = append(outward.Links, l)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) unlink(w http.ResponseWriter, id string) {
+	found := false
+	for _, i := range s.issues {
+		var links []Link
+		for _, l := range i.Links {
+			if l.ID == id {
+				found = true
+				continue
+			}
+			links = append(links, l)
+		}
+		i.Links = links
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "No issue link with id '"+id+"' exists.")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) linkTypes(w http.ResponseWriter) {
+	types := make([]map[string]string, 0, len(s.LinkTypes))
+	for n, t := range s.LinkTypes {
+		types = append(types, map[string]string{"id": strconv.Itoa(10000 + n), "name": t, "inward": t, "outward": t})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"issueLinkTypes": types})
+}
+
+func (s *Server) priorities(w http.ResponseWriter) {
+	priorities := make([]map[string]string, 0, len(s.Priorities))
+	for n, p := range s.Priorities {
+		priorities = append(priorities, map[string]string{"id": strconv.Itoa(n + 1), "name": p})
+	}
+	writeJSON(w, http.StatusOK, priorities)
+}
+
+// createMeta describes projects in the projectKeys parameter with their issue types and fields.
+func (s *Server) createMeta(w http.ResponseWriter, r *http.Request) {
+	projects := []map[string]any{}
+	for _, key := range strings.Split(r.URL.Query().Get("projectKeys"), ",") {
+		if key == "" || len(s.Projects) > 0 && !contains(s.Projects, key) {
+			continue
+		}
+		types := make([]map[string]any, 0, len(s.IssueTypes))
+		for n, t := range s.IssueTypes {
+			types = append(types, map[string]any{"id": strconv.Itoa(n + 1), "name": t, "subtask": t == "Sub-task", "fields": s.fieldsMeta(t)})
+		}
+		projects = append(projects, map[string]any{"key": key, "name": key, "issuetypes": types})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"projects": projects})
+}
+
+// projectCreateMeta lists issue types of the project, or fields of the issue type with the ID, a page at a time.
+func (s *Server) projectCreateMeta(w http.ResponseWriter, r *http.Request, key string, path []string) {
+	if len(s.Projects) > 0 && !contains(s.Projects, key) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Project %s not found.", key))
+		return
+	}
+	var values []any
+	switch len(path) {
+	case 0:
+		for n, t := range s.IssueTypes {
+			values = append(values, map[string]any{"id": strconv.Itoa(n + 1), "name": t, "subtask": t == "Sub-task"})
+		}
+	case 1:
+		n, err := strconv.Atoi(path[0])
+		if err != nil || n < 1 || n > len(s.IssueTypes) {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("Issue type %s not found.", path[0]))
+			return
+		}
+		fields := s.fieldsMeta(s.IssueTypes[n-1])
+		ids := make([]string, 0, len(fields))
+		for id := range fields {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			field := fields[id].(map[string]any)
+			field["fieldId"] = id
+			values = append(values, field)
+		}
+	default:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("%s %s is not supported by fake Jira", r.Method, r.URL.Path))
+		return
+	}
+	startAt, _ := strconv.Atoi(r.URL.Query().Get("startAt"))
+	maxResults, err := strconv.Atoi(r.URL.Query().Get("maxResults"))
+	if err != nil || maxResults <= 0 {
+		maxResults = 50
+	}
+	startAt = min(max(startAt, 0), len(values))
+	end := min(startAt+maxResults, len(values))
+	writeJSON(w, http.StatusOK, map[string]any{
+		"startAt": startAt, "maxResults": maxResults, "total": len(values), "isLast": end == len(values), "values": values[startAt:end],
+	})
+}
+
+func (s *Server) fieldsMeta(issueType string) map[string]any {
+	field := func(name string, required bool) map[string]any {
+		return map[string]any{"name": name, "required": required, "hasDefaultValue": false}
+	}
+	fields := map[string]any{
+		"project":     field("Project", true),
+		"issuetype":   field("Issue Type", true),
+		"summary":     field("Summary", true),
+		"description": field("Description", false),
+		"priority":    field("Priority", false),
+		"labels":      field("Labels", false),
+	}
+	if issueType == "Sub-task" {
+		fields["parent"] = field("Parent", true)
+	}
+	for n, name := range s.RequiredFields {
+		fields[customField(n)] = field(name, true)
+	}
+	return fields
+}
+
+func customField(n int) string {
+	return fmt.Sprintf("customfield_%d", 10000+n)
+}
+
+func (s *Server) transition(w http.ResponseWriter, r *http.Request, i *Issue) {
+	req := struct {
+		Transition struct{ ID string } `json:"transition"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	for _, t := range transitions {
+		if t.ID == req.Transition.ID && t.To != i.Status {
+			i.Status = t.To
+			i.Updated = s.Now()
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	writeError(w, http.StatusBadRequest, "It seems that you have tried to perform a workflow operation that is not valid.")
+}
+
+func (s *Server) watch(w http.ResponseWriter, r *http.Request, i *Issue) {
+	var user string
+	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !contains(i.Watchers, user) {
+		i.Watchers = append(i.Watchers, user)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) attach(w http.ResponseWriter, r *http.Request, i *Issue) {
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.nextID++
+	a := Attachment{ID: strconv.Itoa(s.nextID), Filename: header.Filename, Content: content}
+	i.Attachments = append(i.Attachments, a)
+	writeJSON(w, http.StatusOK, []map[string]any{renderAttachment(a)})
+}
+
+func (s *Server) self(i *Issue) string {
+	return "/rest/api/2/issue/" + i.ID
+}
+
+func (s *Server) render(i *Issue) map[string]any {
+	fields := make(map[string]any)
+	for name, value := range i.Fields {
+		fields[name] = value
+	}
+	fields["project"] = map[string]string{"key": i.Project}
+	fields["issuetype"] = map[string]string{"name": i.Type}
+	fields["summary"] = i.Summary
+	fields["description"] = i.Description
+	fields["status"] = map[string]string{"name": i.Status}
+	fields["labels"] = append([]string{}, i.Labels...)
+	fields["created"] = i.Created.Format(jiraTimeLayout)
+	fields["updated"] = i.Updated.Format(jiraTimeLayout)
+	fields["comment"] = renderComments(i.Comments)
+	if i.Priority != "" {
+		fields["priority"] = map[string]string{"name": i.Priority}
+	}
+	if i.Parent != "" {
+		fields["parent"] = map[string]string{"key": i.Parent}
+	}
+	links := make([]map[string]any, 0, len(i.Links))
+	for _, l := range i.Links {
+		link := map[string]any{"id": l.ID, "type": map[string]string{"name": l.Type, "inward": l.Type, "outward": l.Type}}
+		// Links show the other issue, on the side the other issue is on.
+		if l.Inward == i.Key {
+			link["outwardIssue"] = map[string]string{"key": l.Outward}
+		} else {
+			link["inwardIssue"] = map[string]string{"key": l.Inward}
+		}
+		links = append(links, link)
+	}
+	fields["issuelinks"] = links
+	attachments := make([]map[string]any, 0, len(i.Attachments))
+	for _, a := range i.Attachments {
+		attachments = append(attachments, renderAttachment(a))
+	}
+	fields["attachment"] = attachments
+	var subtasks []map[string]string
+	for _, issue := range s.issues {
+		if issue.Parent == i.Key {
+			subtasks = append(subtasks, map[string]string{"id": issue.ID, "key": issue.Key})
+		}
+	}
+	if subtasks != nil {
+		fields["subtasks"] = subtasks
+	}
+	return map[string]any{"id": i.ID, "key": i.Key, "self": s.self(i), "fields": fields}
+}
+
+func renderComments(comments []Comment) map[string]any {
+	rendered := make([]map[string]string, 0, len(comments))
+	for _, c := range comments {
+		rendered = append(rendered, renderComment(c))
+	}
+	return map[string]any{"comments": rendered, "total": len(comments), "maxResults": len(comments), "startAt": 0}
+}
+
+func renderComment(c Comment) map[string]string {
+	created := c.Created.Format(jiraTimeLayout)
+	return map[string]string{"id": c.ID, "body": c.Body, "created": created, "updated": created}
+}
+
+func renderTransitions(i *Issue) []map[string]any {
+	var result []map[string]any
+	for _, t := range transitions {
+		if t.To == i.Status {
+			continue
+		}
+		result = append(result, map[string]any{"id": t.ID, "name": t.To, "to": map[string]string{"name": t.To}})
+	}
+	return result
+}
+
+func renderAttachment(a Attachment) map[string]any {
+	return map[string]any{"id": a.ID, "filename": a.Filename, "size": len(a.Content)}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]any{"errorMessages": []string{message}, "errors": map[string]string{}})
+}
+
+func writeFieldErrors(w http.ResponseWriter, errors map[string]string) {
+	writeJSON(w, http.StatusBadRequest, map[string]any{"errorMessages": []string{}, "errors": errors})
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func remove(values []string, v string) []string {
+	var result []string
+	for _, value := range values {
+		if value != v {
+			result = append(result, value)
+		}
+	}
+	return result
+}
@@ -0,0 +1,155 @@
+package fakejira
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newClient(t *testing.T) (*Server, *jira.Client) {
+	s := New()
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	client, err := jira.NewClient(nil, server.URL)
+	require.NoError(t, err)
+	return s, client
+}
+
+func TestCreateAndSearch(t *testing.T) {
+	s, client := newClient(t)
+	s.AddIssue(Issue{Project: "ROX", Type: "Bug", Summary: "suite / TestOld FAILED", Labels: []string{"CI_Failure"}, Status: StatusClosed})
+
+	created, _, err := client.Issue.Create(&jira.Issue{Fields: &jira.IssueFields{
+		Project:     jira.Project{Key: "ROX"},
+		Type:        jira.IssueType{Name: "Bug"},
+		Summary:     "suite / TestNew FAILED",
+		Description: "description",
+		Labels:      []string{"CI_Failure"},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, "ROX-2", created.Key)
+
+	sub, _, err := client.Issue.Create(&jira.Issue{Fields: &jira.IssueFields{
+		Project: jira.Project{Key: "ROX"},
+		Type:    jira.IssueType{Name: "Sub-task"},
+		Summary: "sub",
+		Parent:  &jira.Parent{Key: "ROX-2"},
+	}})
+	require.NoError(t, err)
+
+	_, resp, err := client.Issue.Create(&jira.Issue{Fields: &jira.IssueFields{Project: jira.Project{Key: "ROX"}}})
+	require.Error(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+
+	for jql, expected := range map[string][]string{
+		`project in (ROX) AND issuetype in (Bug, Sub-task) AND status != Closed AND labels = CI_Failure AND summary ~ "suite / TestNew FAILED" ORDER BY created DESC`: {"ROX-2"},
+		`project = ROX AND labels = CI_Failure`:                       {"ROX-1", "ROX-2"},
+		`project = ROX ORDER BY created DESC`:                         {"ROX-3", "ROX-2", "ROX-1"},
+		`summary ~ "TestNew"`:                                         {"ROX-2"},
+		`summary ~ "FAILED and more"`:                                 nil,
+		`status = Closed`:                                             {"ROX-1"},
+		`project not in (ROX)`:                                        nil,
+		`issuetype = Sub-task AND created >= -1d`:                     {sub.Key},
+		"project in (ROX)\nAND issuetype = Bug\nAND status != Closed": {"ROX-2"},
+	} {
+		issues, _, err := client.Issue.Search(jql, nil)
+		require.NoError(t, err, jql)
+		var keys []string
+		for _, i := range issues {
+			keys = append(keys, i.Key)
+		}
+		assert.Equal(t, expected, keys, jql)
+	}
+
+	_, resp, err = client.Issue.Search(`assignee = currentUser()`, nil)
+	require.Error(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+
+	issue, _, err := client.Issue.Get("ROX-2", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "description", issue.Fields.Description)
+	assert.Equal(t, StatusOpen, issue.Fields.Status.Name)
+	require.Len(t, issue.Fields.Subtasks, 1)
+	assert.Equal(t, sub.Key, issue.Fields.Subtasks[0].Key)
+}
+
+func TestCommentsLinksAndTransitions(t *testing.T) {
+	s, client := newClient(t)
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	s.Now = func() time.Time { return now }
+	first := s.AddIssue(Issue{Project: "ROX", Type: "Bug", Summary: "first"})
+	second := s.AddIssue(Issue{Project: "ROX", Type: "Bug", Summary: "second"})
+
+	comment, _, err := client.Issue.AddComment(first, &jira.Comment{Body: "failed again"})
+	require.NoError(t, err)
+	comment.Body = "edited"
+	_, _, err = client.Issue.UpdateComment(first, comment)
+	require.NoError(t, err)
+
+	_, err = client.Issue.AddLink(&jira.IssueLink{
+		Type:         jira.IssueLinkType{Name: "Related"},
+		OutwardIssue: &jira.Issue{Key: first},
+		InwardIssue:  &jira.Issue{Key: second},
+	})
+	require.NoError(t, err)
+	_, err = client.Issue.AddLink(&jira.IssueLink{
+		Type:         jira.IssueLinkType{Name: "Unknown"},
+		OutwardIssue: &jira.Issue{Key: first},
+		InwardIssue:  &jira.Issue{Key: second},
+	})
+	assert.Error(t, err)
+
+	issue, _, err := client.Issue.Get(first, nil)
+	require.NoError(t, err)
+	require.Len(t, issue.Fields.Comments.Comments, 1)
+	assert.Equal(t, "edited", issue.Fields.Comments.Comments[0].Body)
+	require.Len(t, issue.Fields.IssueLinks, 1)
+	assert.Equal(t, second, issue.Fields.IssueLinks[0].InwardIssue.Key)
+	assert.Equal(t, now, time.Time(issue.Fields.Updated).UTC())
+
+	transitions, _, err := client.Issue.GetTransitions(first)
+	require.NoError(t, err)
+	require.Len(t, transitions, 2)
+	_, err = client.Issue.DoTransition(first, "31")
+	require.NoError(t, err)
+	closed, _ := s.Issue(first)
+	assert.Equal(t, StatusClosed, closed.Status)
+
+	_, err = client.Issue.UpdateIssue(first, map[string]any{
+		"fields": map[string]any{"priority": map[string]string{"name": "Major"}, "customfield_1": "value"},
+		"update": map[string]any{"labels": []map[string]string{{"add": "frequent-flake"}}},
+	})
+	require.NoError(t, err)
+	updated, _ := s.Issue(first)
+	assert.Equal(t, "Major", updated.Priority)
+	assert.Equal(t, []string{"frequent-flake"}, updated.Labels)
+	assert.Equal(t, "value", updated.Fields["customfield_1"])
+
+	_, err = client.Issue.AddWatcher(first, "jdoe")
+	require.NoError(t, err)
+	_, err = client.Issue.AddWatcher(first, "jdoe")
+	require.NoError(t, err)
+	watched, _ := s.Issue(first)
+	assert.Equal(t, []string{"jdoe"}, watched.Watchers)
+
+	attachments, _, err := client.Issue.PostAttachment(first, strings.NewReader("log"), "build.log")
+	require.NoError(t, err)
+	require.Len(t, *attachments, 1)
+	attached, _ := s.Issue(first)
+	assert.Equal(t, []byte("log"), attached.Attachments[0].Content)
+
+	_, err = client.Issue.DeleteLink(closed.Links[0].ID)
+	require.NoError(t, err)
+	require.NoError(t, client.Issue.DeleteComment(first, comment.ID))
+	_, err = client.Issue.Delete(second)
+	require.NoError(t, err)
+	assert.Len(t, s.Issues(), 1)
+	remaining, _ := s.Issue(first)
+	assert.Empty(t, remaining.Links)
+	assert.Empty(t, remaining.Comments)
+}
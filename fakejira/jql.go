@@ -0,0 +1,246 @@
+package fakejira
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// query is a parsed subset of JQL: clauses joined with AND and an optional ORDER BY.
+type query struct {
+	clauses []clause
+	orderBy string
+	desc    bool
+}
+
+type clause struct {
+	field    string
+	operator string
+	values   []string
+}
+
+var (
+	orderBy       = regexp.MustCompile(`(?is)\s*ORDER\s+BY\s+(\w+)(\s+(ASC|DESC))?\s*$`)
+	clausePattern = regexp.MustCompile(`(?is)^\s*(\w+)\s*(not\s+in|in|!=|!~|>=|<=|=|~|>|<)\s*(.+?)\s*$`)
+	relativeTime  = regexp.MustCompile(`^([-+]?\d+)([wdhm])$`)
+)
+
+func parseQuery(jql string) (query, error) {
+	q := query{}
+	if m := orderBy.FindStringSubmatchIndex(jql); m != nil {
+		q.orderBy = strings.ToLower(jql[m[2]:m[3]])
+		q.desc = m[6] >= 0 && strings.EqualFold(jql[m[6]:m[7]], "DESC")
+		jql = jql[:m[0]]
+	}
+	if strings.TrimSpace(jql) == "" {
+		return q, nil
+	}
+	for _, part := range splitAnd(jql) {
+		m := clausePattern.FindStringSubmatch(part)
+		if m == nil {
+			return q, fmt.Errorf("unsupported JQL clause %q", part)
+		}
+		c := clause{
+			field:    strings.ToLower(m[1]),
+			operator: strings.ToLower(strings.Join(strings.Fields(m[2]), " ")),
+		}
+		value := m[3]
+		if c.operator == "in" || c.operator == "not in" {
+			if !strings.HasPrefix(value, "(") || !strings.HasSuffix(value, ")") {
+				return q, fmt.Errorf("expected a list in %q", part)
+			}
+			for _, v := range strings.Split(value[1:len(value)-1], ",") {
+				c.values = append(c.values, unquote(strings.TrimSpace(v)))
+			}
+		} else {
+			c.values = []string{unquote(value)}
+		}
+		if _, ok := fieldValues[c.field]; !ok {
+			return q, fmt.Errorf("unsupported JQL field %q", c.field)
+		}
+		q.clauses = append(q.clauses, c)
+	}
+	return q, nil
+}
+
+// splitAnd splits the query on AND keywords outside of quoted values.
+func splitAnd(jql string) []string {
+	var parts []string
+	var quote rune
+	start := 0
+	for i := 0; i < len(jql); i++ {
+		c := rune(jql[i])
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case unicode.IsSpace(c) && i+5 <= len(jql) && strings.EqualFold(jql[i+1:i+4], "AND") && unicode.IsSpace(rune(jql[i+4])):
+			parts = append(parts, jql[start:i])
+			start = i + 5
+			i += 4
+		}
+	}
+	return append(parts, jql[start:])
+}
+
+func unquote(s string) string {
+	if strings.HasPrefix(s, `"`) || strings.HasPrefix(s, `'`) {
+		if u, err := strconv.Unquote(s); err == nil {
+			return u
+		}
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// fieldValues returns values of the issue field a clause can be compared with.
+var fieldValues = map[string]func(i *Issue) []string{
+	"project":     func(i *Issue) []string { return []string{i.Project} },
+	"key":         func(i *Issue) []string { return []string{i.Key} },
+	"issuekey":    func(i *Issue) []string { return []string{i.Key} },
+	"issuetype":   func(i *Issue) []string { return []string{i.Type} },
+	"status":      func(i *Issue) []string { return []string{i.Status} },
+	"priority":    func(i *Issue) []string { return []string{i.Priority} },
+	"labels":      func(i *Issue) []string { return i.Labels },
+	"summary":     func(i *Issue) []string { return []string{i.Summary} },
+	"description": func(i *Issue) []string { return []string{i.Description} },
+	"text":        func(i *Issue) []string { return []string{i.Summary, i.Description} },
+	"created":     func(i *Issue) []string { return []string{i.Created.Format(time.RFC3339)} },
+	"updated":     func(i *Issue) []string { return []string{i.Updated.Format(time.RFC3339)} },
+}
+
+func (q query) matches(i *Issue, now time.Time) bool {
+	for _, c := range q.clauses {
+		if !c.matches(i, now) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c clause) matches(i *Issue, now time.Time) bool {
+	values := fieldValues[c.field](i)
+	switch c.operator {
+	case "=":
+		return containsFold(values, c.values[0])
+	case "!=":
+		return !containsFold(values, c.values[0])
+	case "in":
+		for _, v := range c.values {
+			if containsFold(values, v) {
+				return true
+			}
+		}
+		return false
+	case "not in":
+		for _, v := range c.values {
+			if containsFold(values, v) {
+				return false
+			}
+		}
+		return true
+	case "~":
+		return textMatches(values, c.values[0])
+	case "!~":
+		return !textMatches(values, c.values[0])
+	}
+	// Only dates can be compared with other operators.
+	actual, err := time.Parse(time.RFC3339, values[0])
+	if err != nil {
+		return false
+	}
+	expected, ok := parseTime(c.values[0], now)
+	if !ok {
+		return false
+	}
+	switch c.operator {
+	case ">":
+		return actual.After(expected)
+	case ">=":
+		return !actual.Before(expected)
+	case "<":
+		return actual.Before(expected)
+	case "<=":
+		return !actual.After(expected)
+	}
+	return false
+}
+
+func containsFold(values []string, v string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// textMatches approximates Jira text search: every word of the query must be present.
+func textMatches(values []string, q string) bool {
+	words := strings.FieldsFunc(strings.ToLower(q), isSeparator)
+	for _, value := range values {
+		present := make(map[string]bool)
+		for _, w := range strings.FieldsFunc(strings.ToLower(value), isSeparator) {
+			present[w] = true
+		}
+		all := true
+		for _, w := range words {
+			if !present[w] {
+				all = false
+				break
+			}
+		}
+		if all {
+			return true
+		}
+	}
+	return false
+}
+
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// parseTime parses absolute dates and times relative to now such as -30d.
+func parseTime(s string, now time.Time) (time.Time, bool) {
+	if m := relativeTime.FindStringSubmatch(s); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		unit := map[string]time.Duration{"w": 7 * 24 * time.Hour, "d": 24 * time.Hour, "h": time.Hour, "m": time.Minute}[m[2]]
+		return now.Add(time.Duration(n) * unit), true
+	}
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02", "2006/01/02 15:04", "2006/01/02", time.RFC3339} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (q query) sort(issues []*Issue) {
+	less := func(a, b *Issue) bool { return a.id < b.id }
+	switch q.orderBy {
+	case "created":
+		less = func(a, b *Issue) bool {
+			return a.Created.Before(b.Created) || a.Created.Equal(b.Created) && a.id < b.id
+		}
+	case "updated":
+		less = func(a, b *Issue) bool {
+			return a.Updated.Before(b.Updated) || a.Updated.Equal(b.Updated) && a.id < b.id
+		}
+	}
+	sort.SliceStable(issues, func(x, y int) bool {
+		if q.desc {
+			return less(issues[y], issues[x])
+		}
+		return less(issues[x], issues[y])
+	})
+}
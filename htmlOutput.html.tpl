@@ -10,12 +10,27 @@ a:visited { color: #ff8caa }
 <body>
 <ul>
 {{- $url := .JiraUrl -}}
-{{- range $issue := .Issues }}
+{{- range $n, $issue := .Issues }}
+{{- if not $issue.Key }}
+<li>{{ if $issue.Fields }}{{ $issue.Fields.Summary }}{{ end -}}
+{{- else if isPlannedKey $issue.Key }}
+<li>{{ $issue.Key }}: {{ if $issue.Fields }}{{ $issue.Fields.Summary }}{{ end -}}
+{{- else }}
 <li><a target=_blank href="{{ $url.Parse ( print "browse/" $issue.Key ) }}">
 {{- $issue.Key }}: {{ if $issue.Fields }}{{ $issue.Fields.Summary }}{{ end -}}
 </a>
 {{- end }}
+{{- with suspect $n }} (suspect file: <a target=_blank href="{{ .Link }}">{{ .Ref }}</a>){{ end }}
+{{- end }}
 </ul>
+{{- if .SlowTests }}
+<h3>Slow tests</h3>
+<ul>
+{{- range $test := .SlowTests }}
+<li>{{ if $test.Key }}{{ if isPlannedKey $test.Key }}{{ $test.Key }}{{ else }}<a target=_blank href="{{ $url.Parse ( print "browse/" $test.Key ) }}">{{ $test.Key }}</a>{{ end }}: {{ end }}{{ $test.Suite }}: {{ $test.Name }} {{ $test.Reason }}
+{{- end }}
+</ul>
+{{- end }}
 <br />{{- /* Workaround for PROW iframe height calculation */ -}}
 <br />
 </body>
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/andygrunwald/go-jira"
+)
+
+// outcome describes what happened to an issue reported for a failed test.
+type outcome string
+
+const (
+	outcomeCreated   outcome = "created"
+	outcomeCommented outcome = "commented"
+	// outcomeUpdated is a failure added to the table of occurrences of an issue.
+	outcomeUpdated         outcome = "updated"
+	outcomeAlreadyRecorded outcome = "already-recorded"
+	// outcomePlanned is an issue that -dry-run or -plan-output would create.
+	outcomePlanned outcome = "planned"
+)
+
+// recordedIssueFields are the fields needed to tell if a failure was already recorded on an issue and how often.
+const recordedIssueFields = "summary,description,comment,issuelinks,labels,created"
+
+// fingerprint identifies a test independently of a build.
+func fingerprint(summary string) string {
+	sum := sha256.Sum256([]byte(summary))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// marker returns an invisible Jira anchor identifying the failure of the test in the current build.
+// It is empty when there is no build ID, as the failure cannot be told apart from other builds then.
+func (tc testCase) marker(summary string) string {
+	if tc.BuildId == "" {
+		return ""
+	}
+	buildId := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, tc.BuildId)
+	return fmt.Sprintf("{anchor:junit2jira-%s-%s}", buildId, fingerprint(summary))
+}
+
+// isRecorded tells if the issue description or any of its comments contains the marker.
+func isRecorded(issue *jira.Issue, marker string) bool {
+	if marker == "" || issue == nil || issue.Fields == nil {
+		return false
+	}
+	if strings.Contains(issue.Fields.Description, marker) {
+		return true
+	}
+	if issue.Fields.Comments == nil {
+		return false
+	}
+	for _, c := range issue.Fields.Comments.Comments {
+		if c != nil && strings.Contains(c.Body, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// isLinked tells if the issue already has a link of the given type to the issue with the given key.
+func isLinked(issue *jira.Issue, key, linkType string) bool {
+	if issue == nil || issue.Fields == nil {
+		return false
+	}
+	for _, l := range issue.Fields.IssueLinks {
+		if l == nil || l.Type.Name != linkType {
+			continue
+		}
+		if (l.OutwardIssue != nil && l.OutwardIssue.Key == key) || (l.InwardIssue != nil && l.InwardIssue.Key == key) {
+			return true
+		}
+	}
+	return false
+}
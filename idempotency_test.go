@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarker(t *testing.T) {
+	tc := testCase{BuildId: "1234/5"}
+	assert.Equal(t, "{anchor:junit2jira-1234_5-"+fingerprint("summary")+"}", tc.marker("summary"))
+	assert.NotEqual(t, tc.marker("summary"), tc.marker("other"))
+	assert.Empty(t, testCase{}.marker("summary"))
+}
+
+func TestIsRecorded(t *testing.T) {
+	marker := "{anchor:junit2jira-1-abc}"
+	assert.False(t, isRecorded(nil, marker))
+	assert.False(t, isRecorded(&jira.Issue{Fields: &jira.IssueFields{Description: marker}}, ""))
+	assert.True(t, isRecorded(&jira.Issue{Fields: &jira.IssueFields{Description: "desc\n" + marker}}, marker))
+	assert.True(t, isRecorded(&jira.Issue{Fields: &jira.IssueFields{Comments: &jira.Comments{
+		Comments: []*jira.Comment{{Body: "other"}, {Body: "comment\n" + marker}},
+	}}}, marker))
+	assert.False(t, isRecorded(&jira.Issue{Fields: &jira.IssueFields{Comments: &jira.Comments{
+		Comments: []*jira.Comment{{Body: "other"}},
+	}}}, marker))
+}
+
+func TestIsLinked(t *testing.T) {
+	issue := &jira.Issue{Fields: &jira.IssueFields{IssueLinks: []*jira.IssueLink{
+		{Type: jira.IssueLinkType{Name: "Related"}, OutwardIssue: &jira.Issue{Key: "ROX-2"}},
+		{Type: jira.IssueLinkType{Name: "Blocks"}, InwardIssue: &jira.Issue{Key: "ROX-3"}},
+	}}}
+	assert.True(t, isLinked(issue, "ROX-2", "Related"))
+	assert.False(t, isLinked(issue, "ROX-3", "Related"))
+	assert.True(t, isLinked(issue, "ROX-3", "Blocks"))
+	assert.False(t, isLinked(&jira.Issue{}, "ROX-2", "Related"))
+}
+
+func TestCreateIssueOrCommentAlreadyRecorded(t *testing.T) {
+	tc := testCase{Name: "TestA", Suite: "suite", BuildId: "1"}
+	summary, err := tc.summary()
+	require.NoError(t, err)
+
+	comments := []*jira.Comment{{ID: "10", Body: "old failure"}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/rest/api/2/search":
+			writeJSON(t, w, map[string][]jira.Issue{"issues": {
+				{ID: "1", Key: "ROX-1", Fields: &jira.IssueFields{Summary: summary}},
+			}})
+		case r.Method == http.MethodGet && r.URL.Path == "/rest/api/2/issue/ROX-1":
+			assert.Equal(t, recordedIssueFields, r.URL.Query().Get("fields"))
+			writeJSON(t, w, jira.Issue{ID: "1", Key: "ROX-1", Fields: &jira.IssueFields{
+				Summary:  summary,
+				Comments: &jira.Comments{Comments: comments},
+			}})
+		case r.Method == http.MethodPost && r.URL.Path == "/rest/api/2/issue/ROX-1/comment":
+			c := jira.Comment{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&c))
+			c.ID = "11"
+			comments = append(comments, &c)
+			writeJSON(t, w, c)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+	}))
+	defer server.Close()
+
+	client, err := jira.NewClient(nil, server.URL)
+	require.NoError(t, err)
+	j := junit2jira{params: params{jiraProject: "ROX"}, jiraClient: client}
+
+	issue, err := j.createIssueOrComment(tc)
+	require.NoError(t, err)
+	assert.Equal(t, outcomeCommented, issue.outcome)
+	require.Len(t, comments, 2)
+	assert.Contains(t, comments[1].Body, tc.marker(summary))
+
+	issue, err = j.createIssueOrComment(tc)
+	require.NoError(t, err)
+	assert.Equal(t, outcomeAlreadyRecorded, issue.outcome)
+	assert.Len(t, comments, 2)
+
+	buf := bytes.NewBufferString("")
+	require.NoError(t, generateSummary([]*testIssue{issue}, 0, 0, buf))
+	assert.Equal(t, `{"newJIRAs":0,"outcomes":{"already-recorded":1}}`, buf.String())
+}
+
+func writeJSON(t *testing.T, w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	require.NoError(t, json.NewEncoder(w).Encode(v))
+}
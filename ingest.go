@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	junit "github.com/joshdk/go-junit"
+	"github.com/pkg/errors"
+)
+
+const (
+	// formatAuto detects the format of every report from its name and content.
+	formatAuto       = "auto"
+	formatJunit      = "junit"
+	formatGoTest     = "go-test-json"
+	formatTap        = "tap"
+	formatXunit      = "xunit"
+	formatNunit      = "nunit"
+	formatTrx        = "trx"
+	formatCtrf       = "ctrf"
+	formatPlaywright = "playwright"
+)
+
+var reportFormats = []string{formatAuto, formatJunit, formatGoTest, formatTap, formatXunit, formatNunit, formatTrx, formatCtrf, formatPlaywright}
+
+// reportParsers convert a report of a given format to JUnit test suites.
+var reportParsers = map[string]func(name string, data []byte) ([]junit.Suite, error){
+	formatJunit:      parseJunit,
+	formatGoTest:     parseGoTestJson,
+	formatTap:        parseTap,
+	formatXunit:      parseXunit,
+	formatNunit:      parseNunit,
+	formatTrx:        parseTrx,
+	formatCtrf:       parseCtrf,
+	formatPlaywright: parsePlaywright,
+}
+
+// reportExtensions are extensions of files that are considered reports when walking a directory.
+var reportExtensions = []string{".xml", ".trx", ".json", ".jsonl", ".tap"}
+
+func validReportFormat(f string) bool {
+	for _, r := range reportFormats {
+		if r == f {
+			return true
+		}
+	}
+	return false
+}
+
+func hasReportExtension(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, e := range reportExtensions {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// ingestReport converts a single report to JUnit test suites and returns the format it was read as.
+// Reports in an unknown format are ignored, returning an empty format, when the format is detected.
+func ingestReport(name string, data []byte, format string) ([]junit.Suite, string, error) {
+	if format == "" || format == formatAuto {
+		format = detectFormat(name, data)
+		if format == "" {
+			return nil, "", nil
+		}
+	}
+	parse, ok := reportParsers[format]
+	if !ok {
+		return nil, "", errors.Errorf("unknown report format %q", format)
+	}
+	suites, err := parse(name, data)
+	if err != nil {
+		return nil, "", err
+	}
+	for i := range suites {
+		aggregate(&suites[i])
+	}
+	return suites, format, nil
+}
+
+func aggregate(suite *junit.Suite) {
+	for i := range suite.Suites {
+		aggregate(&suite.Suites[i])
+	}
+	suite.Aggregate()
+}
+
+var tapStart = regexp.MustCompile(`^(TAP version \d+|1\.\.\d+|(not )?ok\b)`)
+
+// detectFormat guesses the format of a report, returning an empty string for unknown ones.
+func detectFormat(name string, data []byte) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".trx":
+		return formatTrx
+	case ".tap":
+		return formatTap
+	}
+
+	content := bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	switch {
+	case bytes.HasPrefix(content, []byte("<")):
+		return detectXmlFormat(content)
+	case bytes.HasPrefix(content, []byte("{")):
+		return detectJsonFormat(content)
+	case tapStart.Match(content):
+		return formatTap
+	}
+	return ""
+}
+
+func detectXmlFormat(content []byte) string {
+	switch detectRoot(content) {
+	case "", "testsuites", "testsuite":
+		// Let the JUnit parser report what is wrong with malformed files.
+		return formatJunit
+	case "assemblies", "assembly":
+		return formatXunit
+	case "test-run", "test-results":
+		return formatNunit
+	case "TestRun":
+		return formatTrx
+	}
+	return ""
+}
+
+func detectJsonFormat(content []byte) string {
+	// go test -json writes one event per line.
+	line, _, _ := bufio.NewReader(bytes.NewReader(content)).ReadLine()
+	event := map[string]json.RawMessage{}
+	if json.Unmarshal(line, &event) == nil {
+		if _, ok := event["Action"]; ok {
+			return formatGoTest
+		}
+	}
+
+	report := map[string]json.RawMessage{}
+	if err := json.Unmarshal(content, &report); err != nil {
+		return ""
+	}
+	if _, ok := report["results"]; ok {
+		return formatCtrf
+	}
+	if _, ok := report["suites"]; ok {
+		if _, ok := report["config"]; ok {
+			return formatPlaywright
+		}
+	}
+	return ""
+}
+
+// suiteName names suites of formats that do not have one after the report file.
+func suiteName(name string) string {
+	base := filepath.Base(name)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// newFailure returns an error of a failed test.
+func newFailure(message, kind, body string) error {
+	return junit.Error{Message: message, Type: kind, Body: body}
+}
+
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+
+func stripAnsi(s string) string {
+	return ansiEscape.ReplaceAllString(s, "")
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	junit "github.com/joshdk/go-junit"
+)
+
+type ctrfReport struct {
+	Results struct {
+		Tool struct {
+			Name string `json:"name"`
+		} `json:"tool"`
+		Tests []ctrfTest `json:"tests"`
+	} `json:"results"`
+}
+
+type ctrfTest struct {
+	Name     string          `json:"name"`
+	Status   string          `json:"status"`
+	Duration float64         `json:"duration"`
+	Message  string          `json:"message"`
+	Trace    string          `json:"trace"`
+	Suite    json.RawMessage `json:"suite"`
+	FilePath string          `json:"filePath"`
+	Stdout   []string        `json:"stdout"`
+	Stderr   []string        `json:"stderr"`
+}
+
+// parseCtrf converts a Common Test Report Format report to a suite per test suite or file.
+func parseCtrf(name string, data []byte) ([]junit.Suite, error) {
+	report := ctrfReport{}
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+
+	var suites []junit.Suite
+	index := map[string]int{}
+	for _, t := range report.Results.Tests {
+		classname := ctrfSuite(t.Suite)
+		if classname == "" {
+			classname = t.FilePath
+		}
+		if classname == "" {
+			classname = report.Results.Tool.Name
+		}
+		if classname == "" {
+			classname = suiteName(name)
+		}
+		i, ok := index[classname]
+		if !ok {
+			i = len(suites)
+			index[classname] = i
+			suites = append(suites, junit.Suite{Name: classname})
+		}
+
+		test := junit.Test{
+			Name:      t.Name,
+			Classname: classname,
+			Duration:  time.Duration(t.Duration * float64(time.Millisecond)),
+			SystemOut: strings.Join(t.Stdout, "\n"),
+			SystemErr: strings.Join(t.Stderr, "\n"),
+		}
+		switch t.Status {
+		case "passed":
+			test.Status = junit.StatusPassed
+		case "failed":
+			test.Status = junit.StatusFailed
+			test.Message = stripAnsi(t.Message)
+			test.Error = newFailure(test.Message, "", stripAnsi(t.Trace))
+		default:
+			test.Status = junit.StatusSkipped
+			test.Message = stripAnsi(t.Message)
+		}
+		suites[i].Tests = append(suites[i].Tests, test)
+	}
+	return suites, nil
+}
+
+// ctrfSuite returns the suite of a test which is either a string or a list of nested suites.
+func ctrfSuite(raw json.RawMessage) string {
+	var suite string
+	if json.Unmarshal(raw, &suite) == nil {
+		return suite
+	}
+	var suites []string
+	if json.Unmarshal(raw, &suites) == nil {
+		return strings.Join(suites, " > ")
+	}
+	return ""
+}
+
+type playwrightSuite struct {
+	Title  string            `json:"title"`
+	File   string            `json:"file"`
+	Specs  []playwrightSpec  `json:"specs"`
+	Suites []playwrightSuite `json:"suites"`
+}
+
+type playwrightSpec struct {
+	Title string           `json:"title"`
+	File  string           `json:"file"`
+	Tests []playwrightTest `json:"tests"`
+}
+
+type playwrightTest struct {
+	ProjectName string             `json:"projectName"`
+	Status      string             `json:"status"`
+	Results     []playwrightResult `json:"results"`
+}
+
+type playwrightResult struct {
+	Status   string             `json:"status"`
+	Duration float64            `json:"duration"`
+	Error    *playwrightError   `json:"error"`
+	Stdout   []playwrightOutput `json:"stdout"`
+	Stderr   []playwrightOutput `json:"stderr"`
+}
+
+type playwrightError struct {
+	Message string `json:"message"`
+	Stack   string `json:"stack"`
+}
+
+type playwrightOutput struct {
+	Text string `json:"text"`
+}
+
+// parsePlaywright converts a Playwright JSON report to a suite per spec file.
+// Tests are named like in the Playwright output: [project] › describe › title.
+func parsePlaywright(_ string, data []byte) ([]junit.Suite, error) {
+	report := struct {
+		Suites []playwrightSuite `json:"suites"`
+	}{}
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+	suites := make([]junit.Suite, 0, len(report.Suites))
+	for _, s := range report.Suites {
+		suite := junit.Suite{Name: s.File}
+		if suite.Name == "" {
+			suite.Name = s.Title
+		}
+		s.addTests(&suite, nil)
+		suites = append(suites, suite)
+	}
+	return suites, nil
+}
+
+func (s playwrightSuite) addTests(suite *junit.Suite, titles []string) {
+	for _, spec := range s.Specs {
+		for _, t := range spec.Tests {
+			suite.Tests = append(suite.Tests, t.toJunit(suite.Name, append(titles, spec.Title)))
+		}
+	}
+	for _, child := range s.Suites {
+		child.addTests(suite, append(titles[:len(titles):len(titles)], child.Title))
+	}
+}
+
+func (t playwrightTest) toJunit(classname string, titles []string) junit.Test {
+	name := strings.Join(titles, " › ")
+	if t.ProjectName != "" {
+		name = "[" + t.ProjectName + "] › " + name
+	}
+	test := junit.Test{Name: name, Classname: classname}
+	var last playwrightResult
+	for _, r := range t.Results {
+		test.Duration += time.Duration(r.Duration * float64(time.Millisecond))
+		last = r
+	}
+	for _, o := range last.Stdout {
+		test.SystemOut += o.Text
+	}
+	for _, o := range last.Stderr {
+		test.SystemErr += o.Text
+	}
+
+	switch t.Status {
+	case "expected", "flaky":
+		test.Status = junit.StatusPassed
+		if last.Status == "skipped" {
+			test.Status = junit.StatusSkipped
+		}
+	case "unexpected":
+		test.Status = junit.StatusFailed
+		test.Message = last.Status
+		body := ""
+		if last.Error != nil {
+			test.Message = stripAnsi(firstLine(last.Error.Message))
+			body = stripAnsi(last.Error.Stack)
+			if body == "" {
+				body = stripAnsi(last.Error.Message)
+			}
+		}
+		test.Error = newFailure(test.Message, last.Status, body)
+	default:
+		test.Status = junit.StatusSkipped
+	}
+	return test
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	junit "github.com/joshdk/go-junit"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+func parseJunit(name string, data []byte) ([]junit.Suite, error) {
+	suites, err := junit.IngestReader(bytes.NewReader(data))
+	if err == nil {
+		return addSuiteErrors(suites, data), nil
+	}
+	repaired, ok := repairTruncated(name, data)
+	if !ok {
+		return nil, err
+	}
+	log.Warnf("%s is truncated, reporting the test or suite that was running as crashed", name)
+	suites, err = junit.IngestReader(bytes.NewReader(repaired))
+	if err != nil {
+		return nil, err
+	}
+	return addSuiteErrors(suites, repaired), nil
+}
+
+const crashedMessage = "Report is truncated, the test probably crashed"
+
+// repairTruncated closes elements left open in a JUnit report that was cut short
+// (e.g. when the test process was killed) and adds an error to the test that was running.
+// When the report was cut between tests, an error test named "Crashed" is added to the open suite.
+func repairTruncated(name string, data []byte) ([]byte, bool) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var open []string
+	var suites []string
+	end := int64(0)
+	failed := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			// The report is complete, so it is malformed in another way.
+			return nil, false
+		}
+		if err != nil {
+			var syntaxError *xml.SyntaxError
+			if !errors.As(err, &syntaxError) || !strings.HasPrefix(syntaxError.Msg, "unexpected EOF") {
+				return nil, false
+			}
+			break
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			open = append(open, t.Name.Local)
+			switch t.Name.Local {
+			case "testsuite":
+				suites = append(suites, attr(t, "name"))
+			case "testcase":
+				failed = false
+			case "failure", "error":
+				failed = true
+			}
+		case xml.EndElement:
+			open = open[:len(open)-1]
+			if t.Name.Local == "testsuite" {
+				suites = suites[:len(suites)-1]
+			}
+		}
+		end = decoder.InputOffset()
+	}
+	if len(open) == 0 {
+		return nil, false
+	}
+
+	repaired := bytes.NewBuffer(append([]byte{}, data[:end]...))
+	crashed := false
+	for i := len(open) - 1; i >= 0; i-- {
+		if !crashed {
+			switch open[i] {
+			case "testcase":
+				crashed = true
+				if !failed {
+					repaired.WriteString(`<error message="` + escape(crashedMessage) + `"></error>`)
+				}
+			case "testsuite", "testsuites":
+				crashed = true
+				suite := suiteName(name)
+				if len(suites) > 0 {
+					suite = suites[len(suites)-1]
+				}
+				test := `<testcase name="Crashed" classname="` + escape(suite) + `"><error message="` + escape(crashedMessage) + `"></error></testcase>`
+				if open[i] == "testsuites" {
+					test = `<testsuite name="` + escape(suite) + `">` + test + `</testsuite>`
+				}
+				repaired.WriteString(test)
+			}
+		}
+		repaired.WriteString("</" + open[i] + ">")
+	}
+	return repaired.Bytes(), true
+}
+
+func attr(e xml.StartElement, name string) string {
+	for _, a := range e.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func escape(s string) string {
+	b := bytes.NewBuffer(nil)
+	_ = xml.EscapeText(b, []byte(s))
+	return b.String()
+}
+
+// suiteErrorName names tests reporting errors of a suite that happened outside of its tests.
+const suiteErrorName = "Suite error"
+
+// xmlElement is a generic XML element used to find what go-junit ignores.
+type xmlElement struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr   `xml:",any,attr"`
+	Content string       `xml:",chardata"`
+	Nodes   []xmlElement `xml:",any"`
+}
+
+func (e xmlElement) attr(name string) string {
+	for _, a := range e.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// addSuiteErrors reports failure and error elements of test suites, which go-junit ignores,
+// as failed tests of the suite. Suites that report more errors or failures than their tests had
+// (e.g. because they crashed before running them) get an error test as well.
+func addSuiteErrors(suites []junit.Suite, data []byte) []junit.Suite {
+	root := xmlElement{}
+	// Reports can have many root elements, so wrap them the same way go-junit does.
+	reader := io.MultiReader(strings.NewReader("<fake-root>"), bytes.NewReader(data), strings.NewReader("</fake-root>"))
+	if err := xml.NewDecoder(reader).Decode(&root); err != nil {
+		// go-junit is more forgiving than encoding/xml, so the report is still usable.
+		log.WithError(err).Debug("Could not look for suite errors")
+		return suites
+	}
+
+	// Walk suites in the same order go-junit found them.
+	i := 0
+	var find func(nodes []xmlElement)
+	find = func(nodes []xmlElement) {
+		for _, node := range nodes {
+			if node.XMLName.Local != "testsuite" {
+				find(node.Nodes)
+				continue
+			}
+			if i < len(suites) {
+				addSuiteError(&suites[i], node)
+			}
+			i++
+		}
+	}
+	find(root.Nodes)
+	return suites
+}
+
+func addSuiteError(suite *junit.Suite, node xmlElement) {
+	nested, reported := 0, 0
+	for _, n := range node.Nodes {
+		switch n.XMLName.Local {
+		case "testsuite":
+			if nested < len(suite.Suites) {
+				addSuiteError(&suite.Suites[nested], n)
+			}
+			nested++
+		case "failure", "error":
+			test := junit.Test{
+				Name:      suiteErrorName,
+				Classname: suite.Name,
+				Status:    junit.StatusFailed,
+				Message:   n.attr("message"),
+				SystemErr: suite.SystemErr,
+				Error:     newFailure(n.attr("message"), n.attr("type"), n.Content),
+			}
+			if n.XMLName.Local == "error" {
+				test.Status = junit.StatusError
+			}
+			suite.Tests = append(suite.Tests, test)
+			reported++
+		}
+	}
+	// Counts of suites with nested suites include failures of the nested ones.
+	if nested > 0 || reported > 0 {
+		return
+	}
+
+	failed := 0
+	for _, t := range suite.Tests {
+		if t.Error != nil {
+			failed++
+		}
+	}
+	errs, _ := strconv.Atoi(node.attr("errors"))
+	failures, _ := strconv.Atoi(node.attr("failures"))
+	if errs+failures > failed {
+		message := fmt.Sprintf("Suite reported %d errors and %d failures, but only %d of its tests failed", errs, failures, failed)
+		suite.Tests = append(suite.Tests, junit.Test{
+			Name:      suiteErrorName,
+			Classname: suite.Name,
+			Status:    junit.StatusError,
+			Message:   message,
+			SystemErr: suite.SystemErr,
+			Error:     newFailure(message, "", suite.SystemErr),
+		})
+	}
+}
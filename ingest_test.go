@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	junit "github.com/joshdk/go-junit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flatten lists tests as classname | name | status | message.
+func flatten(suites []junit.Suite) []string {
+	var tests []string
+	for _, s := range suites {
+		tests = append(tests, flatten(s.Suites)...)
+		for _, t := range s.Tests {
+			tests = append(tests, fmt.Sprintf("%s | %s | %s | %s", t.Classname, t.Name, t.Status, t.Message))
+		}
+	}
+	return tests
+}
+
+func TestIngestReports(t *testing.T) {
+	for file, expected := range map[string][]string{
+		"go-test.json": {
+			"github.com/stackrox/rox/pkg/retry | TestRetry | passed | ",
+			"github.com/stackrox/rox/pkg/retry | TestBackoff | failed | Failed",
+			"github.com/stackrox/rox/pkg/retry | TestBackoff/exponential | failed | Failed",
+			"github.com/stackrox/rox/pkg/retry | TestSkipped | skipped | retry_test.go:50: requires a cluster",
+			"github.com/stackrox/rox/pkg/timeout | TestTimeout | error | No test result found",
+			"github.com/stackrox/rox/pkg/broken | Failure | error | Package failed",
+		},
+		"report.tap": {
+			"report | returns users | passed | ",
+			"report | creates a user | failed | expected 201 to equal 400",
+			"report | deletes a user | skipped | not implemented",
+			"report | updates a user | skipped | flaky backend",
+			"report | Missing tests | error | Planned 5 tests but only 4 ran",
+		},
+		"xunit.xml": {
+			"Stackrox.Tests.MathTests | Adds | passed | ",
+			"Stackrox.Tests.MathTests | Divides(x: 1, y: 0) | failed | Attempted to divide by zero.",
+			"Stackrox.Tests.MathTests | Subtracts | skipped | Not ready",
+			"Stackrox.Tests.DatabaseTests | test-class-cleanup | error | Connection already closed",
+		},
+		"nunit3.xml": {
+			"Stackrox.MathTests | Adds | passed | ",
+			"Stackrox.MathTests | Divides(1,0) | error | System.DivideByZeroException : Attempted to divide by zero.",
+			"Stackrox.MathTests | Subtracts | skipped | Not ready",
+		},
+		"nunit2.xml": {
+			"Stackrox.MathTests | Adds | passed | ",
+			"Stackrox.MathTests | Multiplies | failed | Expected: 6 But was: 5",
+		},
+		"results.trx": {
+			"Stackrox.MathTests | Adds | passed | ",
+			"Stackrox.MathTests | Divides | failed | Assert.AreEqual failed. Expected:<1>. Actual:<0>.",
+			"Stackrox.MathTests | Subtracts | skipped | ",
+		},
+		"ctrf-report.json": {
+			"login.cy.ts > Login | logs in | passed | ",
+			"cypress/e2e/violations.cy.ts | shows violations | failed | Timed out retrying after 4000ms: Expected to find element: [data-testid=violations]",
+			"cypress/e2e/violations.cy.ts | exports CSV | skipped | ",
+		},
+		"playwright-report.json": {
+			"violations.spec.ts | [chromium] › lists violations | passed | ",
+			"violations.spec.ts | [chromium] › details › opens a violation | failed | Test timeout of 30000ms exceeded.",
+			"violations.spec.ts | [firefox] › details › opens a violation | passed | ",
+			"violations.spec.ts | [chromium] › details › resolves a violation | skipped | ",
+		},
+	} {
+		t.Run(file, func(t *testing.T) {
+			suites, err := ingestReports(params{inputs: []string{"testdata/formats/" + file}, reportFormat: formatAuto})
+			require.NoError(t, err)
+			assert.Equal(t, expected, flatten(suites))
+		})
+	}
+}
+
+func TestIngestReportsDetails(t *testing.T) {
+	suites, err := ingestReports(params{inputs: []string{"testdata/formats/go-test.json"}, reportFormat: formatGoTest})
+	require.NoError(t, err)
+	require.Len(t, suites, 3)
+	assert.Equal(t, junit.Totals{Tests: 4, Passed: 1, Failed: 2, Skipped: 1, Duration: 120 * time.Millisecond}, suites[0].Totals)
+	assert.Equal(t, "    retry_test.go:42: expected 4s, got 2s\n", suites[0].Tests[2].Error.Error())
+	assert.Contains(t, suites[1].Tests[0].Error.Error(), "panic: test timed out after 1s")
+	assert.Contains(t, suites[2].Tests[0].Error.Error(), "syntax error")
+
+	j := junit2jira{params: params{threshold: 10}}
+	failed, err := j.findFailedTests(suites)
+	require.NoError(t, err)
+	require.Len(t, failed, 3)
+	assert.Equal(t, "TestBackoff", failed[0].Name)
+	assert.Contains(t, failed[0].Error, "Sub test TestBackoff/exponential")
+
+	suites, err = ingestReports(params{inputs: []string{"testdata/formats/playwright-report.json"}, reportFormat: formatAuto})
+	require.NoError(t, err)
+	failure := suites[0].Tests[1]
+	assert.Equal(t, 33*time.Second, failure.Duration)
+	assert.Equal(t, "opening violation\n", failure.SystemOut)
+	assert.Equal(t, "Error: Test timeout of 30000ms exceeded.\n    at violations.spec.ts:21:5", failure.Error.Error())
+
+	suites, err = ingestReports(params{inputs: []string{"testdata/formats/results.trx"}, reportFormat: formatAuto})
+	require.NoError(t, err)
+	assert.Equal(t, 1500*time.Millisecond, suites[0].Tests[1].Duration)
+	assert.Equal(t, "dividing 1 by 0", suites[0].Tests[1].SystemOut)
+}
+
+func TestDetectFormat(t *testing.T) {
+	for _, tc := range []struct {
+		name, content, expected string
+	}{
+		{"report.xml", `<?xml version="1.0"?><testsuites></testsuites>`, formatJunit},
+		{"report.xml", `<testsuite name="suite">`, formatJunit},
+		{"pom.xml", `<project></project>`, ""},
+		{"package.json", `{"name": "ui"}`, ""},
+		{"output.txt", "ok 1 - test", formatTap},
+		{"output.txt", "build log", ""},
+		{"results.trx", "", formatTrx},
+	} {
+		assert.Equal(t, tc.expected, detectFormat(tc.name, []byte(tc.content)), tc)
+	}
+
+	suites, format, err := ingestReport("package.json", []byte(`{"name": "ui"}`), formatAuto)
+	assert.NoError(t, err)
+	assert.Empty(t, suites)
+	assert.Empty(t, format)
+
+	_, err = ingestReports(params{inputs: []string{"testdata/formats/go-test.json"}, reportFormat: formatTrx, parseMode: parseStrict})
+	assert.Error(t, err)
+}
+
+func TestIngestReportsDir(t *testing.T) {
+	suites, err := ingestReports(params{inputs: []string{"testdata/formats"}, reportFormat: formatAuto})
+	require.NoError(t, err)
+	assert.Len(t, flatten(suites), 30)
+
+	junitSuites, err := junit.IngestDir("testdata/jira")
+	require.NoError(t, err)
+	suites, err = ingestReports(params{inputs: []string{"testdata/jira"}, reportFormat: formatAuto})
+	require.NoError(t, err)
+	assert.Equal(t, flatten(junitSuites), flatten(suites))
+}
+
+func TestRepairTruncated(t *testing.T) {
+	for name, tc := range map[string]struct {
+		report   string
+		expected []string
+	}{
+		"in test output": {
+			report: `<testsuites><testsuite name="suite"><testcase name="TestOk" classname="suite"></testcase><testcase name="TestRunning" classname="suite"><system-out><![CDATA[starting`,
+			expected: []string{
+				"suite | TestOk | passed | ",
+				"suite | TestRunning | error | " + crashedMessage,
+			},
+		},
+		"in failure": {
+			report: `<testsuite name="suite"><testcase name="TestFailed" classname="suite"><failure message="boom">stack`,
+			expected: []string{
+				"suite | TestFailed | failed | boom",
+			},
+		},
+		"between tests": {
+			report: `<?xml version="1.0"?><testsuites><testsuite name="outer"><testsuite name="inner"><testcase name="TestOk" classname="inner"/><testca`,
+			expected: []string{
+				"inner | TestOk | passed | ",
+				"inner | Crashed | error | " + crashedMessage,
+			},
+		},
+		"between suites": {
+			report: `<testsuites><testsuite name="done"><testcase name="TestOk" classname="done"/></testsuite>`,
+			expected: []string{
+				"done | TestOk | passed | ",
+				"junit-e2e | Crashed | error | " + crashedMessage,
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			suites, format, err := ingestReport("junit-e2e.xml", []byte(tc.report), formatAuto)
+			require.NoError(t, err)
+			assert.Equal(t, formatJunit, format)
+			assert.Equal(t, tc.expected, flatten(suites))
+		})
+	}
+
+	_, ok := repairTruncated("junit.xml", []byte(`<testsuite><testcase></testsuite>`))
+	assert.False(t, ok, "mismatched tags are not a truncation")
+	_, ok = repairTruncated("junit.xml", []byte(`<testsuite></testsuite>`))
+	assert.False(t, ok)
+}
+
+func TestSuiteErrors(t *testing.T) {
+	suites, _, err := ingestReport("junit.xml", []byte(`<testsuites>
+  <testsuite name="./tests/central" tests="0" failures="0">
+    <testsuite name="central-basic" tests="1" failures="1">
+      <testcase name="setup" classname="central-basic"/>
+      <failure message="failed in setup" type="">namespace could not be created</failure>
+    </testsuite>
+  </testsuite>
+  <testsuite name="DefaultPoliciesTest" tests="0" errors="1">
+    <system-err>java.lang.OutOfMemoryError</system-err>
+  </testsuite>
+  <testsuite name="consistent" tests="1" failures="1">
+    <testcase name="TestFailed" classname="consistent"><failure message="boom"/></testcase>
+  </testsuite>
+</testsuites>`), formatJunit)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"central-basic | setup | passed | ",
+		"central-basic | Suite error | failed | failed in setup",
+		"DefaultPoliciesTest | Suite error | error | Suite reported 1 errors and 0 failures, but only 0 of its tests failed",
+		"consistent | TestFailed | failed | boom",
+	}, flatten(suites))
+	assert.Equal(t, 1, suites[0].Totals.Failed)
+	assert.Equal(t, "namespace could not be created", suites[0].Suites[0].Tests[1].Error.Error())
+	assert.Equal(t, "java.lang.OutOfMemoryError", suites[1].Tests[0].Error.Error())
+}
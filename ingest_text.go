@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	junit "github.com/joshdk/go-junit"
+	"github.com/pkg/errors"
+)
+
+// goTestEvent is a single line of the go test -json output, see go doc test2json.
+type goTestEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64
+	Output  string
+}
+
+// goTestFraming matches lines printed by go test around the test output.
+var goTestFraming = regexp.MustCompile(`^\s*(=== (RUN|PAUSE|CONT|NAME)\s|--- (PASS|FAIL|SKIP): )`)
+
+// parseGoTestJson converts go test -json output to a suite per package,
+// the same way go-junit-report does.
+func parseGoTestJson(_ string, data []byte) ([]junit.Suite, error) {
+	type goTest struct {
+		test   junit.Test
+		output strings.Builder
+		done   bool
+	}
+	type goPackage struct {
+		suite  junit.Suite
+		tests  map[string]*goTest
+		order  []string
+		output strings.Builder
+		failed bool
+	}
+	packages := map[string]*goPackage{}
+	var order []string
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		b := bytes.TrimSpace(scanner.Bytes())
+		// Build errors and other messages can be interleaved with events.
+		if !bytes.HasPrefix(b, []byte("{")) {
+			continue
+		}
+		event := goTestEvent{}
+		if err := json.Unmarshal(b, &event); err != nil {
+			return nil, errors.Wrapf(err, "line %d", line)
+		}
+		if event.Package == "" {
+			continue
+		}
+
+		pkg, ok := packages[event.Package]
+		if !ok {
+			pkg = &goPackage{suite: junit.Suite{Name: event.Package, Package: event.Package}, tests: map[string]*goTest{}}
+			packages[event.Package] = pkg
+			order = append(order, event.Package)
+		}
+		if event.Test == "" {
+			switch event.Action {
+			case "output":
+				if !goTestFraming.MatchString(event.Output) {
+					pkg.output.WriteString(event.Output)
+				}
+			case "fail":
+				pkg.failed = true
+			}
+			continue
+		}
+
+		test, ok := pkg.tests[event.Test]
+		if !ok {
+			test = &goTest{test: junit.Test{Name: event.Test, Classname: event.Package}}
+			pkg.tests[event.Test] = test
+			pkg.order = append(pkg.order, event.Test)
+		}
+		switch event.Action {
+		case "output":
+			if !goTestFraming.MatchString(event.Output) {
+				test.output.WriteString(event.Output)
+			}
+		case "pass", "fail", "skip":
+			test.done = true
+			test.test.Duration = time.Duration(event.Elapsed * float64(time.Second))
+			test.test.Status = map[string]junit.Status{
+				"pass": junit.StatusPassed,
+				"fail": junit.StatusFailed,
+				"skip": junit.StatusSkipped,
+			}[event.Action]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	suites := make([]junit.Suite, 0, len(packages))
+	for _, name := range order {
+		pkg := packages[name]
+		failed := false
+		for _, testName := range pkg.order {
+			test := pkg.tests[testName]
+			output := test.output.String()
+			switch {
+			case !test.done:
+				// The test binary crashed or timed out while the test was running.
+				test.test.Status = junit.StatusError
+				test.test.Message = "No test result found"
+				test.test.Error = newFailure(test.test.Message, "", output+pkg.output.String())
+				failed = true
+			case test.test.Status == junit.StatusFailed:
+				test.test.Message = "Failed"
+				test.test.Error = newFailure(test.test.Message, "", output)
+				failed = true
+			case test.test.Status == junit.StatusSkipped:
+				test.test.Message = strings.TrimSpace(output)
+			default:
+				test.test.SystemOut = output
+			}
+			pkg.suite.Tests = append(pkg.suite.Tests, test.test)
+		}
+		if pkg.failed && !failed {
+			// Build failures and failures outside of tests (e.g. in TestMain) are reported as a package failure.
+			pkg.suite.Tests = append(pkg.suite.Tests, junit.Test{
+				Name:      "Failure",
+				Classname: name,
+				Status:    junit.StatusError,
+				Message:   "Package failed",
+				Error:     newFailure("Package failed", "", pkg.output.String()),
+			})
+		}
+		suites = append(suites, pkg.suite)
+	}
+	return suites, nil
+}
+
+var (
+	tapTestLine = regexp.MustCompile(`^(not )?ok\b\s*(\d+)?\s*(?:-\s*)?([^#]*?)\s*(?:#\s*(\w+)\b\s*(.*))?$`)
+	tapPlan     = regexp.MustCompile(`^1\.\.(\d+)`)
+	tapBailOut  = regexp.MustCompile(`^Bail out!\s*(.*)$`)
+	tapMessage  = regexp.MustCompile(`^\s*message:\s*(.*)$`)
+)
+
+// parseTap converts a Test Anything Protocol stream to a single suite named after the file.
+// Indented lines are YAML diagnostics of the previous test or subtests, which are reported by their parent test.
+func parseTap(name string, data []byte) ([]junit.Suite, error) {
+	suite := junit.Suite{Name: suiteName(name)}
+	planned := -1
+	var diagnostics []string
+	inDiagnostics := false
+
+	// addDiagnostics attaches the YAML block to the last failed test.
+	addDiagnostics := func() {
+		if len(suite.Tests) == 0 || len(diagnostics) == 0 {
+			return
+		}
+		test := &suite.Tests[len(suite.Tests)-1]
+		if test.Error == nil {
+			return
+		}
+		body := strings.Join(diagnostics, "\n")
+		for _, d := range diagnostics {
+			if m := tapMessage.FindStringSubmatch(d); m != nil {
+				test.Message = unquoteYaml(m[1])
+			}
+		}
+		test.Error = newFailure(test.Message, "", body)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		trimmed := strings.TrimSpace(line)
+		if inDiagnostics {
+			if trimmed == "..." {
+				inDiagnostics = false
+				addDiagnostics()
+				continue
+			}
+			diagnostics = append(diagnostics, strings.TrimPrefix(line, "  "))
+			continue
+		}
+		if trimmed == "---" && line != trimmed {
+			inDiagnostics = true
+			diagnostics = nil
+			continue
+		}
+		if line != trimmed {
+			continue
+		}
+		if m := tapPlan.FindStringSubmatch(line); m != nil {
+			planned, _ = strconv.Atoi(m[1])
+			continue
+		}
+		if m := tapBailOut.FindStringSubmatch(line); m != nil {
+			suite.Tests = append(suite.Tests, junit.Test{
+				Name:      "Bail out!",
+				Classname: suite.Name,
+				Status:    junit.StatusError,
+				Message:   m[1],
+				Error:     newFailure(m[1], "", line),
+			})
+			planned = -1
+			continue
+		}
+		m := tapTestLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		test := junit.Test{Name: m[3], Classname: suite.Name, Status: junit.StatusPassed}
+		if test.Name == "" {
+			test.Name = "test " + m[2]
+		}
+		switch directive := strings.ToUpper(m[4]); {
+		case directive == "SKIP" || directive == "TODO":
+			// Failing TODO tests are expected to fail.
+			test.Status = junit.StatusSkipped
+			test.Message = m[5]
+		case m[1] != "":
+			test.Status = junit.StatusFailed
+			test.Message = "not ok"
+			test.Error = newFailure(test.Message, "", line)
+		}
+		suite.Tests = append(suite.Tests, test)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if planned > len(suite.Tests) {
+		message := fmt.Sprintf("Planned %d tests but only %d ran", planned, len(suite.Tests))
+		suite.Tests = append(suite.Tests, junit.Test{
+			Name:      "Missing tests",
+			Classname: suite.Name,
+			Status:    junit.StatusError,
+			Message:   message,
+			Error:     newFailure(message, "", ""),
+		})
+	}
+	return []junit.Suite{suite}, nil
+}
+
+func unquoteYaml(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && (s[0] == '\'' && s[len(s)-1] == '\'' || s[0] == '"' && s[len(s)-1] == '"') {
+		if s[0] == '\'' {
+			return strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+		}
+		if u, err := strconv.Unquote(s); err == nil {
+			return u
+		}
+	}
+	return s
+}
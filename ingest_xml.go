@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	junit "github.com/joshdk/go-junit"
+)
+
+type xunitAssemblies struct {
+	Assemblies []xunitAssembly `xml:"assembly"`
+}
+
+type xunitAssembly struct {
+	Name        string            `xml:"name,attr"`
+	Errors      []xunitError      `xml:"errors>error"`
+	Collections []xunitCollection `xml:"collection"`
+}
+
+type xunitError struct {
+	Type    string        `xml:"type,attr"`
+	Name    string        `xml:"name,attr"`
+	Failure *xunitFailure `xml:"failure"`
+}
+
+type xunitCollection struct {
+	Name  string      `xml:"name,attr"`
+	Tests []xunitTest `xml:"test"`
+}
+
+type xunitTest struct {
+	Name    string        `xml:"name,attr"`
+	Type    string        `xml:"type,attr"`
+	Time    string        `xml:"time,attr"`
+	Result  string        `xml:"result,attr"`
+	Failure *xunitFailure `xml:"failure"`
+	Reason  string        `xml:"reason"`
+	Output  string        `xml:"output"`
+}
+
+type xunitFailure struct {
+	ExceptionType string `xml:"exception-type,attr"`
+	Message       string `xml:"message"`
+	StackTrace    string `xml:"stack-trace"`
+}
+
+// parseXunit converts an xUnit.net v2 report to a suite per assembly.
+func parseXunit(_ string, data []byte) ([]junit.Suite, error) {
+	report := xunitAssemblies{}
+	if detectRoot(data) == "assembly" {
+		report.Assemblies = make([]xunitAssembly, 1)
+		if err := xml.Unmarshal(data, &report.Assemblies[0]); err != nil {
+			return nil, err
+		}
+	} else if err := xml.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+
+	suites := make([]junit.Suite, 0, len(report.Assemblies))
+	for _, assembly := range report.Assemblies {
+		suite := junit.Suite{Name: baseName(assembly.Name), Package: assembly.Name}
+		for _, collection := range assembly.Collections {
+			for _, t := range collection.Tests {
+				classname := t.Type
+				if classname == "" {
+					classname = collection.Name
+				}
+				test := junit.Test{
+					Name:      strings.TrimPrefix(t.Name, classname+"."),
+					Classname: classname,
+					Duration:  seconds(t.Time),
+					SystemOut: t.Output,
+				}
+				switch t.Result {
+				case "Pass":
+					test.Status = junit.StatusPassed
+				case "Fail":
+					test.Status = junit.StatusFailed
+					if t.Failure != nil {
+						test.Message = t.Failure.Message
+						test.Error = newFailure(t.Failure.Message, t.Failure.ExceptionType, t.Failure.StackTrace)
+					} else {
+						test.Error = newFailure("Failed", "", "")
+					}
+				default:
+					test.Status = junit.StatusSkipped
+					test.Message = t.Reason
+				}
+				suite.Tests = append(suite.Tests, test)
+			}
+		}
+		// Errors outside of tests, e.g. in fixture cleanup.
+		for _, e := range assembly.Errors {
+			test := junit.Test{Name: e.Type, Classname: e.Name, Status: junit.StatusError}
+			if test.Classname == "" {
+				test.Classname = suite.Name
+			}
+			if e.Failure != nil {
+				test.Message = e.Failure.Message
+				test.Error = newFailure(e.Failure.Message, e.Failure.ExceptionType, e.Failure.StackTrace)
+			} else {
+				test.Error = newFailure(e.Type, "", "")
+			}
+			suite.Tests = append(suite.Tests, test)
+		}
+		suites = append(suites, suite)
+	}
+	return suites, nil
+}
+
+type nunitRun struct {
+	Suites []nunitSuite `xml:"test-suite"`
+}
+
+type nunitSuite struct {
+	Type     string `xml:"type,attr"`
+	Name     string `xml:"name,attr"`
+	FullName string `xml:"fullname,attr"`
+	// NUnit 3 nests suites and cases directly, NUnit 2 in a results element.
+	Suites        []nunitSuite `xml:"test-suite"`
+	Cases         []nunitCase  `xml:"test-case"`
+	ResultsSuites []nunitSuite `xml:"results>test-suite"`
+	ResultsCases  []nunitCase  `xml:"results>test-case"`
+}
+
+type nunitCase struct {
+	Name      string `xml:"name,attr"`
+	ClassName string `xml:"classname,attr"`
+	Result    string `xml:"result,attr"`
+	Label     string `xml:"label,attr"`
+	Executed  string `xml:"executed,attr"`
+	Duration  string `xml:"duration,attr"`
+	Time      string `xml:"time,attr"`
+	Failure   *struct {
+		Message    string `xml:"message"`
+		StackTrace string `xml:"stack-trace"`
+	} `xml:"failure"`
+	Reason struct {
+		Message string `xml:"message"`
+	} `xml:"reason"`
+	Output string `xml:"output"`
+}
+
+// parseNunit converts NUnit 2 and 3 reports to suites mirroring the nested test-suite elements.
+func parseNunit(_ string, data []byte) ([]junit.Suite, error) {
+	run := nunitRun{}
+	if err := xml.Unmarshal(data, &run); err != nil {
+		return nil, err
+	}
+	suites := make([]junit.Suite, 0, len(run.Suites))
+	for _, s := range run.Suites {
+		suites = append(suites, s.toJunit(""))
+	}
+	return suites, nil
+}
+
+func (s nunitSuite) toJunit(classname string) junit.Suite {
+	name := s.FullName
+	if name == "" {
+		name = s.Name
+	}
+	if s.Type == "TestFixture" || s.Type == "ParameterizedFixture" || classname == "" {
+		classname = name
+	}
+	suite := junit.Suite{Name: name}
+	for _, children := range [][]nunitSuite{s.Suites, s.ResultsSuites} {
+		for _, child := range children {
+			suite.Suites = append(suite.Suites, child.toJunit(classname))
+		}
+	}
+	for _, cases := range [][]nunitCase{s.Cases, s.ResultsCases} {
+		for _, c := range cases {
+			suite.Tests = append(suite.Tests, c.toJunit(classname))
+		}
+	}
+	return suite
+}
+
+func (c nunitCase) toJunit(classname string) junit.Test {
+	if c.ClassName != "" {
+		classname = c.ClassName
+	} else if !strings.HasPrefix(c.Name, classname+".") {
+		// NUnit 2 names fixtures without namespace, but test cases with it.
+		method := strings.Split(c.Name, "(")[0]
+		if i := strings.LastIndex(method, "."); i >= 0 {
+			classname = c.Name[:i]
+		}
+	}
+	test := junit.Test{
+		Name:      strings.TrimPrefix(c.Name, classname+"."),
+		Classname: classname,
+		SystemOut: c.Output,
+	}
+	if c.Duration != "" {
+		test.Duration = seconds(c.Duration)
+	} else {
+		test.Duration = seconds(c.Time)
+	}
+
+	failure := func(status junit.Status) {
+		test.Status = status
+		test.Message = "Failed"
+		body := ""
+		if c.Failure != nil {
+			test.Message = strings.TrimSpace(c.Failure.Message)
+			body = c.Failure.StackTrace
+		}
+		test.Error = newFailure(test.Message, c.Label, body)
+	}
+	switch {
+	case strings.EqualFold(c.Executed, "false"):
+		test.Status = junit.StatusSkipped
+		test.Message = strings.TrimSpace(c.Reason.Message)
+	case c.Result == "Passed" || c.Result == "Success":
+		test.Status = junit.StatusPassed
+	case c.Result == "Failed" && c.Label == "Error", c.Result == "Error", c.Result == "NotRunnable", c.Result == "Cancelled":
+		failure(junit.StatusError)
+	case c.Result == "Failed" || c.Result == "Failure":
+		failure(junit.StatusFailed)
+	default:
+		test.Status = junit.StatusSkipped
+		test.Message = strings.TrimSpace(c.Reason.Message)
+	}
+	return test
+}
+
+type trxRun struct {
+	Results     []trxResult `xml:"Results>UnitTestResult"`
+	Definitions []struct {
+		ID     string `xml:"id,attr"`
+		Method struct {
+			ClassName string `xml:"className,attr"`
+		} `xml:"TestMethod"`
+	} `xml:"TestDefinitions>UnitTest"`
+}
+
+type trxResult struct {
+	TestID   string `xml:"testId,attr"`
+	TestName string `xml:"testName,attr"`
+	Outcome  string `xml:"outcome,attr"`
+	Duration string `xml:"duration,attr"`
+	Output   struct {
+		StdOut    string `xml:"StdOut"`
+		StdErr    string `xml:"StdErr"`
+		ErrorInfo struct {
+			Message    string `xml:"Message"`
+			StackTrace string `xml:"StackTrace"`
+		} `xml:"ErrorInfo"`
+	} `xml:"Output"`
+}
+
+// parseTrx converts a Visual Studio test results file to a suite per test class.
+func parseTrx(name string, data []byte) ([]junit.Suite, error) {
+	run := trxRun{}
+	if err := xml.Unmarshal(data, &run); err != nil {
+		return nil, err
+	}
+	classes := map[string]string{}
+	for _, d := range run.Definitions {
+		// Class names can be followed by the assembly name.
+		classes[d.ID] = strings.TrimSpace(strings.Split(d.Method.ClassName, ",")[0])
+	}
+
+	var suites []junit.Suite
+	index := map[string]int{}
+	for _, r := range run.Results {
+		classname := classes[r.TestID]
+		if classname == "" {
+			classname = suiteName(name)
+		}
+		i, ok := index[classname]
+		if !ok {
+			i = len(suites)
+			index[classname] = i
+			suites = append(suites, junit.Suite{Name: classname})
+		}
+		test := junit.Test{
+			Name:      strings.TrimPrefix(r.TestName, classname+"."),
+			Classname: classname,
+			Duration:  trxDuration(r.Duration),
+			SystemOut: r.Output.StdOut,
+			SystemErr: r.Output.StdErr,
+		}
+		switch r.Outcome {
+		case "Passed", "PassedButRunAborted":
+			test.Status = junit.StatusPassed
+		case "Failed":
+			test.Status = junit.StatusFailed
+		case "Error", "Timeout", "Aborted":
+			test.Status = junit.StatusError
+		default:
+			test.Status = junit.StatusSkipped
+			test.Message = strings.TrimSpace(r.Output.ErrorInfo.Message)
+		}
+		if test.Status == junit.StatusFailed || test.Status == junit.StatusError {
+			test.Message = strings.TrimSpace(r.Output.ErrorInfo.Message)
+			if test.Message == "" {
+				test.Message = r.Outcome
+			}
+			test.Error = newFailure(test.Message, r.Outcome, r.Output.ErrorInfo.StackTrace)
+		}
+		suites[i].Tests = append(suites[i].Tests, test)
+	}
+	return suites, nil
+}
+
+var trxDurationPattern = regexp.MustCompile(`^(\d+):(\d+):(\d+(\.\d+)?)$`)
+
+// trxDuration parses durations formatted as hh:mm:ss.fffffff.
+func trxDuration(s string) time.Duration {
+	m := trxDurationPattern.FindStringSubmatch(s)
+	if m == nil {
+		return 0
+	}
+	h, _ := strconv.Atoi(m[1])
+	minutes, _ := strconv.Atoi(m[2])
+	sec, _ := strconv.ParseFloat(m[3], 64)
+	return time.Duration(h)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(sec*float64(time.Second))
+}
+
+// seconds parses durations given in (fractional) seconds.
+func seconds(s string) time.Duration {
+	f, err := strconv.ParseFloat(strings.ReplaceAll(s, ",", ""), 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(f * float64(time.Second))
+}
+
+// detectRoot returns the name of the root element of an XML document.
+func detectRoot(data []byte) string {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return ""
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local
+		}
+	}
+}
+
+// baseName returns the last element of both Windows and Unix paths.
+func baseName(path string) string {
+	return path[strings.LastIndexAny(path, `/\`)+1:]
+}
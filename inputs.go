@@ -0,0 +1,382 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	junit "github.com/joshdk/go-junit"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// stdinInput reads reports from the standard input.
+const stdinInput = "-"
+
+// stdin is read for the dash input.
+var stdin io.Reader = os.Stdin
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zipMagic  = []byte("PK\x03\x04")
+)
+
+// stringList is a flag that can be repeated.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ", ")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// reportFile is a possible report read from disk, stdin or an archive.
+type reportFile struct {
+	name string
+	data []byte
+}
+
+const (
+	// parseLenient skips malformed reports.
+	parseLenient = "lenient"
+	// parseStrict fails on malformed reports, empty files and inputs without reports.
+	parseStrict = "strict"
+)
+
+var parseModes = []string{parseLenient, parseStrict}
+
+// ingestReports reads reports from all inputs, skipping excluded files and files that are not reports.
+func ingestReports(p params) ([]junit.Suite, error) {
+	inputs := p.inputs
+	if len(inputs) == 0 {
+		inputs = []string{p.junitReportsDir}
+	}
+	strict := p.parseMode == parseStrict
+
+	all := make([]junit.Suite, 0)
+	ingested, skipped, malformed := 0, 0, 0
+	for _, input := range inputs {
+		files, err := readInput(input, p.excludes)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not read %s", input)
+		}
+		reports := 0
+		for _, f := range files {
+			var suites []junit.Suite
+			detected := ""
+			if len(bytes.TrimSpace(f.data)) == 0 {
+				// Reports are empty when the test crashed before writing them.
+				err = errors.New("file is empty")
+			} else {
+				suites, detected, err = ingestReport(f.name, f.data, p.reportFormat)
+			}
+			if err != nil {
+				if strict {
+					return nil, errors.Wrapf(err, "could not parse %s", f.name)
+				}
+				log.WithError(err).Warnf("Skipped malformed %s", f.name)
+				malformed++
+				continue
+			}
+			if detected == "" {
+				log.Infof("Skipped %s: not a test report", f.name)
+				skipped++
+				continue
+			}
+			tests := 0
+			for _, s := range suites {
+				tests += s.Totals.Tests
+			}
+			log.Infof("Ingested %s as %s with %d tests", f.name, detected, tests)
+			ingested++
+			reports++
+			all = append(all, suites...)
+		}
+		if strict && reports == 0 {
+			return nil, errors.Errorf("no test reports found in %s", input)
+		}
+	}
+	log.Infof("Ingested %d reports, skipped %d files and %d malformed reports", ingested, skipped, malformed)
+	if p.requireReports && ingested == 0 {
+		return nil, errors.New("no test reports found")
+	}
+	p.redactor.redactSuites(all)
+	if p.redactor.total() > 0 {
+		log.Infof("Redacted %d secrets from reports: %s", p.redactor.total(), p.redactor)
+	}
+	return all, nil
+}
+
+// readInput returns files of an input: a file, a directory, a glob pattern or a dash for stdin.
+// Archives are only extracted when named by the input, not when found in a directory.
+func readInput(input string, excludes []string) ([]reportFile, error) {
+	if input == stdinInput {
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return nil, err
+		}
+		return extract("stdin", data, excludes)
+	}
+
+	paths := []string{input}
+	if hasMeta(input) {
+		var err error
+		paths, err = glob(input)
+		if err != nil {
+			return nil, err
+		}
+		if len(paths) == 0 {
+			log.Warnf("No files match %s", input)
+		}
+	}
+	var files []reportFile
+	for _, p := range paths {
+		f, err := readPath(p, excludes)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f...)
+	}
+	return files, nil
+}
+
+// readPath reads a file or report files found under a directory.
+func readPath(name string, excludes []string) ([]reportFile, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		if excluded(name, excludes) {
+			log.Infof("Excluded %s", name)
+			return nil, nil
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		return extract(name, data, excludes)
+	}
+
+	var files []reportFile
+	err = filepath.Walk(name, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if excluded(name, excludes) {
+			log.Infof("Excluded %s", name)
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if !hasReportExtension(name) {
+			log.Debugf("Skipped %s: not a report file name", name)
+			return nil
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		files = append(files, reportFile{name: name, data: data})
+		return nil
+	})
+	return files, err
+}
+
+// extract returns report files of tar, tar.gz and zip archives, or the file itself when it is not an archive.
+func extract(name string, data []byte, excludes []string) ([]reportFile, error) {
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		content, err := io.ReadAll(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not decompress")
+		}
+		if isTar(content) {
+			return extractTar(name, content, excludes)
+		}
+		return []reportFile{{name: strings.TrimSuffix(name, ".gz"), data: content}}, nil
+	case isTar(data):
+		return extractTar(name, data, excludes)
+	case bytes.HasPrefix(data, zipMagic):
+		return extractZip(name, data, excludes)
+	}
+	return []reportFile{{name: name, data: data}}, nil
+}
+
+// isTar checks the magic of the first tar header.
+func isTar(data []byte) bool {
+	return len(data) > 262 && bytes.HasPrefix(data[257:], []byte("ustar"))
+}
+
+func extractTar(archive string, data []byte, excludes []string) ([]reportFile, error) {
+	var files []reportFile
+	r := tar.NewReader(bytes.NewReader(data))
+	for {
+		header, err := r.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := filepath.Join(archive, header.Name)
+		if !archivedReport(name, excludes) {
+			continue
+		}
+		content, err := io.ReadAll(r)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not read %s", name)
+		}
+		files = append(files, reportFile{name: name, data: content})
+	}
+}
+
+func extractZip(archive string, data []byte, excludes []string) ([]reportFile, error) {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	var files []reportFile
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		name := filepath.Join(archive, f.Name)
+		if !archivedReport(name, excludes) {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not open %s", name)
+		}
+		content, err := io.ReadAll(rc)
+		_ = rc.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not read %s", name)
+		}
+		files = append(files, reportFile{name: name, data: content})
+	}
+	return files, nil
+}
+
+// archivedReport checks if an archived file should be read, the same way files in directories are.
+func archivedReport(name string, excludes []string) bool {
+	if excluded(name, excludes) {
+		log.Infof("Excluded %s", name)
+		return false
+	}
+	if !hasReportExtension(name) {
+		log.Debugf("Skipped %s: not a report file name", name)
+		return false
+	}
+	return true
+}
+
+// excluded checks if a file matches any of the patterns. Patterns without a slash match file names.
+func excluded(name string, patterns []string) bool {
+	name = filepath.ToSlash(filepath.Clean(name))
+	for _, p := range patterns {
+		p = filepath.ToSlash(filepath.Clean(p))
+		if !strings.Contains(p, "/") {
+			if ok, _ := path.Match(p, path.Base(name)); ok {
+				return true
+			}
+			continue
+		}
+		if matchGlob(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[`)
+}
+
+// glob returns files and directories matching the pattern, in which ** matches any number of directories.
+func glob(pattern string) ([]string, error) {
+	pattern = filepath.ToSlash(filepath.Clean(pattern))
+	root := globRoot(pattern)
+	var matches []string
+	err := filepath.Walk(root, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == root || !matchGlob(pattern, filepath.ToSlash(name)) {
+			return nil
+		}
+		matches = append(matches, name)
+		if info.IsDir() {
+			// Matched directories are read as a whole.
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return matches, err
+}
+
+// globRoot returns the directory of the pattern preceding any wildcards.
+func globRoot(pattern string) string {
+	segments := strings.Split(pattern, "/")
+	i := 0
+	for i < len(segments) && !hasMeta(segments[i]) {
+		i++
+	}
+	root := strings.Join(segments[:i], "/")
+	if root == "" {
+		if strings.HasPrefix(pattern, "/") {
+			return "/"
+		}
+		return "."
+	}
+	return filepath.FromSlash(root)
+}
+
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
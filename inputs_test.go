@@ -0,0 +1,164 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const junitReport = `<testsuite name="%s"><testcase name="Test" classname="%s"><failure message="boom"/></testcase></testsuite>`
+
+func report(suite string) []byte {
+	return []byte(strings.ReplaceAll(junitReport, "%s", suite))
+}
+
+// writeFiles creates files in dir and returns its path.
+func writeFiles(t *testing.T, dir string, files map[string][]byte) string {
+	for name, content := range files {
+		name = filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(name), 0o755))
+		require.NoError(t, os.WriteFile(name, content, 0o644))
+	}
+	return dir
+}
+
+func suiteNames(t *testing.T, inputs []string, excludes []string) []string {
+	suites, err := ingestReports(params{inputs: inputs, excludes: excludes})
+	require.NoError(t, err)
+	var names []string
+	for _, s := range suites {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+func TestIngestInputs(t *testing.T) {
+	dir := writeFiles(t, t.TempDir(), map[string][]byte{
+		"unit/junit-unit.xml":        report("unit"),
+		"e2e/results/junit-e2e.xml":  report("e2e"),
+		"e2e/results/junit-skip.xml": report("skip"),
+		"e2e/vendor/junit-dep.xml":   report("dep"),
+		"e2e/pom.xml":                []byte("<project/>"),
+		"e2e/build.log":              []byte("build log"),
+	})
+
+	assert.Equal(t, []string{"e2e", "skip", "dep", "unit"}, suiteNames(t, []string{dir}, nil))
+	assert.Equal(t, []string{"e2e", "unit"}, suiteNames(t, []string{dir + "/**/junit-*.xml"}, []string{"junit-skip.xml", "**/vendor/**"}))
+	assert.Equal(t, []string{"unit", "e2e", "skip"}, suiteNames(t, []string{dir + "/unit", dir + "/e2e/results/*.xml"}, nil))
+	assert.Empty(t, suiteNames(t, []string{dir + "/**/*.json"}, nil))
+
+	_, err := ingestReports(params{inputs: []string{dir + "/missing.xml"}, reportFormat: formatAuto})
+	assert.Error(t, err)
+}
+
+func TestIngestInputsLog(t *testing.T) {
+	dir := writeFiles(t, t.TempDir(), map[string][]byte{
+		"junit.xml": report("unit"),
+		"pom.xml":   []byte("<project/>"),
+	})
+	buf := bytes.NewBufferString("")
+	log.SetOutput(buf)
+	defer log.SetOutput(os.Stderr)
+
+	_, err := ingestReports(params{inputs: []string{dir}, reportFormat: formatAuto})
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "Ingested "+filepath.Join(dir, "junit.xml")+" as junit with 1 tests")
+	assert.Contains(t, buf.String(), "Skipped "+filepath.Join(dir, "pom.xml")+": not a test report")
+	assert.Contains(t, buf.String(), "Ingested 1 reports, skipped 1 files")
+}
+
+func TestIngestStdinAndArchives(t *testing.T) {
+	tarGz := bytes.NewBuffer(nil)
+	gz := gzip.NewWriter(tarGz)
+	tw := tar.NewWriter(gz)
+	for name, content := range map[string][]byte{"reports/junit.xml": report("tar"), "reports/output.log": []byte("log")} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write(content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+
+	zipped := bytes.NewBuffer(nil)
+	zw := zip.NewWriter(zipped)
+	for name, content := range map[string][]byte{"junit.xml": report("zip"), "flaky/junit.xml": report("flaky")} {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write(content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+
+	gzipped := bytes.NewBuffer(nil)
+	gz = gzip.NewWriter(gzipped)
+	_, err := gz.Write(report("gz"))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+
+	dir := writeFiles(t, t.TempDir(), map[string][]byte{
+		"bundle.tar.gz": tarGz.Bytes(),
+		"bundle.zip":    zipped.Bytes(),
+		"junit.xml.gz":  gzipped.Bytes(),
+	})
+	assert.Equal(t, []string{"tar", "zip"}, suiteNames(t, []string{dir + "/bundle.tar.gz", dir + "/bundle.zip"}, []string{"**/flaky/*"}))
+	assert.Equal(t, []string{"gz"}, suiteNames(t, []string{dir + "/junit.xml.gz"}, nil))
+	// Archives found in directories are not extracted.
+	assert.Empty(t, suiteNames(t, []string{dir}, nil))
+
+	stdin = bytes.NewReader(tarGz.Bytes())
+	defer func() { stdin = os.Stdin }()
+	assert.Equal(t, []string{"tar"}, suiteNames(t, []string{"-"}, nil))
+}
+
+func TestMatchGlob(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, name string
+		expected      bool
+	}{
+		{"**/junit-*.xml", "junit-unit.xml", true},
+		{"**/junit-*.xml", "a/b/junit-unit.xml", true},
+		{"**/junit-*.xml", "a/b/report.xml", false},
+		{"a/**/b/*.xml", "a/b/x.xml", true},
+		{"a/**/b/*.xml", "a/x/y/b/x.xml", true},
+		{"a/*.xml", "a/b/x.xml", false},
+		{"**/vendor/**", "a/vendor", true},
+		{"**/vendor/**", "a/vendor/b/x.xml", true},
+	} {
+		assert.Equal(t, tc.expected, matchGlob(tc.pattern, tc.name), tc)
+	}
+	assert.Equal(t, ".", globRoot("**/junit-*.xml"))
+	assert.Equal(t, "/artifacts/e2e", globRoot("/artifacts/e2e/**/*.xml"))
+}
+
+func TestParseModes(t *testing.T) {
+	dir := writeFiles(t, t.TempDir(), map[string][]byte{
+		"junit.xml":     report("unit"),
+		"empty.xml":     nil,
+		"malformed.xml": []byte(`<testsuite name="broken"><testcase></testsuite>`),
+	})
+	empty := t.TempDir()
+
+	suites, err := ingestReports(params{inputs: []string{dir, empty}, parseMode: parseLenient})
+	require.NoError(t, err)
+	assert.Len(t, suites, 1)
+
+	_, err = ingestReports(params{inputs: []string{dir}, parseMode: parseStrict})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "empty.xml: file is empty")
+
+	_, err = ingestReports(params{inputs: []string{dir + "/junit.xml", empty}, parseMode: parseStrict})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no test reports found in "+empty)
+
+	_, err = ingestReports(params{inputs: []string{empty}, requireReports: true})
+	assert.EqualError(t, err, "no test reports found")
+}
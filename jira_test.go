@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/janisz/junit2jira/fakejira"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFakeJira(t *testing.T) (*fakejira.Server, *url.URL) {
+	s := fakejira.New()
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	u, err := url.Parse(server.URL + "/")
+	require.NoError(t, err)
+	return s, u
+}
+
+func TestRunAgainstFakeJira(t *testing.T) {
+	s, u := newFakeJira(t)
+	existing, err := testCase{
+		Suite: "github.com/stackrox/rox/sensor/kubernetes/localscanner",
+		Name:  "TestLocalScannerTLSIssuerIntegrationTests",
+	}.summary()
+	require.NoError(t, err)
+	existingKey := s.AddIssue(fakejira.Issue{Project: "ROX", Type: "Bug", Summary: existing, Labels: []string{"CI_Failure"}})
+
+	summaryFile := filepath.Join(t.TempDir(), "summary.json")
+	p := params{
+		jiraUrl:         u,
+		jiraProject:     "ROX",
+		junitReportsDir: "testdata/jira/report.xml",
+		BuildId:         "1",
+		threshold:       10,
+		linkStrategy:    linkMesh,
+		linkType:        "Related",
+		summaryOutput:   summaryFile,
+	}
+	require.NoError(t, run(p))
+
+	issues := s.Issues()
+	require.Len(t, issues, 2)
+	assert.Len(t, issues[0].Comments, 1)
+	assert.Equal(t, "Bug", issues[1].Type)
+	assert.Equal(t, []string{"CI_Failure"}, issues[1].Labels)
+	require.Len(t, issues[1].Links, 1)
+	assert.Equal(t, existingKey, issues[1].Links[0].Outward)
+	summary, err := os.ReadFile(summaryFile)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"newJIRAs":1,"failedTests":2,"outcomes":{"created":1,"commented":1}}`, string(summary))
+
+	// Reporting the same build again must not change anything.
+	require.NoError(t, run(p))
+	issues = s.Issues()
+	require.Len(t, issues, 2)
+	assert.Len(t, issues[0].Comments, 1)
+	assert.Len(t, issues[1].Links, 1)
+	summary, err = os.ReadFile(summaryFile)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"newJIRAs":0,"failedTests":2,"outcomes":{"already-recorded":2}}`, string(summary))
+
+	// Another build is commented on both issues.
+	p.BuildId = "2"
+	require.NoError(t, run(p))
+	issues = s.Issues()
+	require.Len(t, issues, 2)
+	assert.Len(t, issues[0].Comments, 2)
+	assert.Len(t, issues[1].Comments, 1)
+}
+
+func TestRunUmbrellaAgainstFakeJira(t *testing.T) {
+	s, u := newFakeJira(t)
+	p := params{
+		jiraUrl:         u,
+		jiraProject:     "ROX",
+		junitReportsDir: "testdata/jira/report.xml",
+		JobName:         "job",
+		BuildId:         "1",
+		threshold:       1,
+		mergeStrategy:   mergeUmbrella,
+		linkStrategy:    linkNone,
+		linkType:        "Related",
+	}
+	require.NoError(t, run(p))
+
+	issues := s.Issues()
+	require.Len(t, issues, 3)
+	assert.Equal(t, "Bug", issues[0].Type)
+	for _, i := range issues[1:] {
+		assert.Equal(t, "Sub-task", i.Type)
+		assert.Equal(t, issues[0].Key, i.Parent)
+	}
+}
+
+func TestLogError(t *testing.T) {
+	_, u := newFakeJira(t)
+	client, err := jira.NewClient(nil, u.String())
+	require.NoError(t, err)
+	_, response, err := client.Issue.Get("ROX-404", nil)
+	require.Error(t, err)
+
+	buf := bytes.NewBufferString("")
+	log.SetOutput(buf)
+	defer log.SetOutput(os.Stderr)
+
+	logError(err, response)
+	assert.Contains(t, buf.String(), "StatusCode=404")
+	assert.Contains(t, buf.String(), "Issue does not exist")
+
+	buf.Reset()
+	logError(err, nil)
+	assert.Contains(t, buf.String(), "No response")
+}
+
+func TestRunFailOn(t *testing.T) {
+	_, u := newFakeJira(t)
+	summaryFile := filepath.Join(t.TempDir(), "summary.json")
+	p := params{
+		jiraUrl:         u,
+		jiraProject:     "ROX",
+		junitReportsDir: "testdata/jira/report.xml",
+		BuildId:         "1",
+		threshold:       10,
+		linkStrategy:    linkMesh,
+		linkType:        "Unknown",
+		summaryOutput:   summaryFile,
+		failOn:          failOnNewIssues,
+	}
+	// Planned issues are not created, so they pass the new-issues policy.
+	p.dryRun = true
+	require.NoError(t, run(p))
+	summary, err := os.ReadFile(summaryFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(summary), `"newJIRAs":0`)
+	assert.Contains(t, string(summary), `"outcomes":{"planned":2}`)
+	p.dryRun = false
+
+	// Failed links do not mask new issues, and outputs are still written.
+	err = run(p)
+	assert.Equal(t, exitNewIssues, exitCode(err))
+	assert.EqualError(t, err, "2 new issues created (-fail-on=new-issues)")
+	assert.FileExists(t, summaryFile)
+
+	// Comments on existing issues pass the new-issues policy, failed links are reported on their own.
+	p.BuildId = "2"
+	err = run(p)
+	assert.Equal(t, exitJiraErrors, exitCode(err))
+	assert.ErrorContains(t, err, "could not link issues")
+
+	p.linkType = "Related"
+	p.BuildId = "3"
+	require.NoError(t, run(p))
+
+	p.failOn = failOnAnyFailure
+	err = run(p)
+	assert.Equal(t, exitTestsFailed, exitCode(err))
+	assert.EqualError(t, err, "2 tests failed (-fail-on=any-failure)")
+
+	p.junitReportsDir = "testdata/jira/missing.xml"
+	p.parseMode = parseStrict
+	assert.Equal(t, exitInputError, exitCode(run(p)))
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/hashicorp/go-multierror"
+	junit "github.com/joshdk/go-junit"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// linkNone does not link issues found in a run.
+	linkNone = "none"
+	// linkMesh links every pair of issues found in a run.
+	linkMesh = "mesh"
+	// linkStar links every issue found in a run to the CI run issue.
+	linkStar = "star"
+	// linkParent attaches every issue found in a run to the CI run issue as a sub-task or an epic child.
+	linkParent = "parent"
+
+	runIssueLabel = "CI_Run"
+	epicIssueType = "Epic"
+
+	runJql = `project in (%s)
+AND labels = ` + runIssueLabel + `
+AND summary ~ %q
+ORDER BY created DESC`
+
+	runDesc = `
+CI run with failed tests.
+
+||    ENV     ||      Value           ||
+| BUILD ID     | [{{- .BuildId -}}|{{- .BuildLink -}}]|
+| BUILD TAG    | [{{- .BuildTag -}}|{{- .BaseLink -}}]|
+| JOB NAME     | {{- .JobName -}}      |
+| ORCHESTRATOR | {{- .Orchestrator -}} |
+`
+	runSummaryTpl = `{{ (print "CI run " .JobName " " .BuildId) | truncateSummary }}`
+)
+
+var linkStrategies = []string{linkNone, linkMesh, linkStar, linkParent}
+
+func validLinkStrategy(s string) bool {
+	for _, l := range linkStrategies {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// needsRunIssue tells if the link strategy requires a CI run issue.
+func (j junit2jira) needsRunIssue() bool {
+	return j.linkStrategy == linkStar || j.linkStrategy == linkParent
+}
+
+// subTaskParent returns a key of the issue new failures should be created as sub-tasks of.
+func (j junit2jira) subTaskParent(runIssue *jira.Issue) string {
+	if runIssue == nil || j.linkStrategy != linkParent || j.runIssueType == epicIssueType {
+		return ""
+	}
+	return runIssue.Key
+}
+
+// findOrCreateRunIssue returns the CI run issue for the current build, creating it when it does not exist yet.
+func (j junit2jira) findOrCreateRunIssue() (*jira.Issue, error) {
+	if j.BuildId == "" {
+		return nil, fmt.Errorf("build ID is required to create a CI run issue")
+	}
+	tc := NewTestCase(junit.Test{}, j.params)
+	summary, err := render(tc, runSummaryTpl)
+	if err != nil {
+		return nil, fmt.Errorf("could not get CI run summary: %w", err)
+	}
+	summary = clearString(summary)
+	description, err := render(tc, runDesc)
+	if err != nil {
+		return nil, fmt.Errorf("could not get CI run description: %w", err)
+	}
+
+	search, response, err := j.jiraClient.Issue.Search(fmt.Sprintf(runJql, j.jiraProject, summary), &jira.SearchOptions{
+		Fields: []string{"summary", "issuelinks"},
+	})
+	if err != nil {
+		logError(err, response)
+		return nil, fmt.Errorf("could not search for CI run issue: %w", err)
+	}
+	if issue := findMatchingIssue(search, summary); issue != nil {
+		logEntry(issue.Key, summary).Info("Found CI run issue")
+		return issue, nil
+	}
+
+	issue := newIssue(j.jiraProject, summary, description)
+	issue.Fields.Type = jira.IssueType{Name: j.runIssueType}
+	issue.Fields.Labels = []string{runIssueLabel}
+	err = j.createIssue(issue)
+	if err != nil {
+		return nil, fmt.Errorf("could not create CI run issue: %w", err)
+	}
+	logEntry(issue.Key, summary).Info("Created CI run issue")
+	return issue, nil
+}
+
+func (j junit2jira) linkIssues(issues []*jira.Issue, runIssue *jira.Issue) error {
+	switch j.linkStrategy {
+	case linkNone:
+		return nil
+	case linkStar:
+		return j.linkToRunIssue(issues, runIssue)
+	case linkParent:
+		if j.runIssueType == epicIssueType {
+			return j.addToEpic(issues, runIssue)
+		}
+		// New issues are created as sub-tasks and existing ones are linked while commenting.
+		return nil
+	}
+	return j.linkMesh(issues)
+}
+
+func (j junit2jira) linkMesh(issues []*jira.Issue) error {
+	var result error
+	for x, issue := range issues {
+		for y := 0; y < x; y++ {
+			err := j.addLink(issue, issues[y])
+			if err != nil {
+				result = multierror.Append(result, err)
+			}
+		}
+	}
+	return result
+}
+
+func (j junit2jira) linkToRunIssue(issues []*jira.Issue, runIssue *jira.Issue) error {
+	if runIssue == nil {
+		return nil
+	}
+	var result error
+	for _, issue := range issues {
+		err := j.addLink(runIssue, issue)
+		if err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+	return result
+}
+
+// addLink links the issues unless one of them is already linked to the other.
+func (j junit2jira) addLink(outward, inward *jira.Issue) error {
+	if outward.Key == inward.Key {
+		return nil
+	}
+	if isLinked(outward, inward.Key, j.linkType) || isLinked(inward, outward.Key, j.linkType) {
+		log.WithField("ID", outward.Key).Debugf("Link to %s is already recorded", inward.Key)
+		return nil
+	}
+	err := j.createLink(outward.Key, inward.Key)
+	if err != nil {
+		return err
+	}
+	if outward.Fields != nil {
+		// Remember the link, so the same pair is not linked twice in a single run.
+		outward.Fields.IssueLinks = append(outward.Fields.IssueLinks, &jira.IssueLink{
+			Type:        jira.IssueLinkType{Name: j.linkType},
+			InwardIssue: &jira.Issue{Key: inward.Key},
+		})
+	}
+	return nil
+}
+
+func (j junit2jira) addToEpic(issues []*jira.Issue, epic *jira.Issue) error {
+	if epic == nil {
+		return nil
+	}
+	var value any = epic.Key
+	// Jira Cloud uses the parent field for epic children, Jira Server uses the "Epic Link" custom field.
+	if j.epicLinkField == "parent" {
+		value = map[string]string{"key": epic.Key}
+	}
+	var result error
+	for _, issue := range issues {
+		err := j.updateIssue(issue.Key, map[string]any{j.epicLinkField: value})
+		if err != nil {
+			result = multierror.Append(result, fmt.Errorf("could not add %s to epic %s: %w", issue.Key, epic.Key, err))
+			continue
+		}
+		log.WithField("ID", issue.Key).Debugf("Added to epic %s", epic.Key)
+	}
+	return result
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinkIssues(t *testing.T) {
+	issues := []*jira.Issue{{Key: "ROX-1"}, {Key: "ROX-2"}, {Key: "ROX-3"}}
+	runIssue := &jira.Issue{Key: "ROX-100"}
+
+	for name, tc := range map[string]struct {
+		strategy string
+		runType  string
+		expected [][2]string
+		updated  []string
+	}{
+		"none": {strategy: linkNone},
+		"mesh": {strategy: linkMesh, expected: [][2]string{
+			{"ROX-2", "ROX-1"}, {"ROX-3", "ROX-1"}, {"ROX-3", "ROX-2"},
+		}},
+		"star": {strategy: linkStar, expected: [][2]string{
+			{"ROX-100", "ROX-1"}, {"ROX-100", "ROX-2"}, {"ROX-100", "ROX-3"},
+		}},
+		"parent": {strategy: linkParent, runType: "Task"},
+		"parent epic": {strategy: linkParent, runType: epicIssueType, updated: []string{
+			"/rest/api/2/issue/ROX-1", "/rest/api/2/issue/ROX-2", "/rest/api/2/issue/ROX-3",
+		}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var links [][2]string
+			var updated []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == http.MethodPost && r.URL.Path == "/rest/api/2/issueLink":
+					link := jira.IssueLink{}
+					require.NoError(t, json.NewDecoder(r.Body).Decode(&link))
+					assert.Equal(t, "Blocks", link.Type.Name)
+					links = append(links, [2]string{link.OutwardIssue.Key, link.InwardIssue.Key})
+				case r.Method == http.MethodPut:
+					body := map[string]map[string]map[string]string{}
+					require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+					assert.Equal(t, "ROX-100", body["fields"]["parent"]["key"])
+					updated = append(updated, r.URL.Path)
+				default:
+					t.Errorf("unexpected request %s %s", r.Method, r.URL)
+				}
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer server.Close()
+
+			client, err := jira.NewClient(nil, server.URL)
+			require.NoError(t, err)
+			j := junit2jira{
+				params: params{
+					linkStrategy:  tc.strategy,
+					linkType:      "Blocks",
+					runIssueType:  tc.runType,
+					epicLinkField: "parent",
+				},
+				jiraClient: client,
+			}
+			require.NoError(t, j.linkIssues(issues, runIssue))
+			assert.Equal(t, tc.expected, links)
+			assert.Equal(t, tc.updated, updated)
+		})
+	}
+}
+
+func TestSubTaskParent(t *testing.T) {
+	runIssue := &jira.Issue{Key: "ROX-100"}
+	assert.Equal(t, "ROX-100", junit2jira{params: params{linkStrategy: linkParent, runIssueType: "Task"}}.subTaskParent(runIssue))
+	assert.Empty(t, junit2jira{params: params{linkStrategy: linkParent, runIssueType: epicIssueType}}.subTaskParent(runIssue))
+	assert.Empty(t, junit2jira{params: params{linkStrategy: linkStar, runIssueType: "Task"}}.subTaskParent(runIssue))
+	assert.Empty(t, junit2jira{params: params{linkStrategy: linkParent, runIssueType: "Task"}}.subTaskParent(nil))
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"bytes"
 	_ "embed"
-	"encoding/csv"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -12,13 +11,14 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"regexp"
 	"strings"
 	"time"
 	"unicode"
 
 	"github.com/andygrunwald/go-jira"
-	"github.com/carlmjohnson/versioninfo"
 	"github.com/hashicorp/go-multierror"
+	"github.com/janisz/junit2jira/fakejira"
 	junit "github.com/joshdk/go-junit"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -27,95 +27,338 @@ import (
 
 const (
 	jql = `project in (%s)
-AND issuetype = Bug
+AND issuetype in (%s)
 AND status != Closed
-AND labels = CI_Failure
+AND labels = %s
 AND summary ~ %q
 ORDER BY created DESC`
 	// Slack has a 150-character limit for text header
 	slackHeaderTextLengthLimit = 150
 	// Slack has a 3000-character limit for (non-field) text objects
 	slackTextLengthLimit = 3000
+	// slackSlowTestsLimit keeps the slow tests short, a message has at most 50 blocks and failed tests come first
+	slackSlowTestsLimit = 10
+	// failureLabel marks issues of failed tests.
+	failureLabel = "CI_Failure"
 )
 
 func main() {
-	var debug bool
-	p := params{}
-	var jiraUrl string
-	flag.StringVar(&p.slackOutput, "slack-output", "", "Generate JSON output in slack format (use dash [-] for stdout)")
-	flag.StringVar(&p.htmlOutput, "html-output", "", "Generate HTML report to this file (use dash [-] for stdout)")
-	flag.StringVar(&p.csvOutput, "csv-output", "", "Convert XML to a CSV file (use dash [-] for stdout)")
-	flag.StringVar(&p.summaryOutput, "summary-output", "", "Write a summary in JSON to this file (use dash [-] for stdout)")
-	flag.StringVar(&jiraUrl, "jira-url", "https://issues.redhat.com/", "Url of JIRA instance")
-	flag.StringVar(&p.jiraProject, "jira-project", "ROX", "The JIRA project for issues")
-	flag.StringVar(&p.junitReportsDir, "junit-reports-dir", os.Getenv("ARTIFACT_DIR"), "Dir that contains jUnit reports XML files")
-	flag.BoolVar(&p.dryRun, "dry-run", false, "When set to true issues will NOT be created.")
-	flag.IntVar(&p.threshold, "threshold", 10, "Number of reported failures that should cause single issue creation.")
-	flag.StringVar(&p.timestamp, "timestamp", time.Now().Format(time.RFC3339), "Timestamp of CI test.")
-	flag.StringVar(&p.BaseLink, "base-link", "", "Link to source code at the exact version under test.")
-	flag.StringVar(&p.BuildId, "build-id", "", "Build job run ID.")
-	flag.StringVar(&p.BuildLink, "build-link", "", "Link to build job.")
-	flag.StringVar(&p.BuildTag, "build-tag", "", "Built tag or revision.")
-	flag.StringVar(&p.JobName, "job-name", "", "Name of CI job.")
-	flag.StringVar(&p.Orchestrator, "orchestrator", "", "Orchestrator name (such as GKE or OpenShift), if any.")
-	flag.BoolVar(&debug, "debug", false, "Enable debug log level")
-	versioninfo.AddFlag(flag.CommandLine)
-	flag.Parse()
+	name, args := "report", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		usage(os.Stdout)
+		return
+	}
+
+	var names []string
+	for _, c := range commands() {
+		if c.name == name {
+			if err := c.run(os.Args[0]+" "+c.name, args); err != nil {
+				exitWithError(err)
+			}
+			return
+		}
+		names = append(names, c.name)
+	}
+	usage(os.Stderr)
+	inputFatalf("unknown command %q, use one of: %s", name, strings.Join(names, ", "))
+}
+
+// fakeJiraCommand serves an in-memory Jira for local demos.
+func fakeJiraCommand(name string, args []string) error {
+	fs := newFlagSet(name, "Serve an in-memory Jira for tests and local demos.")
+	listen := fs.String("listen", "localhost:8080", "Address to listen on")
+	_ = fs.Parse(args)
+
+	log.Infof("Fake Jira listening on http://%s/ (use it as -jira-url)", *listen)
+	server := fakejira.New()
+	return http.ListenAndServe(*listen, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.WithField("method", r.Method).WithField("url", r.URL.String()).Info("Request")
+		server.ServeHTTP(w, r)
+	}))
+}
+
+type runFlags struct {
+	jiraUrl        string
+	skippedPattern string
+	csvColumns     string
+	escalations    []string
+	routing        string
+	logFormat      string
+	redactPatterns []string
+	redactBuiltin  bool
+	excerpt        string
+	excerptMarkers []string
+	excerptBefore  int
+	excerptAfter   int
+	excerptTail    int
+	debug          bool
+}
+
+// addRunFlags registers flags of commands that report failed tests to Jira.
+func addRunFlags(fs *flag.FlagSet, p *params) *runFlags {
+	f := addInputFlags(fs, p)
+	addOutputFlags(fs, p, f)
+	addJiraFlags(fs, p, f)
+	addDurationFlags(fs, p)
+	fs.BoolVar(&p.slowTestIssues, "slow-test-issues", false, "Create or comment on Jira issues of slow tests.")
+	fs.StringVar(&p.slowTestLabel, "slow-test-label", "CI_Slow_Test", "Label of slow test issues.")
+	addBuildFlags(fs, p)
+	return f
+}
+
+// addInputFlags registers flags selecting and parsing reports.
+func addInputFlags(fs *flag.FlagSet, p *params) *runFlags {
+	f := &runFlags{}
+	fs.StringVar(&p.junitReportsDir, "junit-reports-dir", os.Getenv("ARTIFACT_DIR"), "Dir that contains jUnit reports XML files (used when no -input is given)")
+	fs.Var((*stringList)(&p.inputs), "input", "Report file, directory, glob pattern (** matches any directories), tar.gz or zip bundle, or dash [-] for stdin. Can be repeated.")
+	fs.Var((*stringList)(&p.excludes), "exclude", "Glob pattern of report files to skip, patterns without a slash match file names. Can be repeated.")
+	fs.StringVar(&p.reportFormat, "report-format", formatAuto, "Format of the reports: "+strings.Join(reportFormats, ", "))
+	fs.StringVar(&p.parseMode, "parse-mode", parseLenient, "How to handle malformed reports: "+parseLenient+" skips them, "+parseStrict+" fails on them, on empty files and on inputs without reports.")
+	fs.BoolVar(&p.requireReports, "require-reports", false, "Fail when no test reports are found.")
+	fs.StringVar(&f.skippedPattern, "skipped-pattern", "", "Report skipped tests whose skip reason matches this regular expression.")
+	fs.BoolVar(&f.redactBuiltin, "redact-builtin", true, "Redact JWTs, AWS keys, bearer tokens, private keys and passwords in URLs from test output.")
+	fs.Var((*stringList)(&f.redactPatterns), "redact", "Regular expression of secrets to redact from test output, only the first group is redacted when it has groups. Can be repeated.")
+	addLogFlags(fs, f)
+	return f
+}
+
+// addLogFlags registers flags of the log level and format.
+func addLogFlags(fs *flag.FlagSet, f *runFlags) {
+	fs.BoolVar(&f.debug, "debug", false, "Enable debug log level")
+	fs.StringVar(&f.logFormat, "log-format", logFormatText, "Format of logs: "+strings.Join(logFormats, ", "))
+}
+
+// addOutputFlags registers flags of files written by the report command.
+func addOutputFlags(fs *flag.FlagSet, p *params, f *runFlags) {
+	fs.StringVar(&p.slackOutput, "slack-output", "", "Generate JSON output in slack format (use dash [-] for stdout)")
+	fs.StringVar(&p.htmlOutput, "html-output", "", "Generate HTML report to this file (use dash [-] for stdout)")
+	fs.StringVar(&p.csvOutput, "csv-output", "", "Convert XML to a CSV file (use dash [-] for stdout)")
+	fs.StringVar(&f.csvColumns, "csv-columns", strings.Join(defaultColumns, ","), "Comma separated columns of the CSV, NDJSON and Parquet outputs, any of: "+strings.Join(columnNames, ", "))
+	fs.StringVar(&p.ndjsonOutput, "ndjson-output", "", "Write tests as newline delimited JSON to this file (use dash [-] for stdout)")
+	fs.StringVar(&p.parquetOutput, "parquet-output", "", "Write tests as a Parquet file to this file (use dash [-] for stdout)")
+	fs.StringVar(&p.metricsOutput, "metrics-output", "", "Write test metrics in the OpenMetrics format to this file (use dash [-] for stdout)")
+	fs.StringVar(&p.pushgatewayUrl, "pushgateway-url", "", "Push test metrics to this Prometheus Pushgateway, grouped by job name")
+	fs.StringVar(&p.tracesOutput, "traces-output", "", "Write suites and tests as OpenTelemetry spans in the OTLP JSON format to this file (use dash [-] for stdout)")
+	fs.StringVar(&p.otlpEndpoint, "otlp-endpoint", "", "Send suites and tests as OpenTelemetry spans to this OTLP/HTTP endpoint, e.g. http://collector:4318")
+	fs.StringVar(&p.traceParent, "trace-parent", os.Getenv("TRACEPARENT"), "W3C traceparent of the CI trace the spans are added to.")
+	fs.StringVar(&p.summaryOutput, "summary-output", "", "Write a summary in JSON to this file (use dash [-] for stdout)")
+}
+
+// addJiraFlags registers flags of how failures are reported to Jira.
+func addJiraFlags(fs *flag.FlagSet, p *params, f *runFlags) {
+	addJiraSearchFlags(fs, p, f)
+	fs.BoolVar(&p.dryRun, "dry-run", false, "When set to true issues will NOT be created.")
+	fs.StringVar(&p.linkStrategy, "link-strategy", linkMesh, "How to link issues found in a single run: "+strings.Join(linkStrategies, ", "))
+	fs.StringVar(&p.linkType, "link-type", "Related", "Name of the issue link type used to link issues.")
+	fs.StringVar(&p.runIssueType, "run-issue-type", "Task", "Issue type of the CI run issue created for star and parent link strategies (use Epic to attach failures as epic children).")
+	fs.StringVar(&p.epicLinkField, "epic-link-field", "parent", "Field used to add issues to an epic (custom field ID of Epic Link on Jira Server).")
+	fs.Var((*stringList)(&f.escalations), "escalate", "Escalation rule <count>:<action>=<value> applied when a failure is recorded count times within -escalation-window, actions: "+strings.Join(escalationActions, ", ")+". Can be repeated.")
+	fs.DurationVar(&p.escalationWindow, "escalation-window", 7*24*time.Hour, "Rolling window failures are counted in for -escalate rules.")
+	fs.StringVar(&p.occurrences, "occurrences", occurrencesComments, "Where failures of existing issues are recorded: "+occurrencesComments+" adds a comment per failure, "+occurrencesDescription+" and "+occurrencesPinnedComment+" keep a table of occurrences in the issue description or in a single comment")
+	fs.IntVar(&p.keepOutputs, "keep-outputs", 5, "Number of latest failure outputs kept below the table of occurrences.")
+	fs.StringVar(&f.excerpt, "excerpt", excerptGeneric, "Test framework preset of failure markers in logs too long for descriptions, the lines around the first marker and the tail are kept: "+strings.Join(excerptPresets[1:], ", ")+", or "+excerptNone+" to keep the beginning")
+	fs.Var((*stringList)(&f.excerptMarkers), "excerpt-marker", "Regular expression of log lines marking failures, in addition to the -excerpt preset. Can be repeated.")
+	fs.IntVar(&f.excerptBefore, "excerpt-before", 10, "Number of log lines kept before the first failure marker.")
+	fs.IntVar(&f.excerptAfter, "excerpt-after", 40, "Number of log lines kept after the first failure marker.")
+	fs.IntVar(&f.excerptTail, "excerpt-tail", 50, "Number of last log lines kept.")
+	fs.StringVar(&p.auditLog, "audit-log", "", "Append every change made to Jira as a JSON line to this file.")
+	fs.BoolVar(&p.preflight, "preflight", false, "Validate projects, issue types, required fields, the link type and escalation priorities in Jira before reporting, like the check command.")
+	fs.StringVar(&p.failOn, "fail-on", failOnNever, "When to exit with a non-zero code after reporting: "+strings.Join(failOnPolicies, ", ")+" (see the README for exit codes)")
+}
+
+// addJiraSearchFlags registers flags of how failures are grouped and searched in Jira.
+func addJiraSearchFlags(fs *flag.FlagSet, p *params, f *runFlags) {
+	addJiraProjectFlags(fs, p, f)
+	fs.IntVar(&p.threshold, "threshold", 10, "Number of reported failures that should cause single issue creation.")
+	fs.StringVar(&p.mergeStrategy, "merge-strategy", mergeSingle, "How to report failures above the threshold: "+strings.Join(mergeStrategies, ", "))
+	fs.IntVar(&p.suiteThreshold, "suite-threshold", 3, "Number of failures in a single suite that should cause single issue creation for it (with -merge-strategy=suite).")
+}
+
+// addJiraProjectFlags registers flags of the Jira instance and project.
+func addJiraProjectFlags(fs *flag.FlagSet, p *params, f *runFlags) {
+	fs.StringVar(&f.jiraUrl, "jira-url", "https://issues.redhat.com/", "Url of JIRA instance")
+	fs.StringVar(&p.jiraProject, "jira-project", "ROX", "The JIRA project for issues")
+	fs.StringVar(&f.routing, "routing", "", "CSV file with suite, classname, job name and orchestrator patterns, project and optional issue type on each line (* matches any text). Issues are searched in all projects.")
+}
+
+// addDurationFlags registers flags of slow test detection.
+func addDurationFlags(fs *flag.FlagSet, p *params) {
+	fs.Var((*stringList)(&p.durationBaselines), "duration-baseline", "CSV file written by -csv-output in a previous run to compare durations with (glob patterns match a history of runs, the median is used). Can be repeated.")
+	fs.StringVar(&p.durationThresholds, "duration-thresholds", "", "CSV file with suite pattern, test pattern and duration limit on each line (* matches any text).")
+	fs.DurationVar(&p.slowTestLimit, "slow-test-limit", 0, "Report tests that take longer than this duration as slow.")
+	fs.Float64Var(&p.slowTestRegression, "slow-test-regression", 0, "Report tests that take this many percent longer than their baseline as slow.")
+	fs.DurationVar(&p.slowTestMinDuration, "slow-test-min-duration", time.Second, "Ignore regressions of tests shorter than this duration.")
+}
+
+// addBuildFlags registers flags describing the CI build.
+func addBuildFlags(fs *flag.FlagSet, p *params) {
+	fs.StringVar(&p.timestamp, "timestamp", time.Now().Format(time.RFC3339), "Timestamp of CI test.")
+	fs.StringVar(&p.BaseLink, "base-link", "", "Link to source code at the exact version under test, file:line references in failures are linked to it.")
+	fs.Var((*stringList)(&p.sourceRoots), "source-root", "Path prefix of the repository in stack traces, e.g. /go/src/github.com/stackrox/rox (defaults to the working directory). Can be repeated.")
+	fs.Var((*stringList)(&p.javaSourceDirs), "java-source-dir", "Directory of Java and Groovy sources relative to the repository root, e.g. qa-tests-backend/src/test/groovy. Can be repeated.")
+	fs.StringVar(&p.goModule, "go-module", "", "Go module path of the repository, Go file names without a directory in failures of its packages are linked in the package directory (defaults to the module of go.mod in the working directory).")
+	fs.StringVar(&p.BuildId, "build-id", "", "Build job run ID.")
+	fs.StringVar(&p.BuildLink, "build-link", "", "Link to build job.")
+	fs.StringVar(&p.BuildTag, "build-tag", "", "Built tag or revision.")
+	fs.StringVar(&p.JobName, "job-name", "", "Name of CI job.")
+	fs.StringVar(&p.Orchestrator, "orchestrator", "", "Orchestrator name (such as GKE or OpenShift), if any.")
+}
+
+// apply validates parsed flags and sets the values that need conversion.
+func (f *runFlags) apply(p *params) {
+	// Flags that a command does not register are empty.
+	if p.mergeStrategy != "" && !validMergeStrategy(p.mergeStrategy) {
+		inputFatalf("unknown merge strategy %q, use one of: %s", p.mergeStrategy, strings.Join(mergeStrategies, ", "))
+	}
+
+	if p.reportFormat != "" && !validReportFormat(p.reportFormat) {
+		inputFatalf("unknown report format %q, use one of: %s", p.reportFormat, strings.Join(reportFormats, ", "))
+	}
+
+	if p.parseMode != "" && p.parseMode != parseLenient && p.parseMode != parseStrict {
+		inputFatalf("unknown parse mode %q, use one of: %s", p.parseMode, strings.Join(parseModes, ", "))
+	}
+
+	if p.linkStrategy != "" && !validLinkStrategy(p.linkStrategy) {
+		inputFatalf("unknown link strategy %q, use one of: %s", p.linkStrategy, strings.Join(linkStrategies, ", "))
+	}
+
+	if p.occurrences != "" && !validOccurrences(p.occurrences) {
+		inputFatalf("unknown occurrences mode %q, use one of: %s", p.occurrences, strings.Join(occurrenceModes, ", "))
+	}
+
+	if p.failOn != "" && !validFailOn(p.failOn) {
+		inputFatalf("unknown fail-on policy %q, use one of: %s", p.failOn, strings.Join(failOnPolicies, ", "))
+	}
+
+	if p.planFormat != "" && p.planFormat != planFormatJson && p.planFormat != planFormatText {
+		inputFatalf("unknown plan format %q, use one of: %s, %s", p.planFormat, planFormatJson, planFormatText)
+	}
 
 	var err error
+	if f.csvColumns != "" {
+		p.csvColumns, err = parseColumns(f.csvColumns)
+		if err != nil {
+			inputFatalf("%s", err)
+		}
+	}
 
-	p.jiraUrl, err = url.Parse(jiraUrl)
+	if f.routing != "" {
+		p.routes, err = loadRoutes(f.routing)
+		if err != nil {
+			inputFatalf("could not read routing %s: %s", f.routing, err)
+		}
+	}
+
+	for _, rule := range f.escalations {
+		r, err := parseEscalationRule(rule)
+		if err != nil {
+			inputFatalf("%s", err)
+		}
+		p.escalations = append(p.escalations, r)
+	}
+
+	if f.excerpt != "" {
+		p.excerpt, err = newExcerptConfig(f.excerpt, f.excerptMarkers, f.excerptBefore, f.excerptAfter, f.excerptTail)
+		if err != nil {
+			inputFatalf("%s", err)
+		}
+	}
+
+	p.sources, err = newSourceConfig(p.BaseLink, p.sourceRoots, p.javaSourceDirs, p.goModule)
 	if err != nil {
-		log.Fatal(err)
+		inputFatalf("%s", err)
 	}
 
-	if debug {
-		log.SetLevel(log.DebugLevel)
+	p.redactor, err = newRedactor(f.redactBuiltin, f.redactPatterns)
+	if err != nil {
+		inputFatalf("%s", err)
+	}
+
+	if f.skippedPattern != "" {
+		p.skippedPattern, err = regexp.Compile(f.skippedPattern)
+		if err != nil {
+			inputFatalf("invalid skipped pattern: %s", err)
+		}
 	}
 
-	err = run(p)
+	p.jiraUrl, err = url.Parse(f.jiraUrl)
 	if err != nil {
-		log.Fatal(err)
+		inputFatalf("%s", err)
 	}
+
+	f.configureLog()
 }
 
 type junit2jira struct {
 	params
 	jiraClient *jira.Client
+	// plan records changes to Jira instead of making them.
+	plan *plan
+	// audit records changes made to Jira.
+	audit *auditLog
 }
 
 type testIssue struct {
 	issue    *jira.Issue
 	newJIRA  bool
+	outcome  outcome
 	testCase testCase
 }
 
-func run(p params) error {
-	transport := http.DefaultTransport
-
+// newJiraClient creates a client authenticated with the JIRA_TOKEN personal access token.
+func newJiraClient(p params) (*jira.Client, error) {
 	tp := jira.PATAuthTransport{
 		Token:     os.Getenv("JIRA_TOKEN"),
-		Transport: transport,
+		Transport: http.DefaultTransport,
 	}
 
 	jiraClient, err := jira.NewClient(tp.Client(), p.jiraUrl.String())
 	if err != nil {
-		return errors.Wrapf(err, "could not create client for %s", p.jiraUrl)
+		return nil, errors.Wrapf(err, "could not create client for %s", p.jiraUrl)
+	}
+	return jiraClient, nil
+}
+
+func run(p params) error {
+	jiraClient, err := newJiraClient(p)
+	if err != nil {
+		return err
 	}
 
 	j := &junit2jira{
 		params:     p,
 		jiraClient: jiraClient,
 	}
-
-	testSuites, err := junit.IngestDir(p.junitReportsDir)
+	if p.dryRun || p.planOutput != "" {
+		j.plan = &plan{JiraUrl: p.jiraUrl.String(), BuildId: p.BuildId}
+	}
+	j.audit, err = openAuditLog(p.auditLog)
 	if err != nil {
-		log.Fatalf("could not read files: %s", err)
+		return withExitCode(exitInputError, err)
 	}
+	defer j.audit.Close()
 
-	err = j.createCsv(testSuites)
+	testSuites, err := ingestReports(p)
 	if err != nil {
-		log.Fatalf("could not create CSV: %s", err)
+		return withExitCode(exitInputError, errors.Wrap(err, "could not read reports"))
+	}
+
+	// Exports without issue columns do not depend on Jira, so they are written even when it cannot be reached.
+	if !p.exportsIssues() {
+		err = j.export(testSuites, nil)
+		if err != nil {
+			return errors.Wrap(err, "could not export tests")
+		}
+	}
+
+	if p.preflight {
+		if err := j.preflight(); err != nil {
+			return errors.Wrap(err, "pre-flight check failed")
+		}
 	}
 
 	failedTests, err := j.findFailedTests(testSuites)
@@ -123,42 +366,93 @@ func run(p params) error {
 		return errors.Wrap(err, "could not find failed tests")
 	}
 
-	issues, err := j.createIssuesOrComments(failedTests)
+	d, err := loadDurations(p)
+	if err != nil {
+		return withExitCode(exitInputError, err)
+	}
+	slowTests := d.findSlowTests(testSuites)
+
+	var runIssue *jira.Issue
+	if j.needsRunIssue() && len(failedTests) > 0 {
+		runIssue, err = j.findOrCreateRunIssue()
+		if err != nil {
+			return errors.Wrap(err, "could not find or create CI run issue")
+		}
+	}
+
+	// Partial Jira errors and errors of outputs sent to other services are returned after all outputs are written.
+	var jiraErrors, outputErrors error
+	issues, err := j.createIssuesOrComments(failedTests, j.subTaskParent(runIssue))
+	if err != nil {
+		jiraErrors = multierror.Append(jiraErrors, errors.Wrap(err, "could not create issues or comments"))
+	}
+
+	err = j.reportSlowTests(slowTests)
 	if err != nil {
-		return errors.Wrap(err, "could not create issues or comments")
+		jiraErrors = multierror.Append(jiraErrors, errors.Wrap(err, "could not report slow tests"))
 	}
 
-	err = j.createSlackMessage(issues)
+	if p.exportsIssues() {
+		err = j.export(testSuites, issues)
+		if err != nil {
+			return errors.Wrap(err, "could not export tests")
+		}
+	}
+
+	err = j.reportMetrics(testSuites, issues)
+	if err != nil {
+		outputErrors = multierror.Append(outputErrors, errors.Wrap(err, "could not report metrics"))
+	}
+
+	err = j.exportTraces(testSuites, issues)
+	if err != nil {
+		outputErrors = multierror.Append(outputErrors, errors.Wrap(err, "could not export traces"))
+	}
+
+	err = j.createSlackMessage(issues, slowTests)
 	if err != nil {
 		return errors.Wrap(err, "could not convert to slack")
 	}
 
 	jiraIssues := make([]*jira.Issue, 0, len(issues))
+	suspects := make([]*sourceRef, 0, len(issues))
 	for _, i := range issues {
 		jiraIssues = append(jiraIssues, i.issue)
+		suspects = append(suspects, i.testCase.SuspectFile())
 	}
 
-	err = j.linkIssues(jiraIssues)
+	err = j.linkIssues(jiraIssues, runIssue)
 	if err != nil {
-		return errors.Wrap(err, "could not link issues")
+		jiraErrors = multierror.Append(jiraErrors, errors.Wrap(err, "could not link issues"))
 	}
 
-	err = j.writeSummary(issues)
+	allFailedTests := len(j.collectFailedTests(testSuites))
+	err = j.writeSummary(issues, allFailedTests)
 	if err != nil {
 		return errors.Wrap(err, "could not write summary")
 	}
 
-	return errors.Wrap(j.createHtml(jiraIssues), "could not create HTML report")
+	err = j.writePlan()
+	if err != nil {
+		return errors.Wrap(err, "could not write plan")
+	}
+
+	err = j.createHtml(jiraIssues, suspects, slowTests)
+	if err != nil {
+		return errors.Wrap(err, "could not create HTML report")
+	}
+
+	return j.gate(allFailedTests, issues, jiraErrors, outputErrors)
 }
 
 //go:embed htmlOutput.html.tpl
 var htmlOutputTemplate string
 
-func (j junit2jira) createSlackMessage(tc []*testIssue) error {
+func (j junit2jira) createSlackMessage(tc []*testIssue, slowTests []slowTest) error {
 	if j.slackOutput == "" {
 		return nil
 	}
-	slackMsg := convertJunitToSlack(tc...)
+	slackMsg := append(convertJunitToSlack(tc...), slowTestsToSlack(slowTests)...)
 	if slackMsg == nil {
 		slackMsg = []slack.Attachment{}
 	}
@@ -183,8 +477,9 @@ func (j junit2jira) createSlackMessage(tc []*testIssue) error {
 	return nil
 }
 
-func (j junit2jira) createHtml(issues []*jira.Issue) error {
-	if j.htmlOutput == "" || len(issues) == 0 {
+// createHtml writes the HTML report of issues with suspect files of their failures in the same order.
+func (j junit2jira) createHtml(issues []*jira.Issue, suspects []*sourceRef, slowTests []slowTest) error {
+	if j.htmlOutput == "" || len(issues) == 0 && len(slowTests) == 0 {
 		return nil
 	}
 	out := os.Stdout
@@ -196,22 +491,30 @@ func (j junit2jira) createHtml(issues []*jira.Issue) error {
 		out = file
 		defer file.Close()
 	}
-	return j.renderHtml(issues, out)
+	return j.renderHtml(issues, suspects, slowTests, out)
 }
 
 type htmlData struct {
-	Issues  []*jira.Issue
-	JiraUrl *url.URL
+	Issues    []*jira.Issue
+	SlowTests []slowTest
+	JiraUrl   *url.URL
 }
 
-func (j junit2jira) renderHtml(issues []*jira.Issue, out io.Writer) error {
-	t, err := template.New(j.htmlOutput).Parse(htmlOutputTemplate)
+func (j junit2jira) renderHtml(issues []*jira.Issue, suspects []*sourceRef, slowTests []slowTest, out io.Writer) error {
+	suspect := func(n int) *sourceRef {
+		if n < len(suspects) {
+			return suspects[n]
+		}
+		return nil
+	}
+	t, err := template.New(j.htmlOutput).Funcs(map[string]any{"isPlannedKey": isPlannedKey, "suspect": suspect}).Parse(htmlOutputTemplate)
 	if err != nil {
 		return fmt.Errorf("could parse template: %w", err)
 	}
 	err = t.Execute(out, htmlData{
-		Issues:  issues,
-		JiraUrl: j.jiraUrl,
+		Issues:    issues,
+		SlowTests: slowTests,
+		JiraUrl:   j.jiraUrl,
 	})
 	if err != nil {
 		return fmt.Errorf("could not render template: %w", err)
@@ -219,56 +522,27 @@ func (j junit2jira) renderHtml(issues []*jira.Issue, out io.Writer) error {
 	return nil
 }
 
-func (j junit2jira) createCsv(testSuites []junit.Suite) error {
-	if j.csvOutput == "" {
-		return nil
-	}
-	out := os.Stdout
-	if j.csvOutput != "-" {
-		file, err := os.Create(j.csvOutput)
-		if err != nil {
-			return fmt.Errorf("could not create file %s: %w", j.csvOutput, err)
-		}
-		out = file
-		defer file.Close()
-	}
-	return junit2csv(testSuites, j.params, out)
-}
-
-func (j junit2jira) createIssuesOrComments(failedTests []testCase) ([]*testIssue, error) {
+// createIssuesOrComments reports failed tests. When parentKey is set, new issues are created as its sub-tasks.
+func (j junit2jira) createIssuesOrComments(failedTests []testCase, parentKey string) ([]*testIssue, error) {
 	var result error
 	issues := make([]*testIssue, 0, len(failedTests))
+	// Sub-tasks are created in the project of their parent, the CI run issue is in -jira-project.
+	parentProject := j.jiraProject
 	for _, tc := range failedTests {
+		tc.parentKey, tc.parentProject = parentKey, parentProject
 		issue, err := j.createIssueOrComment(tc)
 		if err != nil {
 			result = multierror.Append(result, err)
 		}
 		if issue != nil {
 			issues = append(issues, issue)
-		}
-	}
-	return issues, result
-}
-
-func (j junit2jira) linkIssues(issues []*jira.Issue) error {
-	const linkType = "Related" // link type may vay between jira versions and configurations
-
-	var result error
-	for x, issue := range issues {
-		for y := 0; y < x; y++ {
-			_, err := j.jiraClient.Issue.AddLink(&jira.IssueLink{
-				Type:         jira.IssueLinkType{Name: linkType},
-				OutwardIssue: &jira.Issue{Key: issue.Key},
-				InwardIssue:  &jira.Issue{Key: issues[y].Key},
-			})
-			if err != nil {
-				result = multierror.Append(result, err)
-				continue
+			// Sub-tasks cannot have sub-tasks, so the umbrella issue is a parent only if it is not a sub-task itself.
+			if tc.umbrella && issue.issue != nil && parentKey == "" {
+				parentKey, parentProject = issue.issue.Key, issueProject(issue.issue)
 			}
-			log.WithField("ID", issue.Key).Debugf("Created link to %s", issues[y].Key)
 		}
 	}
-	return result
+	return issues, result
 }
 
 func (j junit2jira) createIssueOrComment(tc testCase) (*testIssue, error) {
@@ -280,15 +554,21 @@ func (j junit2jira) createIssueOrComment(tc testCase) (*testIssue, error) {
 	if err != nil {
 		return nil, fmt.Errorf("could not get description: %w", err)
 	}
+	marker := tc.marker(summary)
+	if j.occurrences == occurrencesDescription {
+		// The table starts with the failure the issue is created for.
+		description, err = withOccurrence(description, tc, marker, time.Now(), 0)
+		if err != nil {
+			return nil, fmt.Errorf("could not get description: %w", err)
+		}
+	} else if marker != "" {
+		description += "\n" + marker
+	}
 	const NA = "?"
-	logEntry(NA, summary).Debug("Searching for issue")
-	search, response, err := j.jiraClient.Issue.Search(fmt.Sprintf(jql, j.jiraProject, summary), nil)
+	issue, err := j.findIssue(tc, summary)
 	if err != nil {
-		logError(err, response)
-		return nil, fmt.Errorf("could not search: %w", err)
+		return nil, err
 	}
-
-	issue := findMatchingIssue(search, summary)
 	issueWithTestCase := testIssue{
 		issue:    issue,
 		testCase: tc,
@@ -296,77 +576,113 @@ func (j junit2jira) createIssueOrComment(tc testCase) (*testIssue, error) {
 
 	if issue == nil {
 		logEntry(NA, summary).Info("Issue not found. Creating new issue...")
-		if j.dryRun {
-			logEntry(NA, summary).Debugf("Dry run: will just print issue\n %q", description)
-			return nil, nil
+		project, issueType := j.route(tc)
+		issue = newIssue(project, summary, description)
+		issue.Fields.Type.Name = issueType
+		if tc.parentKey != "" {
+			issue = newSubTask(tc.parentProject, tc.parentKey, summary, description)
 		}
-		issue = newIssue(j.jiraProject, summary, description)
-		create, response, err := j.jiraClient.Issue.Create(issue)
-		if response != nil && err != nil {
-			logError(err, response)
-			return nil, fmt.Errorf("could not create issue %s: %w", summary, err)
+		issue.Fields.Labels = []string{tc.issueLabel()}
+		err = j.createIssue(issue)
+		if err != nil {
+			return nil, err
 		}
-		// Response from API does not contain full object so we need to copy missing data
-		issue.Key = create.Key
-		issue.ID = create.ID
-		issue.Self = create.Self
 		logEntry(issue.Key, summary).Info("Created new issue")
 		issueWithTestCase.issue = issue
-		issueWithTestCase.newJIRA = true
+		issueWithTestCase.outcome = outcomeCreated
+		if isPlannedKey(issue.Key) {
+			issueWithTestCase.outcome = outcomePlanned
+		}
+		issueWithTestCase.newJIRA = issueWithTestCase.outcome == outcomeCreated
 		return &issueWithTestCase, nil
 	}
 
-	comment := jira.Comment{
-		Body: description,
+	// Search results do not contain all comments, so get them with the issue.
+	issue, response, err := j.jiraClient.Issue.Get(issue.Key, &jira.GetQueryOptions{Fields: recordedIssueFields})
+	if err != nil {
+		logError(err, response)
+		return nil, fmt.Errorf("could not get issue %s: %w", summary, err)
 	}
+	issueWithTestCase.issue = issue
 
-	logEntry(issue.ID, issue.Fields.Summary).Info("Found issue. Creating a comment...")
+	if isRecorded(issue, marker) {
+		logEntry(issue.Key, summary).Info("Found issue. Failure is already recorded")
+		issueWithTestCase.outcome = outcomeAlreadyRecorded
+		return &issueWithTestCase, j.linkToParent(tc, issue)
+	}
+	if j.occurrences == occurrencesDescription || j.occurrences == occurrencesPinnedComment {
+		issueWithTestCase.outcome = outcomeUpdated
+		logEntry(issue.Key, issue.Fields.Summary).Info("Found issue. Updating occurrences...")
+		err = j.recordOccurrence(issue, tc, marker)
+	} else {
+		issueWithTestCase.outcome = outcomeCommented
+		logEntry(issue.Key, issue.Fields.Summary).Info("Found issue. Creating a comment...")
+		err = j.addComment(issue, description)
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	if j.dryRun {
-		logEntry(NA, issue.Fields.Summary).Debugf("Dry run: will just print comment:\n%q", description)
-		return &issueWithTestCase, nil
+	err = j.escalate(issue, time.Now())
+	if err != nil {
+		return &issueWithTestCase, err
 	}
 
-	addComment, response, err := j.jiraClient.Issue.AddComment(issue.ID, &comment)
-	if response != nil && err != nil {
+	return &issueWithTestCase, j.linkToParent(tc, issue)
+}
+
+// findIssue returns the open issue of the test case with the given summary, or nil if there is none.
+func (j junit2jira) findIssue(tc testCase, summary string) (*jira.Issue, error) {
+	logEntry("?", summary).Debug("Searching for issue")
+	search, response, err := j.jiraClient.Issue.Search(fmt.Sprintf(jql, j.searchProjects(), j.searchIssueTypes(), tc.issueLabel(), summary), nil)
+	if err != nil {
 		logError(err, response)
-		return nil, fmt.Errorf("could not create issue %s: %w", summary, err)
+		return nil, fmt.Errorf("could not search: %w", err)
 	}
-	logEntry(issue.Key, summary).Infof("Created comment %s", addComment.ID)
-	return &issueWithTestCase, nil
+	return findMatchingIssue(search, summary), nil
 }
 
-func (j junit2jira) writeSummary(tc []*testIssue) error {
-	if j.summaryOutput == "" {
+// linkToParent links an existing issue to the test case parent, as it cannot be converted to a sub-task.
+func (j junit2jira) linkToParent(tc testCase, issue *jira.Issue) error {
+	if tc.parentKey == "" {
 		return nil
 	}
-	out := os.Stdout
-	if j.summaryOutput != "-" {
-		file, err := os.Create(j.summaryOutput)
-		if err != nil {
-			return fmt.Errorf("could not create file %s: %w", j.summaryOutput, err)
-		}
-		out = file
-		defer file.Close()
-	}
+	return j.addLink(&jira.Issue{Key: tc.parentKey}, issue)
+}
 
-	return generateSummary(tc, out)
+func (j junit2jira) writeSummary(tc []*testIssue, failedTests int) error {
+	if j.summaryOutput == "" {
+		return nil
+	}
+	return writeOutput(j.summaryOutput, func(out io.Writer) error {
+		return generateSummary(tc, failedTests, j.redactor.total(), out)
+	})
 }
 
 type summary struct {
-	NewJIRAs int `json:"newJIRAs"`
+	NewJIRAs    int             `json:"newJIRAs"`
+	FailedTests int             `json:"failedTests,omitempty"`
+	Outcomes    map[outcome]int `json:"outcomes,omitempty"`
+	Redactions  int             `json:"redactions,omitempty"`
 }
 
-func generateSummary(tc []*testIssue, output io.Writer) error {
+func generateSummary(tc []*testIssue, failedTests, redactions int, output io.Writer) error {
 	newJIRAs := 0
+	outcomes := make(map[outcome]int)
 
 	for _, testIssue := range tc {
 		if testIssue.newJIRA {
 			newJIRAs++
 		}
+		if testIssue.outcome != "" {
+			outcomes[testIssue.outcome]++
+		}
 	}
 	summary := summary{
-		NewJIRAs: newJIRAs,
+		NewJIRAs:    newJIRAs,
+		FailedTests: failedTests,
+		Outcomes:    outcomes,
+		Redactions:  redactions,
 	}
 
 	json, err := json.Marshal(summary)
@@ -395,11 +711,18 @@ func newIssue(project string, summary string, description string) *jira.Issue {
 			},
 			Summary:     summary,
 			Description: description,
-			Labels:      []string{"CI_Failure"},
+			Labels:      []string{failureLabel},
 		},
 	}
 }
 
+func newSubTask(project, parentKey, summary, description string) *jira.Issue {
+	issue := newIssue(project, summary, description)
+	issue.Fields.Type = jira.IssueType{Name: "Sub-task"}
+	issue.Fields.Parent = &jira.Parent{Key: parentKey}
+	return issue
+}
+
 func findMatchingIssue(search []jira.Issue, summary string) *jira.Issue {
 	for _, i := range search {
 		if i.Fields.Summary == summary {
@@ -410,6 +733,10 @@ func findMatchingIssue(search []jira.Issue, summary string) *jira.Issue {
 }
 
 func logError(e error, response *jira.Response) {
+	if response == nil {
+		log.WithError(e).Error("No response")
+		return
+	}
 	all, err := io.ReadAll(response.Body)
 
 	if err != nil {
@@ -419,53 +746,8 @@ func logError(e error, response *jira.Response) {
 	}
 }
 
-func junit2csv(testSuites []junit.Suite, p params, output io.Writer) error {
-	w := csv.NewWriter(output)
-	header := []string{
-		"BuildId",
-		"Timestamp",
-		"Classname",
-		"Name",
-		"Duration",
-		"Status",
-		"JobName",
-		"BuildTag",
-	}
-	err := w.Write(header)
-	if err != nil {
-		return fmt.Errorf("coud not write header: %w", err)
-	}
-	for _, ts := range testSuites {
-		for _, tc := range ts.Tests {
-			duration := fmt.Sprintf("%d", tc.Duration.Milliseconds())
-			row := []string{
-				p.BuildId,         // BuildId
-				p.timestamp,       // Timestamp
-				tc.Classname,      // Classname
-				tc.Name,           // Name
-				duration,          // Duration
-				string(tc.Status), // Status
-				p.JobName,         // JobName
-				p.BuildTag,        // BuildTag
-			}
-			err := w.Write(row)
-			if err != nil {
-				return fmt.Errorf("coud not write row: %w", err)
-			}
-		}
-	}
-	w.Flush()
-	if w.Error() != nil {
-		return fmt.Errorf("could not flush CSV: %w", w.Error())
-	}
-	return nil
-}
-
 func (j junit2jira) findFailedTests(testSuites []junit.Suite) ([]testCase, error) {
-	failedTests := make([]testCase, 0)
-	for _, ts := range testSuites {
-		failedTests = j.addFailedTests(ts, failedTests)
-	}
+	failedTests := j.collectFailedTests(testSuites)
 	log.Infof("Found %d failed tests", len(failedTests))
 
 	if len(failedTests) > j.threshold && j.threshold > 0 {
@@ -475,39 +757,36 @@ func (j junit2jira) findFailedTests(testSuites []junit.Suite) ([]testCase, error
 	return failedTests, nil
 }
 
+// collectFailedTests returns failed tests without merging them.
+func (j junit2jira) collectFailedTests(testSuites []junit.Suite) []testCase {
+	failedTests := make([]testCase, 0)
+	for _, ts := range testSuites {
+		failedTests = j.addFailedTests(ts, failedTests)
+	}
+	return failedTests
+}
+
 func (j junit2jira) addFailedTests(ts junit.Suite, failedTests []testCase) []testCase {
 	for _, suite := range ts.Suites {
 		failedTests = j.addFailedTests(suite, failedTests)
 	}
 	for _, tc := range ts.Tests {
-		if tc.Error == nil {
+		if tc.Error == nil && !j.isTrackedSkip(tc) {
 			continue
 		}
+		n := len(failedTests)
 		failedTests = j.addTest(failedTests, tc)
+		// The suite name is only needed to route issues.
+		if len(j.routes) > 0 && len(failedTests) > n {
+			failedTests[n].suiteName = ts.Name
+		}
 	}
 	return failedTests
 }
 
-func (j junit2jira) mergeFailedTests(failedTests []testCase) ([]testCase, error) {
-	log.Warning("Too many failed tests, reporting them as a one failure.")
-	msg := ""
-	suite := failedTests[0].Suite
-	for _, t := range failedTests {
-		summary, err := t.summary()
-		if err != nil {
-			return nil, errors.Wrapf(err, "could not get summary of %+v", t)
-		}
-		// If there are multiple suites, do not report them.
-		if suite != t.Suite {
-			suite = j.JobName
-		}
-		msg += summary + "\n"
-	}
-	tc := NewTestCase(junit.Test{
-		Message:   msg,
-		Classname: suite,
-	}, j.params)
-	return []testCase{tc}, nil
+// isTrackedSkip checks if the test was skipped for a reason that should be reported.
+func (j junit2jira) isTrackedSkip(tc junit.Test) bool {
+	return j.skippedPattern != nil && tc.Status == junit.StatusSkipped && j.skippedPattern.MatchString(tc.Message)
 }
 
 func (j junit2jira) addTest(failedTests []testCase, tc junit.Test) []testCase {
@@ -542,7 +821,12 @@ func isGoTest(className string) bool {
 }
 
 const (
-	desc = `
+	desc = output + env
+	// output of the failure.
+	output = `
+{{- with .SuspectFile }}
+*Suspect file:* [{{ .Ref }}|{{ .Link }}]
+{{- end }}
 {{- if .Message }}
 {code:title=Message|borderStyle=solid}
 {{ .Message | truncate }}
@@ -550,12 +834,12 @@ const (
 {{- end }}
 {{- if .Stderr }}
 {code:title=STDERR|borderStyle=solid}
-{{ .Stderr | truncate }}
+{{ .Excerpt .Stderr }}
 {code}
 {{- end }}
 {{- if .Stdout }}
 {code:title=STDOUT|borderStyle=solid}
-{{ .Stdout | truncate }}
+{{ .Excerpt .Stdout }}
 {code}
 {{- end }}
 {{- if .Error }}
@@ -563,14 +847,42 @@ const (
 {{ .Error | truncate }}
 {code}
 {{- end }}
+{{- with .Sources }}
+
+||    SOURCE    ||
+{{- range . }}
+| [{{ .Ref }}|{{ .Link }}] |
+{{- end }}
+{{- end }}
+{{- if .Tests }}
+{{- with .Merged }}
 
+||    SUITE    ||    TEST    ||    MESSAGE    ||
+{{- range .Rows }}
+| {{ .Suite | tableCell }} | {{ .Name | tableCell }} | {{ .Message | firstLine | tableCell }} |
+{{- end }}
+{{- if .OmittedRows }}
+| … {{ .OmittedRows }} more tests |   |   |
+{{- end }}
+{{- range .Outputs }}
+{code:title={{ .Title | codeTitle }}|borderStyle=solid}
+{{ .Text }}
+{code}
+{{- end }}
+{{- if .OmittedOutputs }}
+_{{ .OmittedOutputs }} more outputs omitted._
+{{- end }}
+{{- end }}
+{{- end }}
+`
+	env = `
 ||    ENV     ||      Value           ||
 | BUILD ID     | [{{- .BuildId -}}|{{- .BuildLink -}}]|
 | BUILD TAG    | [{{- .BuildTag -}}|{{- .BaseLink -}}]|
 | JOB NAME     | {{- .JobName -}}      |
 | ORCHESTRATOR | {{- .Orchestrator -}} |
 `
-	summaryTpl = `{{ (print .Suite " / " .Name) | truncateSummary }} FAILED`
+	summaryTpl = `{{ (print .Suite " / " .Name) | truncateSummary }} {{ if .Skipped }}SKIPPED{{ else if .Slow }}SLOW{{ else }}FAILED{{ end }}`
 )
 
 type testCase struct {
@@ -586,6 +898,31 @@ type testCase struct {
 	BuildTag     string
 	BaseLink     string
 	BuildLink    string
+	// Skipped is set for skipped tests reported because of their skip reason.
+	Skipped bool
+	// Slow is set for tests reported because of their duration.
+	Slow bool
+	// Tests are the failures reported together by this test case when they were merged.
+	Tests []testCase
+
+	umbrella      bool
+	parentKey     string
+	parentProject string
+	// suiteName is the name of the JUnit suite of the test, Suite is its classname.
+	suiteName string
+	// label of the issue, failureLabel when empty.
+	label string
+	// excerpt selects the relevant part of long logs.
+	excerpt *excerptConfig
+	// sources links file references of the failure to BaseLink.
+	sources *sourceConfig
+}
+
+func (tc testCase) issueLabel() string {
+	if tc.label != "" {
+		return tc.label
+	}
+	return failureLabel
 }
 
 type params struct {
@@ -596,16 +933,66 @@ type params struct {
 	BaseLink     string
 	BuildLink    string
 
-	threshold       int
-	dryRun          bool
-	jiraUrl         *url.URL
-	jiraProject     string
-	junitReportsDir string
-	timestamp       string
-	csvOutput       string
-	htmlOutput      string
-	slackOutput     string
-	summaryOutput   string
+	threshold           int
+	mergeStrategy       string
+	suiteThreshold      int
+	linkStrategy        string
+	linkType            string
+	runIssueType        string
+	epicLinkField       string
+	dryRun              bool
+	preflight           bool
+	auditLog            string
+	redactor            *redactor
+	excerpt             *excerptConfig
+	sourceRoots         []string
+	javaSourceDirs      []string
+	goModule            string
+	sources             *sourceConfig
+	jiraUrl             *url.URL
+	jiraProject         string
+	junitReportsDir     string
+	inputs              []string
+	excludes            []string
+	parseMode           string
+	requireReports      bool
+	skippedPattern      *regexp.Regexp
+	durationBaselines   []string
+	durationThresholds  string
+	slowTestLimit       time.Duration
+	slowTestRegression  float64
+	slowTestMinDuration time.Duration
+	slowTestIssues      bool
+	slowTestLabel       string
+	reportFormat        string
+	timestamp           string
+	csvOutput           string
+	csvColumns          []string
+	ndjsonOutput        string
+	parquetOutput       string
+	metricsOutput       string
+	pushgatewayUrl      string
+	tracesOutput        string
+	otlpEndpoint        string
+	traceParent         string
+	htmlOutput          string
+	slackOutput         string
+	summaryOutput       string
+	planOutput          string
+	failOn              string
+	staleSearchLabel    string
+	staleAfter          time.Duration
+	historyFiles        []string
+	passStreak          int
+	staleAction         string
+	staleLabel          string
+	closeTransition     string
+	escalations         []escalationRule
+	escalationWindow    time.Duration
+	occurrences         string
+	keepOutputs         int
+	routes              []route
+	planFormat          string
 }
 
 func NewTestCase(tc junit.Test, p params) testCase {
@@ -621,6 +1008,9 @@ func NewTestCase(tc junit.Test, p params) testCase {
 		BuildTag:     p.BuildTag,
 		BaseLink:     p.BaseLink,
 		BuildLink:    p.BuildLink,
+		Skipped:      tc.Error == nil && tc.Status == junit.StatusSkipped,
+		excerpt:      p.excerpt,
+		sources:      p.sources,
 	}
 
 	if tc.Error != nil {
@@ -633,6 +1023,16 @@ func (tc *testCase) description() (string, error) {
 	return render(*tc, desc)
 }
 
+// Excerpt returns the relevant part of a long log according to -excerpt, or its beginning.
+func (tc testCase) Excerpt(log string) string {
+	return tc.excerpt.excerpt(log)
+}
+
+// output renders the failure without the build environment.
+func (tc testCase) output() (string, error) {
+	return render(tc, output)
+}
+
 func (tc testCase) summary() (string, error) {
 	s, err := render(tc, summaryTpl)
 	if err != nil {
@@ -659,7 +1059,13 @@ func (tc *testCase) addSubTest(subTest junit.Test) {
 }
 
 func render(tc testCase, text string) (string, error) {
-	tmpl, err := template.New("test").Funcs(map[string]any{"truncate": truncate, "truncateSummary": truncateSummary}).Parse(text)
+	tmpl, err := template.New("test").Funcs(map[string]any{
+		"truncate":        truncate,
+		"truncateSummary": truncateSummary,
+		"tableCell":       tableCell,
+		"firstLine":       firstLine,
+		"codeTitle":       codeTitle,
+	}).Parse(text)
 	if err != nil {
 		return "", err
 	}
@@ -682,10 +1088,17 @@ func clearString(str string) string {
 
 var maxTextBlockLength = 10000
 
+const truncatedNote = "\n … too long, truncated."
+
 func truncate(s string) string {
+	return truncateTo(s, maxTextBlockLength)
+}
+
+// truncateTo cuts the text to the number of runes and notes it was truncated.
+func truncateTo(s string, limit int) string {
 	runes := []rune(s)
-	if len(runes) > maxTextBlockLength {
-		return string(runes[:maxTextBlockLength]) + "\n … too long, truncated."
+	if len(runes) > limit {
+		return string(runes[:limit]) + truncatedNote
 	}
 	return s
 }
@@ -775,9 +1188,15 @@ func failureToAttachment(title string, tc testCase) (slack.Attachment, error) {
 	failureTitleTextBlock := slack.NewTextBlockObject("plain_text", title, false, false)
 	failureTitleHeaderBlock := slack.NewHeaderBlock(failureTitleTextBlock)
 
+	blocks := failureToBlocks(failureTitleHeaderBlock, failureMessage, failureValue)
+	if suspect := tc.SuspectFile(); suspect != nil {
+		suspectTextBlock := slack.NewTextBlockObject("mrkdwn", fmt.Sprintf("*Suspect file:* <%s|%s>", suspect.Link, suspect.Ref()), false, false)
+		blocks.BlockSet = append(blocks.BlockSet, slack.NewSectionBlock(suspectTextBlock, nil, nil))
+	}
+
 	failureAttachment := slack.Attachment{
 		Color:  "#bb2124",
-		Blocks: failureToBlocks(failureTitleHeaderBlock, failureMessage, failureValue),
+		Blocks: blocks,
 	}
 	return failureAttachment, nil
 }
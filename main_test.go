@@ -4,6 +4,7 @@ import (
 	"bytes"
 	_ "embed"
 	"net/url"
+	"regexp"
 	"testing"
 
 	"github.com/andygrunwald/go-jira"
@@ -51,6 +52,10 @@ func TestParseJunitReport(t *testing.T) {
 		assert.NoError(t, err)
 		tests, err := j.findFailedTests(testsSuites)
 		assert.NoError(t, err)
+		// Merged tests are compared in the merge tests.
+		require.Len(t, tests, 1)
+		assert.Len(t, tests[0].Tests, 2)
+		tests[0].Tests = nil
 		assert.Equal(t, []testCase{
 			{
 				Message: `github.com/stackrox/rox/pkg/booleanpolicy/evaluator / TestDifferentBaseTypes FAILED
@@ -69,6 +74,9 @@ github.com/stackrox/rox/sensor/kubernetes/localscanner / TestLocalScannerTLSIssu
 		assert.NoError(t, err)
 		tests, err := j.findFailedTests(testsSuites)
 		assert.NoError(t, err)
+		require.Len(t, tests, 1)
+		assert.Len(t, tests[0].Tests, 6)
+		tests[0].Tests = nil
 
 		assert.ElementsMatch(
 			t,
@@ -315,7 +323,7 @@ func TestCsvOutput(t *testing.T) {
 	buf := bytes.NewBufferString("")
 	testSuites, err := junit.IngestDir("testdata/jira/TEST-DefaultPoliciesTest.xml")
 	assert.NoError(t, err)
-	err = junit2csv(testSuites, p, buf)
+	err = junit2csv(testSuites, nil, p, buf)
 	assert.NoError(t, err)
 
 	expected := `BuildId,Timestamp,Classname,Name,Duration,Status,JobName,BuildTag
@@ -338,7 +346,7 @@ func TestCsvOutput(t *testing.T) {
 	assert.Equal(t, expected, buf.String())
 
 	buf = bytes.NewBufferString("")
-	err = junit2csv(nil, p, buf)
+	err = junit2csv(nil, nil, p, buf)
 	assert.NoError(t, err)
 	assert.Equal(t, "BuildId,Timestamp,Classname,Name,Duration,Status,JobName,BuildTag\n", buf.String())
 }
@@ -352,7 +360,7 @@ func TestHtmlOutput(t *testing.T) {
 	j := junit2jira{params: params{jiraUrl: u}}
 
 	buf := bytes.NewBufferString("")
-	require.NoError(t, j.renderHtml(nil, buf))
+	require.NoError(t, j.renderHtml(nil, nil, nil, buf))
 
 	issues := []*jira.Issue{
 		{Key: "ROX-1", Fields: &jira.IssueFields{Summary: "abc"}},
@@ -360,7 +368,7 @@ func TestHtmlOutput(t *testing.T) {
 		{Key: "ROX-3"},
 	}
 	buf = bytes.NewBufferString("")
-	require.NoError(t, j.renderHtml(issues, buf))
+	require.NoError(t, j.renderHtml(issues, nil, nil, buf))
 
 	assert.Equal(t, expectedHtmlOutput, buf.String())
 }
@@ -368,7 +376,7 @@ func TestHtmlOutput(t *testing.T) {
 func TestSummaryNoNewJIRAs(t *testing.T) {
 	expectedSummaryNoNewJIRAs := `{"newJIRAs":0}`
 	buf := bytes.NewBufferString("")
-	require.NoError(t, generateSummary(nil, buf))
+	require.NoError(t, generateSummary(nil, 0, 0, buf))
 	assert.Equal(t, expectedSummaryNoNewJIRAs, buf.String())
 }
 
@@ -393,6 +401,31 @@ func TestSummaryNoFailures(t *testing.T) {
 	}
 
 	buf := bytes.NewBufferString("")
-	require.NoError(t, generateSummary(tc, buf))
+	require.NoError(t, generateSummary(tc, 0, 0, buf))
 	assert.Equal(t, expectedSummarySomeNewJIRAs, buf.String())
 }
+
+func TestTrackedSkips(t *testing.T) {
+	suites := []junit.Suite{{Tests: []junit.Test{
+		{Name: "TestFlaky", Classname: "suite", Status: junit.StatusSkipped, Message: "quarantined: ROX-123"},
+		{Name: "TestUnsupported", Classname: "suite", Status: junit.StatusSkipped, Message: "requires OpenShift"},
+		{Name: "TestPassed", Classname: "suite", Status: junit.StatusPassed},
+	}}}
+
+	j := junit2jira{}
+	tests, err := j.findFailedTests(suites)
+	require.NoError(t, err)
+	assert.Empty(t, tests)
+
+	j.skippedPattern = regexp.MustCompile(`quarantined`)
+	tests, err = j.findFailedTests(suites)
+	require.NoError(t, err)
+	require.Len(t, tests, 1)
+	assert.True(t, tests[0].Skipped)
+	summary, err := tests[0].summary()
+	require.NoError(t, err)
+	assert.Equal(t, "suite / TestFlaky SKIPPED", summary)
+	description, err := tests[0].description()
+	require.NoError(t, err)
+	assert.Contains(t, description, "quarantined: ROX-123")
+}
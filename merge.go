@@ -0,0 +1,314 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	junit "github.com/joshdk/go-junit"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// mergeSingle reports all failures as one issue named after the suite or the job.
+	mergeSingle = "single"
+	// mergeSuite reports failures of each suite above the suite threshold as one issue.
+	mergeSuite = "suite"
+	// mergeSignature reports failures sharing a normalized error signature as one issue.
+	mergeSignature = "signature"
+	// mergeUmbrella reports one umbrella issue and every failure as its sub-task.
+	mergeUmbrella = "umbrella"
+)
+
+var mergeStrategies = []string{mergeSingle, mergeSuite, mergeSignature, mergeUmbrella}
+
+func validMergeStrategy(s string) bool {
+	for _, m := range mergeStrategies {
+		if m == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (j junit2jira) mergeFailedTests(failedTests []testCase) ([]testCase, error) {
+	switch j.mergeStrategy {
+	case "", mergeSingle:
+		return j.mergeIntoSingle(failedTests)
+	case mergeSuite:
+		return j.mergeBySuite(failedTests), nil
+	case mergeSignature:
+		return j.mergeBySignature(failedTests), nil
+	case mergeUmbrella:
+		return j.mergeIntoUmbrella(failedTests), nil
+	}
+	return nil, fmt.Errorf("unknown merge strategy %q", j.mergeStrategy)
+}
+
+func (j junit2jira) mergeIntoSingle(failedTests []testCase) ([]testCase, error) {
+	log.Warning("Too many failed tests, reporting them as a one failure.")
+	msg := ""
+	suite := failedTests[0].Suite
+	for _, t := range failedTests {
+		summary, err := t.summary()
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not get summary of %+v", t)
+		}
+		// If there are multiple suites, do not report them.
+		if suite != t.Suite {
+			suite = j.JobName
+		}
+		msg += summary + "\n"
+	}
+	tc := NewTestCase(junit.Test{
+		Message:   msg,
+		Classname: suite,
+	}, j.params)
+	tc.Tests = failedTests
+	tc.suiteName = commonSuiteName(failedTests)
+	return []testCase{tc}, nil
+}
+
+func (j junit2jira) mergeBySuite(failedTests []testCase) []testCase {
+	log.Warning("Too many failed tests, reporting them grouped by suite.")
+	groups, order := groupTests(failedTests, func(tc testCase) string { return tc.Suite })
+	result := make([]testCase, 0, len(order))
+	for _, suite := range order {
+		group := groups[suite]
+		if len(group) <= j.suiteThreshold || len(group) == 1 {
+			result = append(result, group...)
+			continue
+		}
+		result = append(result, j.newMergedTestCase(suite, "", group))
+	}
+	return result
+}
+
+func (j junit2jira) mergeBySignature(failedTests []testCase) []testCase {
+	log.Warning("Too many failed tests, reporting them grouped by error signature.")
+	groups, order := groupTests(failedTests, errorSignature)
+	result := make([]testCase, 0, len(order))
+	for _, signature := range order {
+		group := groups[signature]
+		if len(group) == 1 || signature == "" {
+			result = append(result, group...)
+			continue
+		}
+		result = append(result, j.newMergedTestCase(j.commonSuite(group), signature, group))
+	}
+	return result
+}
+
+func (j junit2jira) mergeIntoUmbrella(failedTests []testCase) []testCase {
+	log.Warning("Too many failed tests, reporting them as sub-tasks of a one failure.")
+	umbrella := j.newMergedTestCase(j.commonSuite(failedTests), "", failedTests)
+	umbrella.umbrella = true
+	return append([]testCase{umbrella}, failedTests...)
+}
+
+// newMergedTestCase creates a test case that reports all given tests in its description.
+func (j junit2jira) newMergedTestCase(suite, name string, tests []testCase) testCase {
+	msg := ""
+	for _, t := range tests {
+		summary, err := t.summary()
+		if err != nil {
+			summary = t.Suite + " / " + t.Name
+		}
+		msg += summary + "\n"
+	}
+	tc := NewTestCase(junit.Test{
+		Name:      name,
+		Message:   msg,
+		Classname: suite,
+	}, j.params)
+	tc.Tests = tests
+	tc.suiteName = commonSuiteName(tests)
+	return tc
+}
+
+// minOutputLength is the smallest share of a text block for an output of a merged test, outputs that would get
+// less are omitted.
+const minOutputLength = 500
+
+// mergedSection is the per-test part of the description of merged failures. It fits one text block,
+// so the description stays below the Jira limit however many tests were merged.
+type mergedSection struct {
+	// Rows are tests listed in the table, which takes at most half of the text block.
+	Rows        []testCase
+	OmittedRows int
+	// Outputs are errors and log excerpts of the tests, sharing the rest of the text block.
+	Outputs        []testOutput
+	OmittedOutputs int
+}
+
+// testOutput is a code block with the error or a log of a merged test.
+type testOutput struct {
+	Title string
+	Text  string
+	// excerpt selects the relevant part of logs, errors are truncated.
+	excerpt *excerptConfig
+}
+
+// Merged returns the per-test part of the description of merged failures.
+func (tc testCase) Merged() mergedSection {
+	var m mergedSection
+	budget := maxTextBlockLength
+	rowsBudget := budget / 2
+	for n, t := range tc.Tests {
+		row := tableRowLength(t)
+		if row > rowsBudget {
+			m.OmittedRows = len(tc.Tests) - n
+			break
+		}
+		rowsBudget -= row
+		budget -= row
+		m.Rows = append(m.Rows, t)
+	}
+
+	var outputs []testOutput
+	for _, t := range tc.Tests {
+		title := t.Suite + " / " + t.Name
+		if t.Error != "" {
+			outputs = append(outputs, testOutput{Title: title, Text: t.Error})
+		}
+		if t.Stderr != "" {
+			outputs = append(outputs, testOutput{Title: title + " STDERR", Text: t.Stderr, excerpt: t.excerpt})
+		}
+		if t.Stdout != "" {
+			outputs = append(outputs, testOutput{Title: title + " STDOUT", Text: t.Stdout, excerpt: t.excerpt})
+		}
+	}
+	keep := min(len(outputs), budget/minOutputLength)
+	m.OmittedOutputs = len(outputs) - keep
+	outputs = outputs[:keep]
+
+	// Outputs are shortened to equal shares, shortest first, so what short outputs do not use goes to long ones.
+	order := make([]int, len(outputs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return utf8.RuneCountInString(outputs[order[a]].Text) < utf8.RuneCountInString(outputs[order[b]].Text)
+	})
+	for n, i := range order {
+		o := &outputs[i]
+		overhead := codeBlockLength(o.Title)
+		limit := max(0, budget/(len(order)-n)-overhead-utf8.RuneCountInString(truncatedNote))
+		o.Text = o.excerpt.excerptTo(o.Text, limit)
+		budget -= overhead + utf8.RuneCountInString(o.Text)
+	}
+	m.Outputs = outputs
+	return m
+}
+
+// tableRowLength returns the length of the row of the test in the table of merged tests.
+func tableRowLength(t testCase) int {
+	return utf8.RuneCountInString(fmt.Sprintf("| %s | %s | %s |\n", tableCell(t.Suite), tableCell(t.Name), tableCell(firstLine(t.Message))))
+}
+
+// codeBlockLength returns the length of an empty code block with the title.
+func codeBlockLength(title string) int {
+	return utf8.RuneCountInString("{code:title=" + codeTitle(title) + "|borderStyle=solid}\n\n{code}\n")
+}
+
+// commonSuiteName returns the JUnit suite name shared by all tests, so merged failures are routed like them,
+// or an empty name if they come from multiple suites.
+func commonSuiteName(tests []testCase) string {
+	for _, t := range tests {
+		if t.suiteName != tests[0].suiteName {
+			return ""
+		}
+	}
+	return tests[0].suiteName
+}
+
+// commonSuite returns the suite shared by all tests or the job name if they come from multiple suites.
+func (j junit2jira) commonSuite(tests []testCase) string {
+	suite := tests[0].Suite
+	for _, t := range tests {
+		if t.Suite != suite {
+			return j.JobName
+		}
+	}
+	return suite
+}
+
+// groupTests groups tests by key and returns the groups with keys in order of first appearance.
+func groupTests(tests []testCase, key func(testCase) string) (map[string][]testCase, []string) {
+	groups := make(map[string][]testCase)
+	var order []string
+	for _, t := range tests {
+		k := key(t)
+		if _, ok := groups[k]; !ok {
+			order = append(order, k)
+		}
+		groups[k] = append(groups[k], t)
+	}
+	return groups, order
+}
+
+var (
+	signatureErrorLine = regexp.MustCompile(`(?m)^\s*Error:\s+(.+)$`)
+	signatureVolatile  = []struct {
+		re          *regexp.Regexp
+		replacement string
+	}{
+		{regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`), "<uuid>"},
+		{regexp.MustCompile(`0x[0-9a-fA-F]+`), "<hex>"},
+		{regexp.MustCompile(`"[^"]*"`), `"<str>"`},
+		{regexp.MustCompile(`'[^']*'`), `'<str>'`},
+		{regexp.MustCompile(`\d+(\.\d+)?(ns|us|µs|ms|s|m|h)\b`), "<duration>"},
+		{regexp.MustCompile(`\d+`), "<n>"},
+		{regexp.MustCompile(`\s+`), " "},
+	}
+	// genericMessages are messages that carry no information about the failure cause.
+	genericMessages = map[string]bool{"failed": true, "failure": true, "error": true}
+)
+
+// errorSignature returns a normalized first line of the failure cause,
+// so the same failure in different tests or runs yields the same signature.
+func errorSignature(tc testCase) string {
+	line := ""
+	if m := signatureErrorLine.FindStringSubmatch(tc.Error); m != nil {
+		line = m[1]
+	}
+	if line == "" {
+		line = firstLine(tc.Message)
+		if genericMessages[strings.ToLower(line)] {
+			line = ""
+		}
+	}
+	if line == "" {
+		line = firstLine(tc.Error)
+	}
+	for _, v := range signatureVolatile {
+		line = v.re.ReplaceAllString(line, v.replacement)
+	}
+	return strings.TrimSpace(line)
+}
+
+func firstLine(s string) string {
+	for _, l := range strings.Split(s, "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			return l
+		}
+	}
+	return ""
+}
+
+// tableCell escapes a value so it can be placed in a single Jira table cell.
+func tableCell(s string) string {
+	s = strings.NewReplacer("|", "\\|", "\r", "", "\n", " ", "{", "\\{", "}", "\\}").Replace(s)
+	if s == "" {
+		return " "
+	}
+	return s
+}
+
+// codeTitle makes a value safe to use as a title of a Jira code block.
+func codeTitle(s string) string {
+	return strings.NewReplacer("|", " ", "{", "(", "}", ")", "\n", " ").Replace(s)
+}
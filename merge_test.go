@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/joshdk/go-junit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeStrategies(t *testing.T) {
+	failed := []testCase{
+		{Name: "TestA", Suite: "suite-1", Message: "Failed", Error: "    a_test.go:10:\n        \tError:      \tcontext deadline exceeded after 10s\n"},
+		{Name: "TestB", Suite: "suite-1", Message: "Failed", Error: "    b_test.go:20:\n        \tError:      \tcontext deadline exceeded after 30s\n"},
+		{Name: "TestC", Suite: "suite-2", Message: `pod "central-1234" not ready`},
+		{Name: "TestD", Suite: "suite-2", Message: `pod "sensor-5678" not ready`},
+		{Name: "TestE", Suite: "suite-3", Message: "unique failure"},
+	}
+
+	t.Run("single", func(t *testing.T) {
+		j := junit2jira{params: params{mergeStrategy: mergeSingle, JobName: "job"}}
+		tests, err := j.mergeFailedTests(failed)
+		require.NoError(t, err)
+		require.Len(t, tests, 1)
+		assert.Equal(t, "job", tests[0].Suite)
+		assert.Equal(t, failed, tests[0].Tests)
+	})
+	t.Run("suite", func(t *testing.T) {
+		j := junit2jira{params: params{mergeStrategy: mergeSuite, suiteThreshold: 1, JobName: "job"}}
+		tests, err := j.mergeFailedTests(failed)
+		require.NoError(t, err)
+		require.Len(t, tests, 3)
+		assert.Equal(t, "suite-1", tests[0].Suite)
+		assert.Equal(t, failed[:2], tests[0].Tests)
+		assert.Equal(t, "suite-2", tests[1].Suite)
+		assert.Equal(t, failed[2:4], tests[1].Tests)
+		assert.Equal(t, failed[4], tests[2])
+	})
+	t.Run("suite above threshold", func(t *testing.T) {
+		j := junit2jira{params: params{mergeStrategy: mergeSuite, suiteThreshold: 2}}
+		tests, err := j.mergeFailedTests(failed)
+		require.NoError(t, err)
+		assert.Equal(t, failed, tests)
+	})
+	t.Run("signature", func(t *testing.T) {
+		j := junit2jira{params: params{mergeStrategy: mergeSignature, JobName: "job"}}
+		tests, err := j.mergeFailedTests(failed)
+		require.NoError(t, err)
+		require.Len(t, tests, 3)
+		assert.Equal(t, "context deadline exceeded after <duration>", tests[0].Name)
+		assert.Equal(t, "suite-1", tests[0].Suite)
+		assert.Len(t, tests[0].Tests, 2)
+		assert.Equal(t, `pod "<str>" not ready`, tests[1].Name)
+		assert.Len(t, tests[1].Tests, 2)
+		assert.Equal(t, failed[4], tests[2])
+	})
+	t.Run("umbrella", func(t *testing.T) {
+		j := junit2jira{params: params{mergeStrategy: mergeUmbrella, JobName: "job"}}
+		tests, err := j.mergeFailedTests(failed)
+		require.NoError(t, err)
+		require.Len(t, tests, len(failed)+1)
+		assert.True(t, tests[0].umbrella)
+		assert.Equal(t, "job", tests[0].Suite)
+		assert.Equal(t, failed, tests[0].Tests)
+		assert.Equal(t, failed, tests[1:])
+	})
+	t.Run("unknown", func(t *testing.T) {
+		j := junit2jira{params: params{mergeStrategy: "unknown"}}
+		_, err := j.mergeFailedTests(failed)
+		assert.Error(t, err)
+	})
+	t.Run("suite from report", func(t *testing.T) {
+		j := junit2jira{params: params{threshold: 1, mergeStrategy: mergeSuite, suiteThreshold: 1}}
+		testsSuites, err := junit.IngestDir("testdata/jira/report.xml")
+		require.NoError(t, err)
+		tests, err := j.findFailedTests(testsSuites)
+		require.NoError(t, err)
+		assert.Len(t, tests, 2)
+	})
+}
+
+func TestMergedDescription(t *testing.T) {
+	defer func(length int) { maxTextBlockLength = length }(maxTextBlockLength)
+	maxTextBlockLength = 10000
+	tc := testCase{
+		Suite:   "suite",
+		Message: "suite / TestA FAILED\nsuite / TestB FAILED\n",
+		Tests: []testCase{
+			{Name: "TestA", Suite: "suite", Message: "first | line\nsecond line", Error: "boom"},
+			{Name: "TestB", Suite: "suite"},
+		},
+	}
+	actual, err := tc.description()
+	require.NoError(t, err)
+	assert.Equal(t, `
+{code:title=Message|borderStyle=solid}
+suite / TestA FAILED
+suite / TestB FAILED
+
+{code}
+
+||    SUITE    ||    TEST    ||    MESSAGE    ||
+| suite | TestA | first \| line |
+| suite | TestB |   |
+{code:title=suite / TestA|borderStyle=solid}
+boom
+{code}
+
+||    ENV     ||      Value           ||
+| BUILD ID     | [|]|
+| BUILD TAG    | [|]|
+| JOB NAME     ||
+| ORCHESTRATOR ||
+`, actual)
+}
+
+func TestMergedDescriptionBudget(t *testing.T) {
+	defer func(length int) { maxTextBlockLength = length }(maxTextBlockLength)
+	maxTextBlockLength = 2000
+	excerpt, err := newExcerptConfig(excerptGo, nil, 1, 1, 2)
+	require.NoError(t, err)
+	log := strings.Repeat("=== RUN TestA\n", 100) + "--- FAIL: TestA\n" + strings.Repeat("cleanup\n", 100) + "FAIL"
+	tc := testCase{Suite: "suite"}
+	for i := 0; i < 20; i++ {
+		tc.Tests = append(tc.Tests, testCase{Name: fmt.Sprintf("Test%d", i), Suite: "suite", Message: "failed", Error: strings.Repeat("boom ", 200), Stderr: log, excerpt: excerpt})
+	}
+
+	// Logs of the first tests are excerpted, the others are omitted, so all outputs fit one text block.
+	m := tc.Merged()
+	assert.Len(t, m.Rows, 20)
+	require.Len(t, m.Outputs, 2)
+	assert.Equal(t, "suite / Test0 STDERR", m.Outputs[1].Title)
+	assert.Contains(t, m.Outputs[1].Text, "--- FAIL: TestA\n")
+	assert.Contains(t, m.Outputs[1].Text, "lines omitted")
+	assert.Equal(t, 38, m.OmittedOutputs)
+	section, err := render(tc, output)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, utf8.RuneCountInString(section), maxTextBlockLength+100)
+	assert.Contains(t, section, "_38 more outputs omitted._")
+
+	// The table takes at most half of the text block.
+	for i := range tc.Tests {
+		tc.Tests[i].Message = strings.Repeat("x", 100)
+	}
+	m = tc.Merged()
+	assert.Len(t, m.Rows, 8)
+	assert.Equal(t, 12, m.OmittedRows)
+}
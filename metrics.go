@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	junit "github.com/joshdk/go-junit"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// durationBuckets are upper bounds of test duration histogram buckets in seconds.
+var durationBuckets = []float64{0.1, 1, 10, 60, 300, 900}
+
+// metric is a metric family.
+type metric struct {
+	// name of the family, without the _total suffix of counters.
+	name    string
+	help    string
+	kind    string
+	samples []sample
+}
+
+type sample struct {
+	// suffix of histogram samples, e.g. _bucket.
+	suffix string
+	labels []label
+	value  float64
+}
+
+type label struct {
+	name, value string
+}
+
+// collectMetrics counts tests by status, flaky tests, test durations and issues by outcome.
+func collectMetrics(testSuites []junit.Suite, issues []*testIssue, p params) []metric {
+	job := jobLabel(p)
+	c := &metricsCollector{
+		statuses:  map[[2]string]int{},
+		durations: map[string]*histogram{},
+		runs:      map[[2]string]map[junit.Status]bool{},
+	}
+	c.add(testSuites)
+
+	tests := metric{name: "junit_tests", help: "Number of tests by suite and status.", kind: "counter"}
+	for _, k := range sortedKeys(c.statuses) {
+		tests.samples = append(tests.samples, sample{
+			labels: []label{{"job", job}, {"suite", k[0]}, {"status", k[1]}},
+			value:  float64(c.statuses[k]),
+		})
+	}
+
+	flaky := map[string]int{}
+	for k, statuses := range c.runs {
+		if statuses[junit.StatusPassed] && (statuses[junit.StatusFailed] || statuses[junit.StatusError]) {
+			flaky[k[0]]++
+		}
+	}
+	flakyTests := metric{name: "junit_flaky_tests", help: "Number of tests that both failed and passed, e.g. when failures are re-run.", kind: "counter"}
+	for _, suite := range sortedStrings(flaky) {
+		flakyTests.samples = append(flakyTests.samples, sample{
+			labels: []label{{"job", job}, {"suite", suite}},
+			value:  float64(flaky[suite]),
+		})
+	}
+
+	durations := metric{name: "junit_test_duration_seconds", help: "Duration of tests that were not skipped.", kind: "histogram"}
+	suites := make([]string, 0, len(c.durations))
+	for suite := range c.durations {
+		suites = append(suites, suite)
+	}
+	sort.Strings(suites)
+	for _, suite := range suites {
+		durations.samples = append(durations.samples, c.durations[suite].samples(label{"job", job}, label{"suite", suite})...)
+	}
+
+	outcomes := map[string]int{}
+	for _, i := range issues {
+		if i.outcome != "" {
+			outcomes[string(i.outcome)]++
+		}
+	}
+	issuesTotal := metric{name: "junit2jira_issues", help: "Number of reported failures by outcome.", kind: "counter"}
+	for _, o := range sortedStrings(outcomes) {
+		issuesTotal.samples = append(issuesTotal.samples, sample{
+			labels: []label{{"job", job}, {"outcome", o}},
+			value:  float64(outcomes[o]),
+		})
+	}
+	return []metric{tests, flakyTests, durations, issuesTotal}
+}
+
+// jobLabel is the job of metrics and the Pushgateway grouping key.
+func jobLabel(p params) string {
+	if p.JobName == "" {
+		return "junit2jira"
+	}
+	return p.JobName
+}
+
+type metricsCollector struct {
+	// statuses counts tests by suite and status.
+	statuses  map[[2]string]int
+	durations map[string]*histogram
+	// runs are statuses of each suite and test, a test can be reported more than once when it was re-run.
+	runs map[[2]string]map[junit.Status]bool
+}
+
+func (c *metricsCollector) add(testSuites []junit.Suite) {
+	for _, ts := range testSuites {
+		c.add(ts.Suites)
+		for _, tc := range ts.Tests {
+			c.statuses[[2]string{ts.Name, string(tc.Status)}]++
+			run := [2]string{ts.Name, durationKey(tc.Classname, tc.Name)}
+			if c.runs[run] == nil {
+				c.runs[run] = map[junit.Status]bool{}
+			}
+			c.runs[run][tc.Status] = true
+			if tc.Status == junit.StatusSkipped {
+				continue
+			}
+			h := c.durations[ts.Name]
+			if h == nil {
+				h = &histogram{buckets: make([]int, len(durationBuckets))}
+				c.durations[ts.Name] = h
+			}
+			h.observe(tc.Duration.Seconds())
+		}
+	}
+}
+
+type histogram struct {
+	// buckets count observations up to the bucket bound, excluding the lower buckets.
+	buckets []int
+	count   int
+	sum     float64
+}
+
+func (h *histogram) observe(v float64) {
+	h.count++
+	h.sum += v
+	for i, bound := range durationBuckets {
+		if v <= bound {
+			h.buckets[i]++
+			return
+		}
+	}
+}
+
+func (h *histogram) samples(labels ...label) []sample {
+	labels = labels[:len(labels):len(labels)]
+	var samples []sample
+	cumulative := 0
+	for i, bound := range durationBuckets {
+		cumulative += h.buckets[i]
+		samples = append(samples, sample{suffix: "_bucket", labels: append(labels, label{"le", formatFloat(bound)}), value: float64(cumulative)})
+	}
+	return append(samples,
+		sample{suffix: "_bucket", labels: append(labels, label{"le", "+Inf"}), value: float64(h.count)},
+		sample{suffix: "_sum", labels: labels, value: h.sum},
+		sample{suffix: "_count", labels: labels, value: float64(h.count)},
+	)
+}
+
+func sortedKeys(m map[[2]string]int) [][2]string {
+	keys := make([][2]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	return keys
+}
+
+func sortedStrings(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writeMetrics writes metrics in the OpenMetrics format, or in the Prometheus text format
+// which names counter families with the _total suffix and has no EOF marker.
+func writeMetrics(w io.Writer, metrics []metric, openMetrics bool) error {
+	buf := &bytes.Buffer{}
+	for _, m := range metrics {
+		family, suffix := m.name, ""
+		if m.kind == "counter" {
+			suffix = "_total"
+			if !openMetrics {
+				family += suffix
+			}
+		}
+		fmt.Fprintf(buf, "# HELP %s %s\n", family, m.help)
+		fmt.Fprintf(buf, "# TYPE %s %s\n", family, m.kind)
+		for _, s := range m.samples {
+			buf.WriteString(m.name + suffix + s.suffix)
+			if len(s.labels) > 0 {
+				pairs := make([]string, 0, len(s.labels))
+				for _, l := range s.labels {
+					pairs = append(pairs, fmt.Sprintf(`%s="%s"`, l.name, labelEscaper.Replace(l.value)))
+				}
+				buf.WriteString("{" + strings.Join(pairs, ",") + "}")
+			}
+			buf.WriteString(" " + formatFloat(s.value) + "\n")
+		}
+	}
+	if openMetrics {
+		buf.WriteString("# EOF\n")
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// reportMetrics writes metrics to the OpenMetrics output and pushes them to the Pushgateway.
+func (j junit2jira) reportMetrics(testSuites []junit.Suite, issues []*testIssue) error {
+	if j.metricsOutput == "" && j.pushgatewayUrl == "" {
+		return nil
+	}
+	metrics := collectMetrics(testSuites, issues, j.params)
+	if j.metricsOutput != "" {
+		err := writeOutput(j.metricsOutput, func(out io.Writer) error {
+			return writeMetrics(out, metrics, true)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if j.pushgatewayUrl == "" {
+		return nil
+	}
+	if j.dryRun {
+		log.Infof("Dry run: would push metrics to %s", j.pushgatewayUrl)
+		return nil
+	}
+	return pushMetrics(j.pushgatewayUrl, jobLabel(j.params), metrics)
+}
+
+// jobPath returns the grouping key of the job in a Pushgateway URL. Names with a slash cannot be escaped
+// in the path and empty names cannot be a path segment, so they are base64 encoded.
+func jobPath(job string) string {
+	if job == "" {
+		return "job@base64/="
+	}
+	if strings.Contains(job, "/") {
+		return "job@base64/" + base64.URLEncoding.EncodeToString([]byte(job))
+	}
+	return "job/" + url.PathEscape(job)
+}
+
+// pushMetrics replaces metrics of the job in the Pushgateway.
+func pushMetrics(pushgatewayUrl, job string, metrics []metric) error {
+	body := &bytes.Buffer{}
+	if err := writeMetrics(body, metrics, false); err != nil {
+		return err
+	}
+	u := strings.TrimSuffix(pushgatewayUrl, "/") + "/metrics/" + jobPath(job)
+	req, err := http.NewRequest(http.MethodPut, u, body)
+	if err != nil {
+		return errors.Wrap(err, "could not create Pushgateway request")
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "could not push metrics")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(resp.Body)
+		return errors.Errorf("could not push metrics: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	log.Infof("Pushed metrics to %s", u)
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	junit "github.com/joshdk/go-junit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var metricSuites = []junit.Suite{{Name: "e2e", Suites: []junit.Suite{{Name: "policies", Tests: []junit.Test{
+	{Name: "TestA", Classname: "policies", Duration: 50 * time.Millisecond, Status: junit.StatusPassed},
+	{Name: "TestB", Classname: "policies", Duration: 2 * time.Second, Status: junit.StatusFailed},
+	{Name: "TestB", Classname: "policies", Duration: 3 * time.Second, Status: junit.StatusPassed},
+	{Name: "TestC", Classname: "policies", Status: junit.StatusSkipped},
+}}}}}
+
+func TestOpenMetricsOutput(t *testing.T) {
+	issues := []*testIssue{{outcome: outcomeCreated}, {outcome: outcomeCommented}, {outcome: outcomeCommented}}
+	buf := bytes.NewBufferString("")
+	require.NoError(t, writeMetrics(buf, collectMetrics(metricSuites, issues, params{JobName: `job "1"`}), true))
+	assert.Equal(t, `# HELP junit_tests Number of tests by suite and status.
+# TYPE junit_tests counter
+junit_tests_total{job="job \"1\"",suite="policies",status="failed"} 1
+junit_tests_total{job="job \"1\"",suite="policies",status="passed"} 2
+junit_tests_total{job="job \"1\"",suite="policies",status="skipped"} 1
+# HELP junit_flaky_tests Number of tests that both failed and passed, e.g. when failures are re-run.
+# TYPE junit_flaky_tests counter
+junit_flaky_tests_total{job="job \"1\"",suite="policies"} 1
+# HELP junit_test_duration_seconds Duration of tests that were not skipped.
+# TYPE junit_test_duration_seconds histogram
+junit_test_duration_seconds_bucket{job="job \"1\"",suite="policies",le="0.1"} 1
+junit_test_duration_seconds_bucket{job="job \"1\"",suite="policies",le="1"} 1
+junit_test_duration_seconds_bucket{job="job \"1\"",suite="policies",le="10"} 3
+junit_test_duration_seconds_bucket{job="job \"1\"",suite="policies",le="60"} 3
+junit_test_duration_seconds_bucket{job="job \"1\"",suite="policies",le="300"} 3
+junit_test_duration_seconds_bucket{job="job \"1\"",suite="policies",le="900"} 3
+junit_test_duration_seconds_bucket{job="job \"1\"",suite="policies",le="+Inf"} 3
+junit_test_duration_seconds_sum{job="job \"1\"",suite="policies"} 5.05
+junit_test_duration_seconds_count{job="job \"1\"",suite="policies"} 3
+# HELP junit2jira_issues Number of reported failures by outcome.
+# TYPE junit2jira_issues counter
+junit2jira_issues_total{job="job \"1\"",outcome="commented"} 2
+junit2jira_issues_total{job="job \"1\"",outcome="created"} 1
+# EOF
+`, buf.String())
+}
+
+func TestPushMetrics(t *testing.T) {
+	var method, path, contentType, body string
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path, contentType = r.Method, r.URL.EscapedPath(), r.Header.Get("Content-Type")
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	j := junit2jira{params: params{pushgatewayUrl: server.URL + "/", JobName: "e2e tests"}}
+	require.NoError(t, j.reportMetrics(metricSuites, nil))
+	assert.Equal(t, http.MethodPut, method)
+	assert.Equal(t, "/metrics/job/e2e%20tests", path)
+	assert.Equal(t, "text/plain; version=0.0.4", contentType)
+	assert.Contains(t, body, "# TYPE junit_tests_total counter\n")
+	assert.NotContains(t, body, "# EOF")
+
+	status = http.StatusBadRequest
+	err := j.reportMetrics(metricSuites, nil)
+	assert.ErrorContains(t, err, "400 Bad Request")
+
+	// Job names with a slash are base64 encoded, as the Pushgateway decodes escaped slashes.
+	status = http.StatusOK
+	j.JobName = "pull/e2e"
+	require.NoError(t, j.reportMetrics(metricSuites, nil))
+	assert.Equal(t, "/metrics/job@base64/cHVsbC9lMmU=", path)
+	assert.Equal(t, "job@base64/=", jobPath(""))
+
+	path = ""
+	j.dryRun = true
+	require.NoError(t, j.reportMetrics(metricSuites, nil))
+	assert.Empty(t, path)
+}
+
+func TestRunMetricsError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	_, u := newFakeJira(t)
+	dir := t.TempDir()
+	p := params{
+		jiraUrl:         u,
+		jiraProject:     "ROX",
+		junitReportsDir: "testdata/jira/report.xml",
+		BuildId:         "1",
+		threshold:       10,
+		summaryOutput:   filepath.Join(dir, "summary.json"),
+		htmlOutput:      filepath.Join(dir, "report.html"),
+		pushgatewayUrl:  server.URL,
+		JobName:         "e2e",
+	}
+	// Metrics that could not be pushed do not stop the run after Jira was changed.
+	err := run(p)
+	assert.Equal(t, exitFailure, exitCode(err))
+	assert.ErrorContains(t, err, "could not report metrics")
+	assert.FileExists(t, p.summaryOutput)
+	assert.FileExists(t, p.htmlOutput)
+
+	p.failOn = failOnAnyFailure
+	p.BuildId = "2"
+	assert.Equal(t, exitTestsFailed, exitCode(run(p)))
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+)
+
+const (
+	occurrencesComments      = "comments"
+	occurrencesDescription   = "description"
+	occurrencesPinnedComment = "pinned-comment"
+
+	// occurrencesStart and occurrencesEnd are invisible Jira anchors around the occurrence table.
+	occurrencesStart = "{anchor:junit2jira-occurrences}"
+	occurrencesEnd   = "{anchor:junit2jira-occurrences-end}"
+	// outputMarker starts a failure output kept below the occurrence table.
+	outputMarker = "{anchor:junit2jira-output}"
+
+	occurrencesHeader    = "||BUILD||DATE||JOB NAME||ORCHESTRATOR||"
+	occurrenceTimeLayout = "2006-01-02 15:04 MST"
+)
+
+var occurrenceModes = []string{occurrencesComments, occurrencesDescription, occurrencesPinnedComment}
+
+var (
+	// failureMarker matches anchors of failures, see testCase.marker.
+	failureMarker = regexp.MustCompile(`\{anchor:junit2jira-[^}]*-[0-9a-f]{12}\}`)
+	// occurrenceDate matches the date cell of an occurrence table row.
+	occurrenceDate = regexp.MustCompile(`\| (\d{4}-\d\d-\d\d \d\d:\d\d [A-Z]+) \|`)
+)
+
+func validOccurrences(mode string) bool {
+	for _, m := range occurrenceModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// occurrenceTable lists builds a test failed in with outputs of the latest failures, newest first.
+type occurrenceTable struct {
+	rows    []string
+	outputs []string
+}
+
+// parseOccurrences finds the occurrence table in the text.
+func parseOccurrences(text string) (before string, table occurrenceTable, after string, ok bool) {
+	start := strings.Index(text, occurrencesStart)
+	end := strings.Index(text, occurrencesEnd)
+	if start < 0 || end < start {
+		return text, table, "", false
+	}
+	block := text[start+len(occurrencesStart) : end]
+	tableText, outputs, _ := strings.Cut(block, outputMarker)
+	for _, line := range strings.Split(tableText, "\n") {
+		if strings.HasPrefix(line, "| ") {
+			table.rows = append(table.rows, line)
+		}
+	}
+	if outputs != "" {
+		for _, o := range strings.Split(outputMarker+outputs, outputMarker)[1:] {
+			table.outputs = append(table.outputs, strings.Trim(o, "\n"))
+		}
+	}
+	return text[:start], table, text[end+len(occurrencesEnd):], true
+}
+
+// add records a failure of the test case on top of the table, keeping keep latest outputs.
+func (t *occurrenceTable) add(tc testCase, marker string, now time.Time, keep int) error {
+	build := tableCell(tc.BuildId)
+	if tc.BuildLink != "" {
+		build = fmt.Sprintf("[%s|%s]", build, tc.BuildLink)
+	}
+	row := fmt.Sprintf("| %s%s | %s | %s | %s |", build, marker, now.UTC().Format(occurrenceTimeLayout), tableCell(tc.JobName), tableCell(tc.Orchestrator))
+	t.rows = append([]string{row}, t.rows...)
+
+	output, err := tc.output()
+	if err != nil {
+		return err
+	}
+	t.outputs = append([]string{fmt.Sprintf("h4. Build %s\n%s", tableCell(tc.BuildId), strings.Trim(output, "\n"))}, t.outputs...)
+	if len(t.outputs) > keep {
+		t.outputs = t.outputs[:keep]
+	}
+	return nil
+}
+
+func (t occurrenceTable) String() string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "%s\nh3. Occurrences\n%s\n", occurrencesStart, occurrencesHeader)
+	for _, r := range t.rows {
+		b.WriteString(r + "\n")
+	}
+	if len(t.outputs) > 0 {
+		b.WriteString("h3. Latest failures\n")
+	}
+	for _, o := range t.outputs {
+		fmt.Fprintf(b, "%s\n%s\n", outputMarker, o)
+	}
+	b.WriteString(occurrencesEnd)
+	return b.String()
+}
+
+// times returns dates of the occurrences.
+func (t occurrenceTable) times() []time.Time {
+	var times []time.Time
+	for _, r := range t.rows {
+		if m := occurrenceDate.FindStringSubmatch(r); m != nil {
+			if date, err := time.Parse(occurrenceTimeLayout, m[1]); err == nil {
+				times = append(times, date)
+			}
+		}
+	}
+	return times
+}
+
+// withOccurrence returns the text with the failure added to its occurrence table, appending the table if there is none.
+func withOccurrence(text string, tc testCase, marker string, now time.Time, keep int) (string, error) {
+	before, table, after, ok := parseOccurrences(text)
+	if err := table.add(tc, marker, now, keep); err != nil {
+		return "", err
+	}
+	if !ok && before != "" {
+		before += "\n\n"
+	}
+	return before + table.String() + after, nil
+}
+
+// recordOccurrence updates the occurrence table in the issue description or pinned comment.
+func (j junit2jira) recordOccurrence(issue *jira.Issue, tc testCase, marker string) error {
+	now := time.Now()
+	if j.occurrences == occurrencesDescription {
+		description, err := withOccurrence(issue.Fields.Description, tc, marker, now, j.keepOutputs)
+		if err != nil {
+			return err
+		}
+		return j.updateIssue(issue.Key, map[string]any{"description": description})
+	}
+
+	if c := pinnedComment(issue); c != nil {
+		body, err := withOccurrence(c.Body, tc, marker, now, j.keepOutputs)
+		if err != nil {
+			return err
+		}
+		return j.editComment(issue.Key, c.ID, body)
+	}
+	body, err := withOccurrence("", tc, marker, now, j.keepOutputs)
+	if err != nil {
+		return err
+	}
+	return j.addComment(issue, body)
+}
+
+// pinnedComment returns the comment with the occurrence table, if any.
+func pinnedComment(issue *jira.Issue) *jira.Comment {
+	if issue.Fields.Comments == nil {
+		return nil
+	}
+	for _, c := range issue.Fields.Comments.Comments {
+		if c != nil && strings.Contains(c.Body, occurrencesStart) {
+			return c
+		}
+	}
+	return nil
+}
+
+// failureTimes returns when failures were recorded on the issue: its creation, comments with failure
+// markers and rows of occurrence tables. A table in the description starts with the creation.
+func failureTimes(issue *jira.Issue) []time.Time {
+	var times []time.Time
+	if _, table, _, ok := parseOccurrences(issue.Fields.Description); ok {
+		times = append(times, table.times()...)
+	} else {
+		times = append(times, time.Time(issue.Fields.Created))
+	}
+	if issue.Fields.Comments == nil {
+		return times
+	}
+	for _, c := range issue.Fields.Comments.Comments {
+		if c == nil {
+			continue
+		}
+		if _, table, _, ok := parseOccurrences(c.Body); ok {
+			times = append(times, table.times()...)
+		} else if isFailureComment(c.Body) {
+			times = append(times, commentTime(c))
+		}
+	}
+	return times
+}
+
+func isFailureComment(body string) bool {
+	return failureMarker.MatchString(body)
+}
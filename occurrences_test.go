@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOccurrencesInDescription(t *testing.T) {
+	s, u := newFakeJira(t)
+	p := params{
+		jiraUrl:         u,
+		jiraProject:     "ROX",
+		junitReportsDir: "testdata/jira/report.xml",
+		BuildId:         "1",
+		BuildLink:       "https://ci/1",
+		JobName:         "job",
+		threshold:       10,
+		linkStrategy:    linkNone,
+		occurrences:     occurrencesDescription,
+		keepOutputs:     1,
+	}
+	require.NoError(t, run(p))
+	for _, build := range []string{"2", "3", "3"} {
+		p.BuildId, p.BuildLink = build, "https://ci/"+build
+		require.NoError(t, run(p))
+	}
+
+	issues := s.Issues()
+	require.NotEmpty(t, issues)
+	issue := issues[0]
+	assert.Empty(t, issue.Comments)
+	before, table, after, ok := parseOccurrences(issue.Description)
+	require.True(t, ok)
+	assert.Contains(t, before, "{code:title=Message|borderStyle=solid}")
+	assert.Empty(t, after)
+	require.Len(t, table.rows, 3)
+	assert.True(t, strings.HasPrefix(table.rows[0], "| [3|https://ci/3]{anchor:junit2jira-3-"), table.rows[0])
+	assert.True(t, strings.HasPrefix(table.rows[2], "| [1|https://ci/1]{anchor:junit2jira-1-"), table.rows[2])
+	assert.True(t, strings.HasSuffix(table.rows[0], " | job |   |"), table.rows[0])
+	require.Len(t, table.outputs, 1)
+	assert.True(t, strings.HasPrefix(table.outputs[0], "h4. Build 3\n{code:title=Message|borderStyle=solid}"), table.outputs[0])
+	assert.NotContains(t, table.outputs[0], "ENV")
+
+	jiraIssue := fetchIssue(t, u, issue.Key)
+	assert.Len(t, failureTimes(jiraIssue), 3)
+}
+
+func TestOccurrencesInPinnedComment(t *testing.T) {
+	s, u := newFakeJira(t)
+	p := params{
+		jiraUrl:         u,
+		jiraProject:     "ROX",
+		junitReportsDir: "testdata/jira/report.xml",
+		BuildId:         "1",
+		threshold:       10,
+		linkStrategy:    linkNone,
+		occurrences:     occurrencesPinnedComment,
+		keepOutputs:     5,
+	}
+	for _, build := range []string{"1", "2", "3", "3"} {
+		p.BuildId = build
+		require.NoError(t, run(p))
+	}
+
+	issue := s.Issues()[0]
+	assert.Contains(t, issue.Description, "{anchor:junit2jira-1-")
+	require.Len(t, issue.Comments, 1)
+	_, table, _, ok := parseOccurrences(issue.Comments[0].Body)
+	require.True(t, ok)
+	require.Len(t, table.rows, 2)
+	assert.True(t, strings.HasPrefix(table.rows[0], "| 3{anchor:junit2jira-3-"), table.rows[0])
+	assert.Len(t, table.outputs, 2)
+
+	assert.Len(t, failureTimes(fetchIssue(t, u, issue.Key)), 3)
+}
+
+func fetchIssue(t *testing.T, u *url.URL, key string) *jira.Issue {
+	client, err := jira.NewClient(nil, u.String())
+	require.NoError(t, err)
+	issue, _, err := client.Issue.Get(key, nil)
+	require.NoError(t, err)
+	return issue
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/hashicorp/go-multierror"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	planFormatJson = "json"
+	planFormatText = "text"
+
+	actionCreate  = "create"
+	actionComment = "comment"
+	actionLink    = "link"
+	actionUpdate  = "update"
+
+	actionTransition = "transition"
+	actionWatch      = "watch"
+	actionEdit       = "edit-comment"
+
+	// plannedKeyPrefix marks keys of issues that are only planned to be created.
+	plannedKeyPrefix = "PLANNED-"
+)
+
+// plan is a list of changes to Jira that can be reviewed and applied later.
+type plan struct {
+	JiraUrl string `json:"jiraUrl"`
+	// BuildId is the build the plan was created for, it is recorded in the audit log when the plan is applied.
+	BuildId string       `json:"buildId,omitempty"`
+	Actions []planAction `json:"actions"`
+}
+
+// planAction is a single change to Jira.
+type planAction struct {
+	Action string `json:"action"`
+	// Key of the issue the action changes. For created issues it is a planned key referenced by later actions.
+	Key      string         `json:"key"`
+	Issue    *jira.Issue    `json:"issue,omitempty"`
+	Comment  string         `json:"comment,omitempty"`
+	LinkType string         `json:"linkType,omitempty"`
+	LinkTo   string         `json:"linkTo,omitempty"`
+	Fields   map[string]any `json:"fields,omitempty"`
+	// Transition is the name or target status of a workflow transition.
+	Transition string `json:"transition,omitempty"`
+	Watcher    string `json:"watcher,omitempty"`
+	CommentID  string `json:"commentId,omitempty"`
+}
+
+func isPlannedKey(key string) bool {
+	return strings.HasPrefix(key, plannedKeyPrefix)
+}
+
+func (p *plan) add(a planAction) {
+	p.Actions = append(p.Actions, a)
+}
+
+func (p *plan) nextKey() string {
+	n := 1
+	for _, a := range p.Actions {
+		if a.Action == actionCreate {
+			n++
+		}
+	}
+	return fmt.Sprintf("%s%d", plannedKeyPrefix, n)
+}
+
+// createIssue creates the issue or plans its creation and fills in its key.
+func (j junit2jira) createIssue(issue *jira.Issue) error {
+	if j.plan != nil {
+		issue.Key = j.plan.nextKey()
+		logEntry(issue.Key, issue.Fields.Summary).Debugf("Dry run: will just print issue\n %q", issue.Fields.Description)
+		j.plan.add(planAction{Action: actionCreate, Key: issue.Key, Issue: issue})
+		return nil
+	}
+	start := time.Now()
+	create, response, err := j.jiraClient.Issue.Create(issue)
+	record := auditRecord{Action: actionCreate, Request: fmt.Sprintf("%s in %s: %s", issue.Fields.Type.Name, issue.Fields.Project.Key, issue.Fields.Summary)}
+	if err != nil {
+		j.record(record, start, response, err)
+		logError(err, response)
+		return fmt.Errorf("could not create issue %s: %w", issue.Fields.Summary, err)
+	}
+	record.Key = create.Key
+	j.record(record, start, response, nil)
+	// Response from API does not contain full object so we need to copy missing data
+	issue.Key = create.Key
+	issue.ID = create.ID
+	issue.Self = create.Self
+	return nil
+}
+
+// addComment comments the issue or plans the comment.
+func (j junit2jira) addComment(issue *jira.Issue, body string) error {
+	if j.plan != nil {
+		logEntry(issue.Key, issue.Fields.Summary).Debugf("Dry run: will just print comment:\n%q", body)
+		j.plan.add(planAction{Action: actionComment, Key: issue.Key, Comment: body})
+		return nil
+	}
+	start := time.Now()
+	addComment, response, err := j.jiraClient.Issue.AddComment(issue.Key, &jira.Comment{Body: body})
+	record := auditRecord{Action: actionComment, Key: issue.Key, Request: body}
+	if addComment != nil {
+		record.CommentID = addComment.ID
+	}
+	j.record(record, start, response, err)
+	if err != nil {
+		logError(err, response)
+		return fmt.Errorf("could not comment issue %s: %w", issue.Key, err)
+	}
+	logEntry(issue.Key, issue.Fields.Summary).Infof("Created comment %s", addComment.ID)
+	return nil
+}
+
+// createLink links the issues or plans the link.
+func (j junit2jira) createLink(outward, inward string) error {
+	if j.plan != nil {
+		log.WithField("ID", outward).Debugf("Dry run: will just print link to %s", inward)
+		j.plan.add(planAction{Action: actionLink, Key: outward, LinkType: j.linkType, LinkTo: inward})
+		return nil
+	}
+	start := time.Now()
+	response, err := j.jiraClient.Issue.AddLink(&jira.IssueLink{
+		Type:         jira.IssueLinkType{Name: j.linkType},
+		OutwardIssue: &jira.Issue{Key: outward},
+		InwardIssue:  &jira.Issue{Key: inward},
+	})
+	j.record(auditRecord{Action: actionLink, Key: outward, LinkType: j.linkType, LinkTo: inward, Request: fmt.Sprintf("%s -[%s]-> %s", outward, j.linkType, inward)}, start, response, err)
+	if err != nil {
+		logError(err, response)
+		return fmt.Errorf("could not link %s to %s: %w", outward, inward, err)
+	}
+	log.WithField("ID", outward).Debugf("Created link to %s", inward)
+	return nil
+}
+
+// updateIssue sets the issue fields or plans the update.
+func (j junit2jira) updateIssue(key string, fields map[string]any) error {
+	if j.plan != nil {
+		log.WithField("ID", key).Debugf("Dry run: will just update fields %v", fields)
+		j.plan.add(planAction{Action: actionUpdate, Key: key, Fields: fields})
+		return nil
+	}
+	start := time.Now()
+	response, err := j.jiraClient.Issue.UpdateIssue(key, map[string]any{"fields": fields})
+	j.record(auditRecord{Action: actionUpdate, Key: key, Request: fieldNames(fields)}, start, response, err)
+	if err != nil {
+		logError(err, response)
+		return fmt.Errorf("could not update %s: %w", key, err)
+	}
+	return nil
+}
+
+// editComment replaces the comment body or plans it.
+func (j junit2jira) editComment(key, id, body string) error {
+	if j.plan != nil {
+		log.WithField("ID", key).Debugf("Dry run: will just edit comment %s:\n%q", id, body)
+		j.plan.add(planAction{Action: actionEdit, Key: key, CommentID: id, Comment: body})
+		return nil
+	}
+	start := time.Now()
+	_, response, err := j.jiraClient.Issue.UpdateComment(key, &jira.Comment{ID: id, Body: body})
+	j.record(auditRecord{Action: actionEdit, Key: key, CommentID: id, Request: body}, start, response, err)
+	if err != nil {
+		logError(err, response)
+		return fmt.Errorf("could not edit comment %s of %s: %w", id, key, err)
+	}
+	log.WithField("ID", key).Infof("Edited comment %s", id)
+	return nil
+}
+
+// transitionIssue moves the issue with the transition of the given name or target status, or plans it.
+func (j junit2jira) transitionIssue(key, name string) error {
+	if j.plan != nil {
+		log.WithField("ID", key).Debugf("Dry run: will just transition to %s", name)
+		j.plan.add(planAction{Action: actionTransition, Key: key, Transition: name})
+		return nil
+	}
+	t, err := j.findTransition(key, name)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	response, err := j.jiraClient.Issue.DoTransition(key, t.ID)
+	j.record(auditRecord{Action: actionTransition, Key: key, Request: t.Name + " to " + t.To.Name}, start, response, err)
+	if err != nil {
+		logError(err, response)
+		return fmt.Errorf("could not transition %s to %s: %w", key, name, err)
+	}
+	log.WithField("ID", key).Infof("Transitioned to %s", t.To.Name)
+	return nil
+}
+
+// findTransition returns the transition of the issue with the name or target status.
+func (j junit2jira) findTransition(key, name string) (jira.Transition, error) {
+	transitions, response, err := j.jiraClient.Issue.GetTransitions(key)
+	if err != nil {
+		logError(err, response)
+		return jira.Transition{}, fmt.Errorf("could not get transitions of %s: %w", key, err)
+	}
+	names := make([]string, 0, len(transitions))
+	for _, t := range transitions {
+		if strings.EqualFold(t.Name, name) || strings.EqualFold(t.To.Name, name) {
+			return t, nil
+		}
+		names = append(names, t.Name)
+	}
+	return jira.Transition{}, fmt.Errorf("could not transition %s: no %s transition, available: %s", key, name, strings.Join(names, ", "))
+}
+
+// addWatcher adds the user to watchers of the issue or plans it.
+func (j junit2jira) addWatcher(key, user string) error {
+	if j.plan != nil {
+		log.WithField("ID", key).Debugf("Dry run: will just add watcher %s", user)
+		j.plan.add(planAction{Action: actionWatch, Key: key, Watcher: user})
+		return nil
+	}
+	start := time.Now()
+	response, err := j.jiraClient.Issue.AddWatcher(key, user)
+	j.record(auditRecord{Action: actionWatch, Key: key, Request: user}, start, response, err)
+	if err != nil {
+		logError(err, response)
+		return fmt.Errorf("could not add watcher %s to %s: %w", user, key, err)
+	}
+	log.WithField("ID", key).Infof("Added watcher %s", user)
+	return nil
+}
+
+func (j junit2jira) writePlan() error {
+	if j.planOutput == "" || j.plan == nil {
+		return nil
+	}
+	out := os.Stdout
+	if j.planOutput != "-" {
+		file, err := os.Create(j.planOutput)
+		if err != nil {
+			return fmt.Errorf("could not create file %s: %w", j.planOutput, err)
+		}
+		out = file
+		defer file.Close()
+	}
+	if j.planFormat == planFormatText {
+		return j.plan.writeText(out)
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(j.plan)
+}
+
+func (p *plan) writeText(out io.Writer) error {
+	if len(p.Actions) == 0 {
+		_, err := fmt.Fprintln(out, "No changes.")
+		return err
+	}
+	for _, a := range p.Actions {
+		var err error
+		switch a.Action {
+		case actionCreate:
+			_, err = fmt.Fprintf(out, "create %s %s in %s: %s\n%s\n\n", a.Issue.Fields.Type.Name, a.Key, a.Issue.Fields.Project.Key, a.Issue.Fields.Summary, indent(a.Issue.Fields.Description))
+		case actionComment:
+			_, err = fmt.Fprintf(out, "comment %s:\n%s\n\n", a.Key, indent(a.Comment))
+		case actionLink:
+			_, err = fmt.Fprintf(out, "link %s -[%s]-> %s\n\n", a.Key, a.LinkType, a.LinkTo)
+		case actionUpdate:
+			fields, _ := json.Marshal(a.Fields)
+			_, err = fmt.Fprintf(out, "update %s: %s\n\n", a.Key, fields)
+		case actionTransition:
+			_, err = fmt.Fprintf(out, "transition %s to %s\n\n", a.Key, a.Transition)
+		case actionEdit:
+			_, err = fmt.Fprintf(out, "edit comment %s of %s:\n%s\n\n", a.CommentID, a.Key, indent(a.Comment))
+		case actionWatch:
+			_, err = fmt.Fprintf(out, "watch %s by %s\n\n", a.Key, a.Watcher)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func indent(s string) string {
+	return "    " + strings.ReplaceAll(strings.TrimSpace(s), "\n", "\n    ")
+}
+
+// apply executes the planned actions, replacing planned keys with keys of created issues.
+func (p *plan) apply(j junit2jira) error {
+	keys := make(map[string]string)
+	resolve := func(key string) string {
+		if k, ok := keys[key]; ok {
+			return k
+		}
+		return key
+	}
+	var result error
+	for _, a := range p.Actions {
+		if a.Action != actionCreate && (isPlannedKey(resolve(a.Key)) || isPlannedKey(resolve(a.LinkTo))) {
+			result = multierror.Append(result, fmt.Errorf("%s of %s skipped: issue it depends on was not created", a.Action, a.Key))
+			continue
+		}
+		var err error
+		switch a.Action {
+		case actionCreate:
+			a.Issue.Key = ""
+			if a.Issue.Fields.Parent != nil {
+				a.Issue.Fields.Parent.Key = resolve(a.Issue.Fields.Parent.Key)
+			}
+			err = j.createIssue(a.Issue)
+			if err == nil {
+				logEntry(a.Issue.Key, a.Issue.Fields.Summary).Info("Created new issue")
+				keys[a.Key] = a.Issue.Key
+			}
+		case actionComment:
+			// Plans applied again do not comment failures twice, comments without a marker cannot be told apart.
+			if marker := failureMarker.FindString(a.Comment); marker != "" {
+				var issue *jira.Issue
+				issue, err = j.getRecordedIssue(resolve(a.Key))
+				if err != nil {
+					break
+				}
+				if isRecorded(issue, marker) {
+					log.WithField("ID", issue.Key).Debugf("Failure %s is already recorded", marker)
+					break
+				}
+			}
+			err = j.addComment(&jira.Issue{Key: resolve(a.Key), Fields: &jira.IssueFields{}}, a.Comment)
+		case actionLink:
+			var issue *jira.Issue
+			issue, err = j.getRecordedIssue(resolve(a.Key))
+			if err != nil {
+				break
+			}
+			if isLinked(issue, resolve(a.LinkTo), a.LinkType) {
+				log.WithField("ID", issue.Key).Debugf("Link to %s is already recorded", resolve(a.LinkTo))
+				break
+			}
+			j.linkType = a.LinkType
+			err = j.createLink(issue.Key, resolve(a.LinkTo))
+		case actionUpdate:
+			for field, value := range a.Fields {
+				if v, ok := value.(map[string]any); ok && v["key"] != nil {
+					v["key"] = resolve(fmt.Sprint(v["key"]))
+				} else if s, ok := value.(string); ok {
+					a.Fields[field] = resolve(s)
+				}
+			}
+			err = j.updateIssue(resolve(a.Key), a.Fields)
+		case actionTransition:
+			err = j.transitionIssue(resolve(a.Key), a.Transition)
+		case actionEdit:
+			err = j.editComment(resolve(a.Key), a.CommentID, a.Comment)
+		case actionWatch:
+			err = j.addWatcher(resolve(a.Key), a.Watcher)
+		default:
+			err = fmt.Errorf("unknown action %q", a.Action)
+		}
+		if err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+	return result
+}
+
+// getRecordedIssue gets the issue with the fields telling which failures and links it already has.
+func (j junit2jira) getRecordedIssue(key string) (*jira.Issue, error) {
+	issue, response, err := j.jiraClient.Issue.Get(key, &jira.GetQueryOptions{Fields: recordedIssueFields})
+	if err != nil {
+		logError(err, response)
+		return nil, fmt.Errorf("could not get %s: %w", key, err)
+	}
+	return issue, nil
+}
+
+func applyCommand(name string, args []string) error {
+	fs := newFlagSet(name, "Make the Jira changes recorded by plan.")
+	var planFile, jiraUrl, auditFile string
+	f := &runFlags{}
+	fs.StringVar(&planFile, "plan", "", "Plan file created with the plan command (use dash [-] for stdin)")
+	fs.StringVar(&jiraUrl, "jira-url", "", "Url of JIRA instance (defaults to the one the plan was created for)")
+	fs.StringVar(&auditFile, "audit-log", "", "Append every change made to Jira as a JSON line to this file.")
+	addLogFlags(fs, f)
+	_ = fs.Parse(args)
+
+	f.configureLog()
+	if planFile == "" {
+		return withExitCode(exitInputError, fmt.Errorf("plan file is required"))
+	}
+
+	in := os.Stdin
+	if planFile != "-" {
+		file, err := os.Open(planFile)
+		if err != nil {
+			return withExitCode(exitInputError, fmt.Errorf("could not open plan %s: %w", planFile, err))
+		}
+		defer file.Close()
+		in = file
+	}
+	p := &plan{}
+	if err := json.NewDecoder(in).Decode(p); err != nil {
+		return withExitCode(exitInputError, fmt.Errorf("could not read plan %s: %w", planFile, err))
+	}
+	if jiraUrl == "" {
+		jiraUrl = p.JiraUrl
+	}
+	u, err := url.Parse(jiraUrl)
+	if err != nil {
+		return withExitCode(exitInputError, err)
+	}
+
+	jiraParams := params{jiraUrl: u, BuildId: p.BuildId}
+	jiraClient, err := newJiraClient(jiraParams)
+	if err != nil {
+		return err
+	}
+	audit, err := openAuditLog(auditFile)
+	if err != nil {
+		return withExitCode(exitInputError, err)
+	}
+	defer audit.Close()
+	return withExitCode(exitJiraErrors, p.apply(junit2jira{params: jiraParams, jiraClient: jiraClient, audit: audit}))
+}
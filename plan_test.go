@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/janisz/junit2jira/fakejira"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlan(t *testing.T) {
+	existing := testCase{Name: "TestExisting", Suite: "suite"}
+	existingSummary, err := existing.summary()
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/rest/api/2/search":
+			writeJSON(t, w, map[string][]jira.Issue{"issues": {
+				{ID: "1", Key: "ROX-1", Fields: &jira.IssueFields{Summary: existingSummary}},
+			}})
+		case r.Method == http.MethodGet && r.URL.Path == "/rest/api/2/issue/ROX-1":
+			writeJSON(t, w, jira.Issue{ID: "1", Key: "ROX-1", Fields: &jira.IssueFields{Summary: existingSummary}})
+		default:
+			t.Errorf("plan must not change Jira: %s %s", r.Method, r.URL)
+		}
+	}))
+	defer server.Close()
+
+	client, err := jira.NewClient(nil, server.URL)
+	require.NoError(t, err)
+	j := junit2jira{
+		params:     params{jiraProject: "ROX", linkStrategy: linkMesh, linkType: "Related"},
+		jiraClient: client,
+		plan:       &plan{JiraUrl: server.URL},
+	}
+
+	issues, err := j.createIssuesOrComments([]testCase{{Name: "TestNew", Suite: "suite", Message: "boom"}, existing}, "")
+	require.NoError(t, err)
+	require.Len(t, issues, 2)
+	assert.Equal(t, "PLANNED-1", issues[0].issue.Key)
+	assert.Equal(t, outcomePlanned, issues[0].outcome)
+	assert.Equal(t, "ROX-1", issues[1].issue.Key)
+	assert.Equal(t, outcomeCommented, issues[1].outcome)
+	require.NoError(t, j.linkIssues([]*jira.Issue{issues[0].issue, issues[1].issue}, nil))
+
+	require.Len(t, j.plan.Actions, 3)
+	assert.Equal(t, actionCreate, j.plan.Actions[0].Action)
+	assert.Equal(t, "suite / TestNew FAILED", j.plan.Actions[0].Issue.Fields.Summary)
+	assert.Contains(t, j.plan.Actions[0].Issue.Fields.Description, "boom")
+	assert.Equal(t, planAction{Action: actionComment, Key: "ROX-1", Comment: j.plan.Actions[1].Comment}, j.plan.Actions[1])
+	assert.Equal(t, planAction{Action: actionLink, Key: "ROX-1", LinkType: "Related", LinkTo: "PLANNED-1"}, j.plan.Actions[2])
+
+	buf := bytes.NewBufferString("")
+	require.NoError(t, (&plan{Actions: j.plan.Actions[1:]}).writeText(buf))
+	assert.Equal(t, "comment ROX-1:\n"+indent(j.plan.Actions[1].Comment)+"\n\nlink ROX-1 -[Related]-> PLANNED-1\n\n", buf.String())
+
+	buf = bytes.NewBufferString("")
+	require.NoError(t, (&plan{}).writeText(buf))
+	assert.Equal(t, "No changes.\n", buf.String())
+}
+
+func TestApplyPlan(t *testing.T) {
+	p := &plan{Actions: []planAction{
+		{Action: actionCreate, Key: "PLANNED-1", Issue: newIssue("ROX", "run", "run description")},
+		{Action: actionCreate, Key: "PLANNED-2", Issue: newSubTask("ROX", "PLANNED-1", "summary", "description")},
+		{Action: actionComment, Key: "ROX-1", Comment: "comment"},
+		{Action: actionLink, Key: "PLANNED-2", LinkType: "Related", LinkTo: "ROX-1"},
+		{Action: actionUpdate, Key: "ROX-1", Fields: map[string]any{"parent": map[string]any{"key": "PLANNED-1"}}},
+	}}
+	// Plans are applied from files, so make sure the plan survives a round trip.
+	b, err := json.Marshal(p)
+	require.NoError(t, err)
+	p = &plan{}
+	require.NoError(t, json.Unmarshal(b, p))
+
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			writeJSON(t, w, jira.Issue{Key: strings.TrimPrefix(r.URL.Path, "/rest/api/2/issue/"), Fields: &jira.IssueFields{}})
+			return
+		}
+		body := map[string]any{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		b, err := json.Marshal(body)
+		require.NoError(t, err)
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+string(b))
+		switch r.URL.Path {
+		case "/rest/api/2/issue":
+			w.WriteHeader(http.StatusCreated)
+			writeJSON(t, w, jira.Issue{Key: "ROX-" + []string{"10", "11"}[len(requests)-1]})
+		case "/rest/api/2/issue/ROX-1/comment":
+			writeJSON(t, w, jira.Comment{ID: "1"})
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	client, err := jira.NewClient(nil, server.URL)
+	require.NoError(t, err)
+	require.NoError(t, p.apply(junit2jira{jiraClient: client}))
+
+	require.Len(t, requests, 5)
+	assert.Contains(t, requests[0], "POST /rest/api/2/issue ")
+	assert.NotContains(t, requests[0], "PLANNED")
+	assert.Contains(t, requests[1], `"parent":{"key":"ROX-10"}`)
+	assert.Contains(t, requests[2], `POST /rest/api/2/issue/ROX-1/comment `)
+	assert.Contains(t, requests[2], `"body":"comment"`)
+	assert.Contains(t, requests[3], `POST /rest/api/2/issueLink {"inwardIssue":{"key":"ROX-1"},"outwardIssue":{"key":"ROX-11"}`)
+	assert.Equal(t, `PUT /rest/api/2/issue/ROX-1 {"fields":{"parent":{"key":"ROX-10"}}}`, requests[4])
+}
+
+func TestApplyPlanSkipsDependentActions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	client, err := jira.NewClient(nil, server.URL)
+	require.NoError(t, err)
+	p := &plan{Actions: []planAction{
+		{Action: actionCreate, Key: "PLANNED-1", Issue: newIssue("ROX", "summary", "description")},
+		{Action: actionLink, Key: "PLANNED-1", LinkType: "Related", LinkTo: "ROX-1"},
+	}}
+	err = p.apply(junit2jira{jiraClient: client})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "link of PLANNED-1 skipped")
+}
+
+func TestApplyPlanAgain(t *testing.T) {
+	s, u := newFakeJira(t)
+	s.LinkTypes = []string{"Related"}
+	first := s.AddIssue(fakejira.Issue{Project: "ROX", Type: "Bug", Summary: "first"})
+	second := s.AddIssue(fakejira.Issue{Project: "ROX", Type: "Bug", Summary: "second"})
+	marker := testCase{Name: "TestA", BuildId: "1"}.marker("first")
+	p := &plan{Actions: []planAction{
+		{Action: actionComment, Key: first, Comment: "failed again\n" + marker},
+		{Action: actionLink, Key: first, LinkType: "Related", LinkTo: second},
+	}}
+	client, err := jira.NewClient(nil, u.String())
+	require.NoError(t, err)
+
+	// A plan applied twice, e.g. when a retried CI step applies it again, comments and links once.
+	require.NoError(t, p.apply(junit2jira{jiraClient: client}))
+	require.NoError(t, p.apply(junit2jira{jiraClient: client}))
+	issue, ok := s.Issue(first)
+	require.True(t, ok)
+	assert.Len(t, issue.Comments, 1)
+	assert.Len(t, issue.Links, 1)
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// createdFields are fields set on issues the tool creates, other required fields fail the creation.
+var createdFields = map[string]bool{
+	"project":     true,
+	"issuetype":   true,
+	"summary":     true,
+	"description": true,
+	"labels":      true,
+	"parent":      true,
+}
+
+// checkCommand validates the Jira configuration of report without reading reports or changing Jira.
+func checkCommand(name string, args []string) error {
+	fs := newFlagSet(name, "Validate projects, issue types, required fields, link types and priorities in Jira before reporting.")
+	p := params{}
+	f := addRunFlags(fs, &p)
+	_ = fs.Parse(args)
+	f.apply(&p)
+
+	jiraClient, err := newJiraClient(p)
+	if err != nil {
+		return err
+	}
+	j := junit2jira{params: p, jiraClient: jiraClient}
+	if err := j.preflight(); err != nil {
+		return err
+	}
+	log.Infof("Jira configuration of %s is valid", p.jiraUrl)
+	return nil
+}
+
+// issueTypeRequirement is an issue type the tool creates issues of in a project.
+type issueTypeRequirement struct {
+	project   string
+	issueType string
+	// reason tells which flag needs the issue type.
+	reason string
+}
+
+// requiredIssueTypes lists issue types the configuration creates issues of, by project.
+func (j junit2jira) requiredIssueTypes() []issueTypeRequirement {
+	required := []issueTypeRequirement{{j.jiraProject, defaultIssueType, "-jira-project"}}
+	for _, r := range j.routes {
+		required = append(required, issueTypeRequirement{r.project, r.issueType, "-routing"})
+	}
+	if j.needsRunIssue() {
+		required = append(required, issueTypeRequirement{j.jiraProject, j.runIssueType, "-run-issue-type"})
+	}
+	if j.linkStrategy == linkParent && j.runIssueType != epicIssueType {
+		required = append(required, issueTypeRequirement{j.jiraProject, "Sub-task", "-link-strategy=" + linkParent})
+	}
+	if j.mergeStrategy == mergeUmbrella {
+		required = append(required, issueTypeRequirement{j.jiraProject, "Sub-task", "-merge-strategy=" + mergeUmbrella})
+	}
+	return required
+}
+
+// needsLinkType tells if the link strategy links issues with -link-type.
+func (j junit2jira) needsLinkType() bool {
+	return j.linkStrategy != linkNone && !(j.linkStrategy == linkParent && j.runIssueType == epicIssueType)
+}
+
+// preflight validates projects, issue types, their required fields and labels, the link type and priorities
+// of escalation rules with Jira metadata, so a misconfiguration fails before anything is changed instead of with a 400 mid-run.
+func (j junit2jira) preflight() error {
+	var problems error
+	required := j.requiredIssueTypes()
+	meta, err := j.createMeta(required)
+	if err != nil {
+		return err
+	}
+	for _, r := range required {
+		if err := checkIssueType(meta, r); err != nil {
+			problems = multierror.Append(problems, err)
+		}
+	}
+
+	if j.needsLinkType() {
+		types, err := j.linkTypes()
+		if err != nil {
+			return err
+		}
+		if err := checkLinkType(types, j.linkType); err != nil {
+			problems = multierror.Append(problems, err)
+		}
+	}
+	if priorities := j.escalationPriorities(); len(priorities) > 0 {
+		list, response, err := j.jiraClient.Priority.GetList()
+		if err != nil {
+			logError(err, response)
+			return fmt.Errorf("could not get priorities: %w", err)
+		}
+		for _, p := range priorities {
+			if err := checkPriority(list, p); err != nil {
+				problems = multierror.Append(problems, err)
+			}
+		}
+	}
+	return withExitCode(exitInputError, problems)
+}
+
+// escalationPriorities lists priorities -escalate rules set.
+func (j junit2jira) escalationPriorities() []string {
+	var priorities []string
+	for _, r := range j.escalations {
+		if r.action == escalatePriority {
+			priorities = appendUnique(priorities, r.value)
+		}
+	}
+	return priorities
+}
+
+// checkPriority checks that the priority exists.
+func checkPriority(priorities []jira.Priority, name string) error {
+	names := make([]string, 0, len(priorities))
+	for _, p := range priorities {
+		if p.Name == name {
+			return nil
+		}
+		names = append(names, p.Name)
+	}
+	return errors.Errorf("priority %q (-escalate) does not exist, use one of: %s", name, strings.Join(names, ", "))
+}
+
+// createMeta gets issue types of the projects with fields of the required ones. It uses the createmeta endpoints
+// per project of Jira 8.4 and later, and the deprecated GetCreateMeta, removed in Jira 9, when they are not found.
+func (j junit2jira) createMeta(required []issueTypeRequirement) (*jira.CreateMetaInfo, error) {
+	var projects []string
+	for _, r := range required {
+		projects = appendUnique(projects, r.project)
+	}
+	meta := &jira.CreateMetaInfo{}
+	for _, key := range projects {
+		project, response, err := j.projectCreateMeta(key, required)
+		if response != nil && response.StatusCode == http.StatusNotFound {
+			log.WithError(err).Debugf("Could not get create metadata of %s per project, trying the deprecated endpoint", key)
+			legacy, response, err := j.jiraClient.Issue.GetCreateMeta(key)
+			if response != nil && response.StatusCode == http.StatusNotFound {
+				// Neither endpoint knows the project, it is reported as missing.
+				continue
+			}
+			if err != nil {
+				logError(err, response)
+				return nil, fmt.Errorf("could not get create metadata of %s: %w", key, err)
+			}
+			meta.Projects = append(meta.Projects, legacy.Projects...)
+			continue
+		}
+		if err != nil {
+			logError(err, response)
+			return nil, fmt.Errorf("could not get create metadata of %s: %w", key, err)
+		}
+		meta.Projects = append(meta.Projects, project)
+	}
+	return meta, nil
+}
+
+// projectCreateMeta gets issue types of the project with fields of the required ones.
+func (j junit2jira) projectCreateMeta(key string, required []issueTypeRequirement) (*jira.MetaProject, *jira.Response, error) {
+	path := "rest/api/2/issue/createmeta/" + url.PathEscape(key) + "/issuetypes"
+	project := &jira.MetaProject{Key: key}
+	response, err := j.createMetaPages(path, func(value json.RawMessage) error {
+		issueType := &jira.MetaIssueType{}
+		project.IssueTypes = append(project.IssueTypes, issueType)
+		return json.Unmarshal(value, issueType)
+	})
+	if err != nil {
+		return nil, response, err
+	}
+	for _, r := range required {
+		issueType := project.GetIssueTypeWithName(r.issueType)
+		if r.project != key || issueType == nil || issueType.Fields != nil {
+			continue
+		}
+		issueType.Fields = map[string]any{}
+		response, err := j.createMetaPages(path+"/"+url.PathEscape(issueType.Id), func(value json.RawMessage) error {
+			field := struct {
+				FieldID         string `json:"fieldId"`
+				Name            string `json:"name"`
+				Required        bool   `json:"required"`
+				HasDefaultValue bool   `json:"hasDefaultValue"`
+			}{}
+			if err := json.Unmarshal(value, &field); err != nil {
+				return err
+			}
+			issueType.Fields[field.FieldID] = map[string]any{"name": field.Name, "required": field.Required, "hasDefaultValue": field.HasDefaultValue}
+			return nil
+		})
+		if err != nil {
+			return nil, response, err
+		}
+	}
+	return project, nil, nil
+}
+
+// createMetaPage is a page of the createmeta endpoints per project. Jira Server and Data Center list values,
+// Jira Cloud lists issue types and fields.
+type createMetaPage struct {
+	Total      int               `json:"total"`
+	IsLast     bool              `json:"isLast"`
+	Values     []json.RawMessage `json:"values"`
+	IssueTypes []json.RawMessage `json:"issueTypes"`
+	Fields     []json.RawMessage `json:"fields"`
+}
+
+// createMetaPages calls add with values of all pages of the createmeta endpoint.
+func (j junit2jira) createMetaPages(path string, add func(json.RawMessage) error) (*jira.Response, error) {
+	startAt := 0
+	for {
+		req, err := j.jiraClient.NewRequest(http.MethodGet, fmt.Sprintf("%s?startAt=%d", path, startAt), nil)
+		if err != nil {
+			return nil, err
+		}
+		page := createMetaPage{}
+		response, err := j.jiraClient.Do(req, &page)
+		if err != nil {
+			return response, err
+		}
+		values := append(append(page.Values, page.IssueTypes...), page.Fields...)
+		for _, v := range values {
+			if err := add(v); err != nil {
+				return response, err
+			}
+		}
+		startAt += len(values)
+		if page.IsLast || len(values) == 0 || startAt >= page.Total {
+			return response, nil
+		}
+	}
+}
+
+// checkIssueType checks that issues of the type can be created in the project with fields the tool sets.
+func checkIssueType(meta *jira.CreateMetaInfo, r issueTypeRequirement) error {
+	project := meta.GetProjectWithKey(r.project)
+	if project == nil {
+		return errors.Errorf("project %s (%s) does not exist or you cannot create issues in it", r.project, r.reason)
+	}
+	issueType := project.GetIssueTypeWithName(r.issueType)
+	if issueType == nil {
+		names := make([]string, 0, len(project.IssueTypes))
+		for _, t := range project.IssueTypes {
+			names = append(names, t.Name)
+		}
+		return errors.Errorf("project %s has no issue type %q (%s), use one of: %s", r.project, r.issueType, r.reason, strings.Join(names, ", "))
+	}
+
+	var missing []string
+	for key := range issueType.Fields {
+		if createdFields[key] {
+			continue
+		}
+		required, _ := issueType.Fields.Bool(key + "/required")
+		hasDefault, _ := issueType.Fields.Bool(key + "/hasDefaultValue")
+		if required && !hasDefault {
+			name, _ := issueType.Fields.String(key + "/name")
+			missing = append(missing, fmt.Sprintf("%s (%s)", name, key))
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return errors.Errorf("%s issues of project %s require fields junit2jira does not set: %s; make them optional or give them a default value", r.issueType, r.project, strings.Join(missing, ", "))
+	}
+	if _, ok := issueType.Fields["labels"]; !ok {
+		return errors.Errorf("%s issues of project %s cannot be labeled; add the Labels field to the create screen, issues are found by their labels", r.issueType, r.project)
+	}
+	return nil
+}
+
+// linkTypes lists issue link types. IssueLinkType.GetList expects a list, but Jira wraps it in an object.
+func (j junit2jira) linkTypes() ([]jira.IssueLinkType, error) {
+	req, err := j.jiraClient.NewRequest(http.MethodGet, "rest/api/2/issueLinkType", nil)
+	if err != nil {
+		return nil, err
+	}
+	list := struct {
+		IssueLinkTypes []jira.IssueLinkType `json:"issueLinkTypes"`
+	}{}
+	response, err := j.jiraClient.Do(req, &list)
+	if err != nil {
+		logError(err, response)
+		return nil, fmt.Errorf("could not get issue link types: %w", err)
+	}
+	return list.IssueLinkTypes, nil
+}
+
+// checkLinkType checks that the link type exists.
+func checkLinkType(types []jira.IssueLinkType, name string) error {
+	names := make([]string, 0, len(types))
+	for _, t := range types {
+		if t.Name == name {
+			return nil
+		}
+		names = append(names, t.Name)
+	}
+	return errors.Errorf("link type %q (-link-type) does not exist, use one of: %s", name, strings.Join(names, ", "))
+}
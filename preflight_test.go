@@ -0,0 +1,75 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreflight(t *testing.T) {
+	s, u := newFakeJira(t)
+	s.Projects = []string{"ROX", "SENSOR"}
+	args := []string{"-jira-url", u.String(), "-jira-project", "ROX", "-link-strategy", linkParent}
+	require.NoError(t, checkCommand("check", args))
+
+	dir := writeFiles(t, t.TempDir(), map[string][]byte{
+		"routing.csv": []byte("*, *sensor*, *, *, SENSOR, Incident\n*, *central*, *, *, CENTRAL\n"),
+	})
+	err := checkCommand("check", append(args, "-routing", filepath.Join(dir, "routing.csv"), "-link-strategy", linkMesh, "-link-type", "Relates"))
+	require.Error(t, err)
+	assert.Equal(t, exitInputError, exitCode(err))
+	assert.Contains(t, err.Error(), `project SENSOR has no issue type "Incident" (-routing), use one of: Bug, Task, Story, Epic, Sub-task`)
+	assert.Contains(t, err.Error(), "project CENTRAL (-routing) does not exist or you cannot create issues in it")
+	assert.Contains(t, err.Error(), `link type "Relates" (-link-type) does not exist, use one of: Related, Blocks, Duplicate, Cloners`)
+
+	// Jira before 8.4 has create metadata of all projects at a deprecated endpoint only.
+	s.LegacyCreateMeta = true
+	legacyErr := checkCommand("check", append(args, "-routing", filepath.Join(dir, "routing.csv"), "-link-strategy", linkMesh, "-link-type", "Relates"))
+	assert.Equal(t, err.Error(), legacyErr.Error())
+	s.LegacyCreateMeta = false
+
+	// Priorities set by escalation rules must exist.
+	err = checkCommand("check", append(args, "-link-type", "Related", "-escalate", "3:priority=Critical", "-escalate", "5:priority=Highest"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `priority "Highest" (-escalate) does not exist, use one of: Blocker, Critical, Major, Minor, Trivial`)
+	assert.NotContains(t, err.Error(), `"Critical"`)
+
+	// Epics are not linked, but sub-tasks are created for other CI run issue types.
+	s.IssueTypes = []string{"Bug", "Epic"}
+	require.NoError(t, checkCommand("check", append(args, "-run-issue-type", epicIssueType, "-link-type", "Relates")))
+	err = checkCommand("check", args)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `project ROX has no issue type "Task" (-run-issue-type)`)
+	assert.Contains(t, err.Error(), `project ROX has no issue type "Sub-task" (-link-strategy=parent)`)
+	// Failures merged into an umbrella are its sub-tasks.
+	err = checkCommand("check", append(args, "-run-issue-type", epicIssueType, "-link-type", "Relates", "-merge-strategy", mergeUmbrella))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `project ROX has no issue type "Sub-task" (-merge-strategy=umbrella)`)
+
+	// A report with pre-flight fails before creating any issue.
+	s.RequiredFields = []string{"Component/s"}
+	p := params{
+		jiraUrl:         u,
+		jiraProject:     "ROX",
+		junitReportsDir: "testdata/jira/report.xml",
+		threshold:       10,
+		linkStrategy:    linkNone,
+		preflight:       true,
+	}
+	err = run(p)
+	require.Error(t, err)
+	assert.Equal(t, exitInputError, exitCode(err))
+	assert.Contains(t, err.Error(), "Bug issues of project ROX require fields junit2jira does not set: Component/s (customfield_10000)")
+	assert.Empty(t, s.Issues())
+
+	// Exports are written before pre-flight checks, unless they have issue columns.
+	p.csvOutput = filepath.Join(t.TempDir(), "tests.csv")
+	require.Error(t, run(p))
+	assert.FileExists(t, p.csvOutput)
+	p.csvOutput = filepath.Join(t.TempDir(), "issues.csv")
+	p.csvColumns = []string{"Name", "JiraKey"}
+	require.Error(t, run(p))
+	assert.NoFileExists(t, p.csvOutput)
+}
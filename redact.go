@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	junit "github.com/joshdk/go-junit"
+	"github.com/pkg/errors"
+)
+
+// redactCustom names secrets matched by -redact patterns.
+const redactCustom = "custom"
+
+// detector finds secrets. When the expression has a group, only the group is redacted, so the context is kept.
+type detector struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// builtinDetectors find secrets commonly printed by tests.
+var builtinDetectors = []detector{
+	{"private-key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{"private-key", regexp.MustCompile(`client-key-data:\s*([A-Za-z0-9+/=]{16,})`)},
+	{"jwt", regexp.MustCompile(`eyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`)},
+	{"aws-access-key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"aws-secret-key", regexp.MustCompile(`(?i)aws_secret_access_key["']?\s*[=:]\s*["']?([A-Za-z0-9/+=]{40})`)},
+	{"bearer-token", regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9._~+/-]{8,}=*)`)},
+	{"basic-auth-url", regexp.MustCompile(`\b[A-Za-z][A-Za-z0-9+.-]*://[^/\s:@]+:([^/\s@]+)@`)},
+}
+
+// redactor replaces secrets in test output and counts distinct secrets by detector,
+// so a secret repeated in the message and output of a test is counted once.
+type redactor struct {
+	detectors []detector
+	counts    map[string]int
+	seen      map[string]bool
+}
+
+// newRedactor returns a redactor with builtin detectors and the patterns, or nil when there are none.
+func newRedactor(builtin bool, patterns []string) (*redactor, error) {
+	r := &redactor{counts: map[string]int{}, seen: map[string]bool{}}
+	if builtin {
+		r.detectors = append(r.detectors, builtinDetectors...)
+	}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid redact pattern %q", p)
+		}
+		if re.MatchString("") {
+			return nil, errors.Errorf("invalid redact pattern %q: it matches an empty text", p)
+		}
+		r.detectors = append(r.detectors, detector{redactCustom, re})
+	}
+	if len(r.detectors) == 0 {
+		return nil, nil
+	}
+	return r, nil
+}
+
+// redact replaces secrets in the text with [REDACTED:<detector>].
+func (r *redactor) redact(text string) string {
+	if r == nil || text == "" {
+		return text
+	}
+	for _, d := range r.detectors {
+		matches := d.re.FindAllStringSubmatchIndex(text, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		b := strings.Builder{}
+		last := 0
+		for _, m := range matches {
+			start, end := m[0], m[1]
+			if len(m) >= 4 && m[2] >= 0 {
+				start, end = m[2], m[3]
+			}
+			// Empty groups have no secret to redact.
+			if start == end {
+				continue
+			}
+			if secret := text[start:end]; !r.seen[secret] {
+				r.seen[secret] = true
+				r.counts[d.name]++
+			}
+			b.WriteString(text[last:start])
+			b.WriteString("[REDACTED:" + d.name + "]")
+			last = end
+		}
+		b.WriteString(text[last:])
+		text = b.String()
+	}
+	return text
+}
+
+func (r *redactor) redactError(err error) error {
+	if r == nil || err == nil {
+		return err
+	}
+	if e, ok := err.(junit.Error); ok {
+		e.Message, e.Body = r.redact(e.Message), r.redact(e.Body)
+		return e
+	}
+	return junit.Error{Message: r.redact(err.Error())}
+}
+
+func (r *redactor) redactProperties(properties map[string]string) {
+	for k, v := range properties {
+		properties[k] = r.redact(v)
+	}
+}
+
+// redactSuites redacts output, failures and properties of suites and their tests in place.
+func (r *redactor) redactSuites(suites []junit.Suite) {
+	if r == nil {
+		return
+	}
+	for n := range suites {
+		s := &suites[n]
+		s.SystemOut, s.SystemErr = r.redact(s.SystemOut), r.redact(s.SystemErr)
+		r.redactProperties(s.Properties)
+		for t := range s.Tests {
+			tc := &s.Tests[t]
+			tc.Message = r.redact(tc.Message)
+			tc.SystemOut, tc.SystemErr = r.redact(tc.SystemOut), r.redact(tc.SystemErr)
+			tc.Error = r.redactError(tc.Error)
+			r.redactProperties(tc.Properties)
+		}
+		r.redactSuites(s.Suites)
+	}
+}
+
+// total returns the number of distinct redacted secrets.
+func (r *redactor) total() int {
+	if r == nil {
+		return 0
+	}
+	total := 0
+	for _, c := range r.counts {
+		total += c
+	}
+	return total
+}
+
+// String lists counts of redacted secrets by detector, e.g. 2 jwt, 1 bearer-token.
+func (r *redactor) String() string {
+	names := make([]string, 0, len(r.counts))
+	for name := range r.counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	counts := make([]string, 0, len(names))
+	for _, name := range names {
+		counts = append(counts, fmt.Sprintf("%d %s", r.counts[name], name))
+	}
+	return strings.Join(counts, ", ")
+}
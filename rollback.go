@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	rollbackDelete = "delete"
+	rollbackClose  = "close"
+)
+
+// undo is a change that reverts a change recorded in the audit log.
+type undo struct {
+	record auditRecord
+	// action is what is done: delete or close an issue, delete a comment or link, or skip a change that cannot be undone.
+	action string
+}
+
+func (u undo) String() string {
+	r := u.record
+	switch r.Action {
+	case actionCreate:
+		return fmt.Sprintf("%s %s (%s)", u.action, r.Key, r.Request)
+	case actionComment:
+		return fmt.Sprintf("%s comment %s of %s", u.action, r.CommentID, r.Key)
+	case actionLink:
+		return fmt.Sprintf("%s link %s -[%s]-> %s", u.action, r.Key, r.LinkType, r.LinkTo)
+	}
+	return fmt.Sprintf("%s %s of %s (%s)", u.action, r.Action, r.Key, r.Request)
+}
+
+func rollbackCommand(name string, args []string) error {
+	fs := newFlagSet(name, "Delete or close issues, comments and links created for a build, as recorded in the audit log.")
+	var auditFile, buildId, jiraUrl, issueAction, closeTransition string
+	var dryRun, yes bool
+	f := &runFlags{}
+	fs.StringVar(&auditFile, "audit-log", "", "Audit log written by -audit-log in previous runs.")
+	fs.StringVar(&buildId, "build-id", "", "Build job run ID whose changes are rolled back.")
+	fs.StringVar(&jiraUrl, "jira-url", "", "Url of JIRA instance (defaults to the one changes were recorded for)")
+	fs.StringVar(&issueAction, "issue-action", rollbackClose, "What to do with created issues: "+rollbackClose+" or "+rollbackDelete+" (deletes comments and links added later too)")
+	fs.StringVar(&closeTransition, "close-transition", "Closed", "Name or target status of the transition closing issues with -issue-action=close.")
+	fs.BoolVar(&dryRun, "dry-run", false, "When set to true changes are only listed.")
+	fs.BoolVar(&yes, "yes", false, "Do not ask for confirmation.")
+	addLogFlags(fs, f)
+	_ = fs.Parse(args)
+	f.configureLog()
+
+	if auditFile == "" || buildId == "" {
+		return withExitCode(exitInputError, errors.New("audit log and build ID are required"))
+	}
+	if issueAction != rollbackClose && issueAction != rollbackDelete {
+		return withExitCode(exitInputError, errors.Errorf("unknown issue action %q, use one of: %s, %s", issueAction, rollbackClose, rollbackDelete))
+	}
+	records, err := readAuditLog(auditFile)
+	if err != nil {
+		return withExitCode(exitInputError, errors.Wrapf(err, "could not read audit log %s", auditFile))
+	}
+	records, jiraUrl, err = buildRecords(records, buildId, jiraUrl)
+	if err != nil {
+		return withExitCode(exitInputError, err)
+	}
+	undos := planRollback(records, issueAction)
+	if len(undos) == 0 {
+		log.Infof("No changes of build %s to roll back", buildId)
+		return nil
+	}
+	fmt.Printf("Rolling back %d changes of build %s in %s:\n", len(undos), buildId, jiraUrl)
+	for _, u := range undos {
+		fmt.Println("  " + u.String())
+	}
+	if dryRun {
+		return nil
+	}
+	if !yes && !confirm(os.Stdin, os.Stderr, "Roll back these changes?") {
+		return withExitCode(exitInputError, errors.New("rollback was not confirmed"))
+	}
+
+	u, err := url.Parse(jiraUrl)
+	if err != nil {
+		return withExitCode(exitInputError, err)
+	}
+	p := params{jiraUrl: u, BuildId: buildId, closeTransition: closeTransition}
+	jiraClient, err := newJiraClient(p)
+	if err != nil {
+		return err
+	}
+	j := junit2jira{params: p, jiraClient: jiraClient}
+	return withExitCode(exitJiraErrors, j.rollback(undos))
+}
+
+// buildRecords returns successful changes of the build made in a single Jira instance.
+func buildRecords(records []auditRecord, buildId, jiraUrl string) ([]auditRecord, string, error) {
+	var result []auditRecord
+	urls := map[string]bool{}
+	for _, r := range records {
+		if r.BuildId != buildId || r.Error != "" || jiraUrl != "" && r.JiraUrl != jiraUrl {
+			continue
+		}
+		urls[r.JiraUrl] = true
+		result = append(result, r)
+	}
+	if len(urls) > 1 {
+		return nil, "", errors.Errorf("build %s changed %d Jira instances, use -jira-url to select one", buildId, len(urls))
+	}
+	for u := range urls {
+		jiraUrl = u
+	}
+	return result, jiraUrl, nil
+}
+
+// planRollback lists changes reverting the records, latest first. Comments and links of deleted issues
+// are deleted with them. Updates, transitions, watchers and edited comments cannot be reverted and are skipped.
+func planRollback(records []auditRecord, issueAction string) []undo {
+	deleted := map[string]bool{}
+	if issueAction == rollbackDelete {
+		for _, r := range records {
+			if r.Action == actionCreate {
+				deleted[r.Key] = true
+			}
+		}
+	}
+	var undos []undo
+	for n := len(records) - 1; n >= 0; n-- {
+		r := records[n]
+		switch {
+		case r.Action == actionCreate:
+			undos = append(undos, undo{record: r, action: issueAction})
+		case deleted[r.Key] || r.Action == actionLink && deleted[r.LinkTo]:
+			continue
+		case r.Action == actionComment && r.CommentID != "" || r.Action == actionLink:
+			undos = append(undos, undo{record: r, action: rollbackDelete})
+		default:
+			undos = append(undos, undo{record: r, action: "skip"})
+		}
+	}
+	return undos
+}
+
+// confirm asks the question and tells if it was answered yes.
+func confirm(in io.Reader, out io.Writer, question string) bool {
+	fmt.Fprintf(out, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// rollback reverts the changes. Changes that are already reverted are skipped, so it can be run again after errors.
+func (j junit2jira) rollback(undos []undo) error {
+	var result error
+	for _, u := range undos {
+		var err error
+		switch u.action {
+		case rollbackDelete:
+			err = j.undoDelete(u.record)
+		case rollbackClose:
+			err = j.closeIssue(u.record.Key)
+		default:
+			log.WithField("ID", u.record.Key).Warnf("Cannot roll back %s (%s)", u.record.Action, u.record.Request)
+			continue
+		}
+		if err != nil {
+			result = multierror.Append(result, err)
+			continue
+		}
+		log.WithField("ID", u.record.Key).Info("Rolled back: " + u.String())
+	}
+	return result
+}
+
+func (j junit2jira) undoDelete(r auditRecord) error {
+	var path string
+	switch r.Action {
+	case actionCreate:
+		path = fmt.Sprintf("rest/api/2/issue/%s", r.Key)
+	case actionComment:
+		path = fmt.Sprintf("rest/api/2/issue/%s/comment/%s", r.Key, r.CommentID)
+	case actionLink:
+		id, err := j.findLink(r)
+		if err != nil || id == "" {
+			return err
+		}
+		path = fmt.Sprintf("rest/api/2/issueLink/%s", id)
+	}
+	req, err := j.jiraClient.NewRequest(http.MethodDelete, path, nil)
+	if err != nil {
+		return err
+	}
+	response, err := j.jiraClient.Do(req, nil)
+	if response != nil && response.StatusCode == http.StatusNotFound {
+		log.WithField("ID", r.Key).Debugf("%s is already deleted", path)
+		return nil
+	}
+	if err != nil {
+		logError(err, response)
+		return fmt.Errorf("could not delete %s: %w", path, err)
+	}
+	return nil
+}
+
+// findLink returns the ID of the recorded link, or an empty ID when it does not exist anymore.
+func (j junit2jira) findLink(r auditRecord) (string, error) {
+	issue, response, err := j.jiraClient.Issue.Get(r.Key, &jira.GetQueryOptions{Fields: "issuelinks"})
+	if response != nil && response.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+	if err != nil {
+		logError(err, response)
+		return "", fmt.Errorf("could not get links of %s: %w", r.Key, err)
+	}
+	for _, l := range issue.Fields.IssueLinks {
+		if l == nil || l.Type.Name != r.LinkType {
+			continue
+		}
+		if (l.OutwardIssue != nil && l.OutwardIssue.Key == r.LinkTo) || (l.InwardIssue != nil && l.InwardIssue.Key == r.LinkTo) {
+			return l.ID, nil
+		}
+	}
+	return "", nil
+}
+
+// closeIssue transitions the issue with -close-transition unless it is already in the target status.
+func (j junit2jira) closeIssue(key string) error {
+	issue, response, err := j.jiraClient.Issue.Get(key, &jira.GetQueryOptions{Fields: "status"})
+	if response != nil && response.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if err != nil {
+		logError(err, response)
+		return fmt.Errorf("could not get issue %s: %w", key, err)
+	}
+	if issue.Fields.Status != nil && strings.EqualFold(issue.Fields.Status.Name, j.closeTransition) {
+		return nil
+	}
+	return j.transitionIssue(key, j.closeTransition)
+}
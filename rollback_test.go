@@ -0,0 +1,111 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/janisz/junit2jira/fakejira"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRollback(t *testing.T) {
+	defer func(length int) { maxSummaryLength = length }(maxSummaryLength)
+	maxSummaryLength = 200
+	s, u := newFakeJira(t)
+	existing, err := testCase{
+		Suite: "github.com/stackrox/rox/sensor/kubernetes/localscanner",
+		Name:  "TestLocalScannerTLSIssuerIntegrationTests",
+	}.summary()
+	require.NoError(t, err)
+	existingKey := s.AddIssue(fakejira.Issue{Project: "ROX", Type: "Bug", Summary: existing, Labels: []string{"CI_Failure"},
+		Comments: []fakejira.Comment{{ID: "1", Body: "reported by hand"}}})
+
+	auditFile := filepath.Join(t.TempDir(), "audit.jsonl")
+	p := params{
+		jiraUrl:         u,
+		jiraProject:     "ROX",
+		junitReportsDir: "testdata/jira/report.xml",
+		BuildId:         "1",
+		threshold:       10,
+		linkStrategy:    linkStar,
+		linkType:        "Related",
+		runIssueType:    "Task",
+		auditLog:        auditFile,
+	}
+	require.NoError(t, run(p))
+	before := s.Issues()
+	require.Greater(t, len(before), 2)
+
+	args := []string{"-audit-log", auditFile, "-yes"}
+	require.NoError(t, rollbackCommand("rollback", append(args, "-build-id", "1", "-dry-run")))
+	assert.Equal(t, before, s.Issues())
+	require.NoError(t, rollbackCommand("rollback", append(args, "-build-id", "3")))
+	assert.Equal(t, before, s.Issues())
+
+	// Created issues are deleted with their links, comments added to existing issues are deleted.
+	require.NoError(t, rollbackCommand("rollback", append(args, "-build-id", "1", "-issue-action", "delete")))
+	issues := s.Issues()
+	require.Len(t, issues, 1)
+	assert.Equal(t, existingKey, issues[0].Key)
+	assert.Empty(t, issues[0].Links)
+	require.Len(t, issues[0].Comments, 1)
+	assert.Equal(t, "reported by hand", issues[0].Comments[0].Body)
+	// Changes already rolled back are skipped.
+	require.NoError(t, rollbackCommand("rollback", append(args, "-build-id", "1", "-issue-action", "delete")))
+
+	// Closed issues keep comments, but links between issues are deleted.
+	p.BuildId = "2"
+	p.linkStrategy = linkMesh
+	require.NoError(t, run(p))
+	require.NoError(t, rollbackCommand("rollback", append(args, "-build-id", "2")))
+	for _, i := range s.Issues() {
+		assert.Empty(t, i.Links)
+		if i.Key == existingKey {
+			assert.Equal(t, fakejira.StatusOpen, i.Status)
+			assert.Len(t, i.Comments, 1)
+		} else {
+			assert.Equal(t, fakejira.StatusClosed, i.Status)
+		}
+	}
+	require.NoError(t, rollbackCommand("rollback", append(args, "-build-id", "2")))
+
+	err = rollbackCommand("rollback", []string{"-audit-log", auditFile})
+	assert.Equal(t, exitInputError, exitCode(err))
+}
+
+func TestPlanRollback(t *testing.T) {
+	records := []auditRecord{
+		{Action: actionCreate, Key: "ROX-2", Request: "Bug in ROX: test"},
+		{Action: actionComment, Key: "ROX-1", CommentID: "10"},
+		{Action: actionComment, Key: "ROX-2", CommentID: "11"},
+		{Action: actionLink, Key: "ROX-1", LinkType: "Related", LinkTo: "ROX-2"},
+		{Action: actionUpdate, Key: "ROX-1", Request: "fields: labels"},
+	}
+	var actual []string
+	for _, u := range planRollback(records, rollbackDelete) {
+		actual = append(actual, u.String())
+	}
+	assert.Equal(t, []string{
+		"skip update of ROX-1 (fields: labels)",
+		"delete comment 10 of ROX-1",
+		"delete ROX-2 (Bug in ROX: test)",
+	}, actual)
+
+	actual = nil
+	for _, u := range planRollback(records, rollbackClose) {
+		actual = append(actual, u.String())
+	}
+	assert.Equal(t, []string{
+		"skip update of ROX-1 (fields: labels)",
+		"delete link ROX-1 -[Related]-> ROX-2",
+		"delete comment 11 of ROX-2",
+		"delete comment 10 of ROX-1",
+		"close ROX-2 (Bug in ROX: test)",
+	}, actual)
+
+	assert.True(t, confirm(strings.NewReader("y\n"), &strings.Builder{}, "Roll back?"))
+	assert.False(t, confirm(strings.NewReader("\n"), &strings.Builder{}, "Roll back?"))
+	assert.False(t, confirm(strings.NewReader(""), &strings.Builder{}, "Roll back?"))
+}
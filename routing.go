@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/pkg/errors"
+)
+
+// defaultIssueType is the type of issues of failed tests.
+const defaultIssueType = "Bug"
+
+// route sends failures matching all patterns to the project, as issues of the type.
+type route struct {
+	suite        *regexp.Regexp
+	classname    *regexp.Regexp
+	job          *regexp.Regexp
+	orchestrator *regexp.Regexp
+	project      string
+	issueType    string
+}
+
+func (r route) matches(tc testCase) bool {
+	return r.suite.MatchString(tc.suiteName) &&
+		r.classname.MatchString(tc.Suite) &&
+		r.job.MatchString(tc.JobName) &&
+		r.orchestrator.MatchString(tc.Orchestrator)
+}
+
+// loadRoutes reads routing rules, a CSV file with suite, classname, job name and orchestrator
+// patterns, project and an optional issue type on each line.
+func loadRoutes(file string) ([]route, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	routes := make([]route, 0, len(rows))
+	for n, row := range rows {
+		if len(row) != 5 && len(row) != 6 {
+			return nil, errors.Errorf("line %d has %d fields, expected suite, classname, job name and orchestrator patterns, project and an optional issue type", n+1, len(row))
+		}
+		rt := route{
+			suite:        wildcard(row[0]),
+			classname:    wildcard(row[1]),
+			job:          wildcard(row[2]),
+			orchestrator: wildcard(row[3]),
+			project:      strings.TrimSpace(row[4]),
+			issueType:    defaultIssueType,
+		}
+		if len(row) == 6 && strings.TrimSpace(row[5]) != "" {
+			rt.issueType = strings.TrimSpace(row[5])
+		}
+		if rt.project == "" {
+			return nil, errors.Errorf("line %d has no project", n+1)
+		}
+		routes = append(routes, rt)
+	}
+	return routes, nil
+}
+
+// route returns the project and issue type of new issues of the test case. The first matching rule wins,
+// -jira-project is used when no rule matches.
+func (j junit2jira) route(tc testCase) (project, issueType string) {
+	for _, r := range j.routes {
+		if r.matches(tc) {
+			return r.project, r.issueType
+		}
+	}
+	return j.jiraProject, defaultIssueType
+}
+
+// searchProjects lists all projects issues can be routed to, to find duplicates in any of them.
+func (j junit2jira) searchProjects() string {
+	projects := []string{j.jiraProject}
+	for _, r := range j.routes {
+		projects = appendUnique(projects, r.project)
+	}
+	return strings.Join(projects, ", ")
+}
+
+// searchIssueTypes lists all types of issues of failed tests.
+func (j junit2jira) searchIssueTypes() string {
+	types := []string{defaultIssueType, "Sub-task"}
+	for _, r := range j.routes {
+		types = appendUnique(types, r.issueType)
+	}
+	quoted := make([]string, 0, len(types))
+	for _, t := range types {
+		if strings.ContainsAny(t, " ,()") {
+			t = `"` + t + `"`
+		}
+		quoted = append(quoted, t)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func appendUnique(values []string, v string) []string {
+	for _, value := range values {
+		if value == v {
+			return values
+		}
+	}
+	return append(values, v)
+}
+
+// issueProject returns the project of the issue, from its fields or its key.
+func issueProject(issue *jira.Issue) string {
+	if issue.Fields != nil && issue.Fields.Project.Key != "" {
+		return issue.Fields.Project.Key
+	}
+	if i := strings.LastIndex(issue.Key, "-"); i > 0 {
+		return issue.Key[:i]
+	}
+	return ""
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/janisz/junit2jira/fakejira"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouting(t *testing.T) {
+	dir := writeFiles(t, t.TempDir(), map[string][]byte{
+		"routing.csv": []byte(`# suite, classname, job, orchestrator, project, issue type
+*, github.com/stackrox/rox/sensor/*, *, *, SENSOR, Task
+*, *, nightly-*, *, NIGHTLY
+`),
+		"invalid.csv": []byte("*, *, *, SENSOR\n"),
+	})
+	routes, err := loadRoutes(filepath.Join(dir, "routing.csv"))
+	require.NoError(t, err)
+	require.Len(t, routes, 2)
+	_, err = loadRoutes(filepath.Join(dir, "invalid.csv"))
+	assert.Error(t, err)
+
+	j := junit2jira{params: params{jiraProject: "ROX", routes: routes}}
+	project, issueType := j.route(testCase{Suite: "github.com/stackrox/rox/sensor/common", JobName: "nightly-gke"})
+	assert.Equal(t, "SENSOR", project)
+	assert.Equal(t, "Task", issueType)
+	project, issueType = j.route(testCase{Suite: "github.com/stackrox/rox/central", JobName: "nightly-gke"})
+	assert.Equal(t, "NIGHTLY", project)
+	assert.Equal(t, "Bug", issueType)
+	project, _ = j.route(testCase{Suite: "github.com/stackrox/rox/central"})
+	assert.Equal(t, "ROX", project)
+	assert.Equal(t, "ROX, SENSOR, NIGHTLY", j.searchProjects())
+	assert.Equal(t, "Bug, Sub-task, Task", j.searchIssueTypes())
+
+	// Other tests shorten summaries, which would merge the failures into one issue.
+	defer func(length int) { maxSummaryLength = length }(maxSummaryLength)
+	maxSummaryLength = 200
+	s, u := newFakeJira(t)
+	summary, err := testCase{Suite: "github.com/stackrox/rox/pkg/booleanpolicy/evaluator", Name: "TestDifferentBaseTypes"}.summary()
+	require.NoError(t, err)
+	// Duplicates are found in all projects issues can be routed to.
+	existing := s.AddIssue(fakejira.Issue{Project: "NIGHTLY", Type: "Bug", Summary: summary, Labels: []string{"CI_Failure"}})
+
+	p := params{
+		jiraUrl:         u,
+		jiraProject:     "ROX",
+		junitReportsDir: "testdata/jira/report.xml",
+		BuildId:         "1",
+		threshold:       10,
+		linkStrategy:    linkNone,
+		routes:          routes,
+	}
+	require.NoError(t, run(p))
+	issues := s.Issues()
+	require.Len(t, issues, 2)
+	assert.Equal(t, existing, issues[0].Key)
+	assert.Len(t, issues[0].Comments, 1)
+	assert.Equal(t, "SENSOR", issues[1].Project)
+	assert.Equal(t, "Task", issues[1].Type)
+
+	// Failures merged by suite are routed by the name of their JUnit suite.
+	dir = writeFiles(t, t.TempDir(), map[string][]byte{
+		"routing.csv": []byte("sensor-*, *, *, *, SENSOR\n"),
+		"junit.xml": []byte(`<testsuites><testsuite name="sensor-e2e">
+<testcase classname="SensorTest" name="a"><failure message="a failed"/></testcase>
+<testcase classname="SensorTest" name="b"><failure message="b failed"/></testcase>
+</testsuite></testsuites>`),
+	})
+	routes, err = loadRoutes(filepath.Join(dir, "routing.csv"))
+	require.NoError(t, err)
+	s, u = newFakeJira(t)
+	p.jiraUrl, p.junitReportsDir, p.routes = u, filepath.Join(dir, "junit.xml"), routes
+	p.threshold, p.mergeStrategy, p.suiteThreshold = 1, mergeSuite, 1
+	require.NoError(t, run(p))
+	issues = s.Issues()
+	require.Len(t, issues, 1)
+	assert.Equal(t, "SENSOR", issues[0].Project)
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxSourceRefs limits source references listed for a failure.
+const maxSourceRefs = 10
+
+var (
+	// javaFrame matches frames of Java, Groovy and Kotlin stack traces, e.g. at io.stackrox.Foo.bar(Foo.java:12).
+	javaFrame = regexp.MustCompile(`\bat\s+([\w$.<>]+)\(([\w$]+\.(?:java|groovy|kt)):(\d+)\)`)
+	// pythonFrame matches frames of Python tracebacks, e.g. File "/app/tests/test_foo.py", line 12, in test_foo.
+	pythonFrame = regexp.MustCompile(`File "([^"]+\.py)", line (\d+)`)
+	// fileRef matches paths with a line of Go, Python and JavaScript files, e.g. pkg/foo/foo.go:12 or /app/src/foo.ts:12:5.
+	fileRef = regexp.MustCompile(`([\w.@+-]*/[\w.@+/-]*\.(?:go|py|js|jsx|mjs|cjs|ts|tsx)):(\d+)`)
+	// goFileRef matches Go file names without a directory, e.g. foo_test.go:42 printed by t.Errorf.
+	goFileRef = regexp.MustCompile(`(?:^|[\s(])([\w.-]+\.go):(\d+)`)
+	// goModuleLine matches the module directive of go.mod.
+	goModuleLine = regexp.MustCompile(`(?m)^module\s+"?([^"\s]+)"?`)
+)
+
+// libraryPackages are prefixes of Java packages whose frames are not in the repository.
+var libraryPackages = []string{"java.", "javax.", "jdk.", "sun.", "com.sun.", "kotlin.", "groovy.", "org.codehaus.groovy.", "org.junit.", "junit.", "org.testng.", "org.spockframework.", "org.gradle."}
+
+// libraryDirs are directories of dependencies, files in them are not in the repository.
+var libraryDirs = []string{"vendor/", "node_modules/", "site-packages/", "dist-packages/", "pkg/mod/"}
+
+// sourceConfig maps file references of stack traces to files in the repository at -base-link.
+type sourceConfig struct {
+	baseLink string
+	// roots are prefixes of absolute paths stripped to get paths relative to the repository root.
+	roots []string
+	// javaDirs are directories of Java and Groovy sources relative to the repository root.
+	javaDirs []string
+	// goModule is the module path of the repository root, Go file names are resolved in directories of its packages.
+	goModule string
+}
+
+// newSourceConfig returns the config of the base link, or nil when it is not set. Without roots,
+// the working directory is the repository root. Without a Go module, the module of go.mod in the working directory is used.
+func newSourceConfig(baseLink string, roots, javaDirs []string, goModule string) (*sourceConfig, error) {
+	if baseLink == "" {
+		return nil, nil
+	}
+	if len(roots) == 0 {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, fmt.Errorf("could not get working directory: %w", err)
+		}
+		roots = []string{wd}
+	}
+	if goModule == "" {
+		if mod, err := os.ReadFile("go.mod"); err == nil {
+			if m := goModuleLine.FindSubmatch(mod); m != nil {
+				goModule = string(m[1])
+			}
+		}
+	}
+	c := &sourceConfig{baseLink: strings.TrimSuffix(baseLink, "/"), javaDirs: javaDirs, goModule: goModule}
+	for _, r := range roots {
+		c.roots = append(c.roots, strings.TrimSuffix(path.Clean(r), "/")+"/")
+	}
+	return c, nil
+}
+
+// sourceRef is a line of a file in the repository, linked to -base-link.
+type sourceRef struct {
+	Path string
+	Line int
+	Link string
+}
+
+// Ref returns the path and line, e.g. pkg/foo/foo.go:12.
+func (r sourceRef) Ref() string {
+	return fmt.Sprintf("%s:%d", r.Path, r.Line)
+}
+
+// refs returns distinct references to repository files in the texts of a failure of the Go package or
+// other classname, innermost frames first.
+func (c *sourceConfig) refs(classname string, texts ...string) []sourceRef {
+	if c == nil {
+		return nil
+	}
+	var refs []sourceRef
+	seen := map[string]bool{}
+	dir, inModule := c.packageDir(classname)
+	for _, text := range texts {
+		found := c.textRefs(text, dir, inModule)
+		// Python prints the innermost frame last.
+		if strings.Contains(text, "Traceback (most recent call last)") {
+			for i, j := 0, len(found)-1; i < j; i, j = i+1, j-1 {
+				found[i], found[j] = found[j], found[i]
+			}
+		}
+		for _, r := range found {
+			if seen[r.Ref()] || len(refs) == maxSourceRefs {
+				continue
+			}
+			seen[r.Ref()] = true
+			refs = append(refs, r)
+		}
+	}
+	return refs
+}
+
+// packageDir returns the directory of a package of the Go module relative to the repository root.
+func (c *sourceConfig) packageDir(pkg string) (string, bool) {
+	if c.goModule == "" {
+		return "", false
+	}
+	if pkg == c.goModule {
+		return "", true
+	}
+	if dir, ok := strings.CutPrefix(pkg, c.goModule+"/"); ok {
+		return dir, true
+	}
+	return "", false
+}
+
+// textRefs returns references in the order they appear in the text. Go file names without a directory are
+// resolved in the package directory when the failure is of a package of the Go module.
+func (c *sourceConfig) textRefs(text, dir string, inModule bool) []sourceRef {
+	var refs []sourceRef
+	for _, line := range strings.Split(text, "\n") {
+		if m := javaFrame.FindStringSubmatch(line); m != nil {
+			if p, ok := c.javaPath(m[1], m[2]); ok {
+				refs = c.appendRef(refs, p, m[3])
+			}
+			continue
+		}
+		if m := pythonFrame.FindStringSubmatch(line); m != nil {
+			if p, ok := c.repoPath(m[1]); ok {
+				refs = c.appendRef(refs, p, m[2])
+			}
+			continue
+		}
+		for _, m := range fileRef.FindAllStringSubmatch(line, -1) {
+			if p, ok := c.repoPath(m[1]); ok {
+				refs = c.appendRef(refs, p, m[2])
+			}
+		}
+		if !inModule {
+			continue
+		}
+		for _, m := range goFileRef.FindAllStringSubmatch(line, -1) {
+			// Files like _testmain.go are generated by go test.
+			if !strings.HasPrefix(m[1], "_") {
+				refs = c.appendRef(refs, path.Join(dir, m[1]), m[2])
+			}
+		}
+	}
+	return refs
+}
+
+func (c *sourceConfig) appendRef(refs []sourceRef, p, line string) []sourceRef {
+	n, err := strconv.Atoi(line)
+	if err != nil {
+		return refs
+	}
+	return append(refs, sourceRef{Path: p, Line: n, Link: fmt.Sprintf("%s/%s#L%d", c.baseLink, p, n)})
+}
+
+// repoPath returns the path relative to the repository root. Absolute paths outside of roots
+// and files of dependencies are not in the repository.
+func (c *sourceConfig) repoPath(p string) (string, bool) {
+	if strings.HasPrefix(p, "/") {
+		p = path.Clean(p)
+		rel := ""
+		for _, root := range c.roots {
+			if strings.HasPrefix(p, root) {
+				rel = strings.TrimPrefix(p, root)
+				break
+			}
+		}
+		if rel == "" {
+			return "", false
+		}
+		p = rel
+	}
+	p = strings.TrimPrefix(p, "./")
+	if strings.HasPrefix(p, "../") {
+		return "", false
+	}
+	for _, dir := range libraryDirs {
+		if strings.HasPrefix(p, dir) || strings.Contains(p, "/"+dir) {
+			return "", false
+		}
+	}
+	return p, true
+}
+
+// javaPath returns the path of the file of a frame, e.g. io.stackrox.Foo$Bar.baz in Foo.java is io/stackrox/Foo.java
+// in the first -java-source-dir it exists in, or in the first one.
+func (c *sourceConfig) javaPath(method, file string) (string, bool) {
+	for _, prefix := range libraryPackages {
+		if strings.HasPrefix(method, prefix) {
+			return "", false
+		}
+	}
+	// The package ends before the first class name, which starts with an upper case letter by convention.
+	segments := strings.Split(method, ".")
+	var pkg []string
+	for _, s := range segments[:len(segments)-1] {
+		if s == "" || strings.ToLower(s[:1]) != s[:1] {
+			break
+		}
+		pkg = append(pkg, s)
+	}
+	p := path.Join(append(pkg, file)...)
+	if len(c.javaDirs) == 0 {
+		return p, true
+	}
+	for _, dir := range c.javaDirs {
+		if _, err := os.Stat(filepath.Join(dir, p)); err == nil {
+			return path.Join(dir, p), true
+		}
+	}
+	return path.Join(c.javaDirs[0], p), true
+}
+
+// Sources returns references to repository files in the failure, innermost frames first.
+func (tc testCase) Sources() []sourceRef {
+	return tc.sources.refs(tc.Suite, tc.Error, tc.Message, tc.Stderr)
+}
+
+// SuspectFile returns the innermost reference to a repository file in the failure, or nil.
+func (tc testCase) SuspectFile() *sourceRef {
+	refs := tc.Sources()
+	if len(refs) == 0 {
+		return nil
+	}
+	return &refs[0]
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"net/url"
+	"testing"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourceRefs(t *testing.T) {
+	c, err := newSourceConfig("https://github.com/stackrox/stackrox/blob/abc/", []string{"/go/src/github.com/stackrox/rox/"}, nil, "github.com/stackrox/rox")
+	require.NoError(t, err)
+
+	r := c.refs("", "Error Trace:	/go/src/github.com/stackrox/rox/pkg/foo/foo_test.go:12")
+	require.Len(t, r, 1)
+	assert.Equal(t, sourceRef{Path: "pkg/foo/foo_test.go", Line: 12, Link: "https://github.com/stackrox/stackrox/blob/abc/pkg/foo/foo_test.go#L12"}, r[0])
+
+	// Frames outside of the repository, of dependencies and without a directory are skipped.
+	assert.Equal(t, []string{"pkg/foo/foo.go:30", "central/main.go:7"}, c.refsOf("", `panic: boom
+	/usr/local/go/src/runtime/panic.go:770 +0x132
+github.com/stackrox/rox/pkg/foo.Foo()
+	/go/src/github.com/stackrox/rox/pkg/foo/foo.go:30 +0x1d
+	/go/src/github.com/stackrox/rox/vendor/github.com/x/y/y.go:3
+	/go/pkg/mod/github.com/x/z@v1.0.0/z.go:4
+	/go/src/github.com/stackrox/rox/central/main.go:7
+	_testmain.go:47 +0x1aa`))
+
+	// Python prints the innermost frame last, repeated references are listed once.
+	assert.Equal(t, []string{"tests/test_foo.py:12", "tests/conftest.py:5"}, c.refsOf("", `Traceback (most recent call last):
+  File "/go/src/github.com/stackrox/rox/tests/conftest.py", line 5, in setup
+  File "/usr/lib/python3/site-packages/pytest/x.py", line 9, in call
+  File "/go/src/github.com/stackrox/rox/tests/test_foo.py", line 12, in test_foo
+AssertionError`, "tests/test_foo.py:12: AssertionError"))
+
+	assert.Equal(t, []string{"ui/src/foo.test.ts:8", "ui/src/foo.ts:3"}, c.refsOf("", `Error: expected 1
+    at Object.<anonymous> (./ui/src/foo.test.ts:8:5)
+    at file:///go/src/github.com/stackrox/rox/ui/src/foo.ts:3:1
+    at node_modules/jest/run.js:1:1`))
+
+	// Go file names without a directory are in the directory of the failing package of the module.
+	assert.Equal(t, []string{"pkg/foo/foo_test.go:42", "pkg/foo/helpers_test.go:7"}, c.refsOf("github.com/stackrox/rox/pkg/foo", `    foo_test.go:42: expected 1, got 2
+    helpers_test.go:7: called from (helpers_test.go:7)
+	_testmain.go:47 +0x1aa`))
+	assert.Equal(t, []string{"main_test.go:3"}, c.refsOf("github.com/stackrox/rox", "main_test.go:3: failed"))
+	assert.Empty(t, c.refsOf("github.com/other/module/pkg", "foo_test.go:42: failed"))
+	assert.Empty(t, c.refsOf("DefaultPoliciesTest", "foo_test.go:42: failed"))
+}
+
+// refsOf returns references in failures of the package or classname as path:line.
+func (c *sourceConfig) refsOf(classname string, texts ...string) []string {
+	var result []string
+	for _, r := range c.refs(classname, texts...) {
+		result = append(result, r.Ref())
+	}
+	return result
+}
+
+func TestSourceRefsJava(t *testing.T) {
+	c, err := newSourceConfig("https://github.com/stackrox/stackrox/blob/abc", []string{"/"}, []string{"qa-tests-backend/src/test/groovy"}, "")
+	require.NoError(t, err)
+	refs := c.refs("DefaultPoliciesTest", `org.spockframework.runtime.ConditionNotSatisfiedError: Condition not satisfied:
+	at org.spockframework.runtime.SpockAssert.fail(SpockAssert.java:10)
+	at io.stackrox.util.Helpers$Inner.<init>(Helpers.groovy:21)
+	at DefaultPoliciesTest.$spock_feature_0_3(DefaultPoliciesTest.groovy:123)
+	at java.base/java.lang.Thread.run(Thread.java:833)`)
+	require.Len(t, refs, 2)
+	assert.Equal(t, "qa-tests-backend/src/test/groovy/io/stackrox/util/Helpers.groovy:21", refs[0].Ref())
+	assert.Equal(t, "https://github.com/stackrox/stackrox/blob/abc/qa-tests-backend/src/test/groovy/DefaultPoliciesTest.groovy#L123", refs[1].Link)
+
+	c, err = newSourceConfig("", nil, nil, "")
+	require.NoError(t, err)
+	assert.Nil(t, c.refs("", "/pkg/foo/foo.go:30"))
+}
+
+func TestSuspectFile(t *testing.T) {
+	c, err := newSourceConfig("https://github.com/stackrox/stackrox/blob/abc", []string{"/src"}, nil, "github.com/stackrox/rox")
+	require.NoError(t, err)
+	tc := testCase{
+		Name:    "TestFoo",
+		Suite:   "github.com/stackrox/rox/pkg/foo",
+		Message: "Failed",
+		Error:   "foo_test.go:12: Failed\n/src/pkg/foo/foo.go:30",
+		sources: c,
+	}
+	require.NotNil(t, tc.SuspectFile())
+	assert.Equal(t, "pkg/foo/foo_test.go:12", tc.SuspectFile().Ref())
+
+	description, err := tc.output()
+	require.NoError(t, err)
+	assert.Equal(t, `
+*Suspect file:* [pkg/foo/foo_test.go:12|https://github.com/stackrox/stackrox/blob/abc/pkg/foo/foo_test.go#L12]
+{code:title=Message|borderStyle=solid}
+Failed
+{code}
+{code:title=ERROR|borderStyle=solid}
+foo_test.go:12: Failed
+/src/pkg/foo/foo.go:30
+{code}
+
+||    SOURCE    ||
+| [pkg/foo/foo_test.go:12|https://github.com/stackrox/stackrox/blob/abc/pkg/foo/foo_test.go#L12] |
+| [pkg/foo/foo.go:30|https://github.com/stackrox/stackrox/blob/abc/pkg/foo/foo.go#L30] |
+`, description)
+
+	attachment, err := failureToAttachment("github.com/stackrox/rox/pkg/foo: TestFoo", tc)
+	require.NoError(t, err)
+	require.IsType(t, &slack.SectionBlock{}, attachment.Blocks.BlockSet[len(attachment.Blocks.BlockSet)-1])
+	suspect := attachment.Blocks.BlockSet[len(attachment.Blocks.BlockSet)-1].(*slack.SectionBlock)
+	assert.Equal(t, "*Suspect file:* <https://github.com/stackrox/stackrox/blob/abc/pkg/foo/foo_test.go#L12|pkg/foo/foo_test.go:12>", suspect.Text.Text)
+
+	u, err := url.Parse("https://issues.redhat.com")
+	require.NoError(t, err)
+	j := junit2jira{params: params{jiraUrl: u}}
+	buf := bytes.NewBufferString("")
+	issues := []*jira.Issue{{Key: "ROX-1", Fields: &jira.IssueFields{Summary: "abc"}}, {Key: "ROX-2", Fields: &jira.IssueFields{Summary: "def"}}}
+	require.NoError(t, j.renderHtml(issues, []*sourceRef{tc.SuspectFile()}, nil, buf))
+	assert.Contains(t, buf.String(), `abc</a> (suspect file: <a target=_blank href="https://github.com/stackrox/stackrox/blob/abc/pkg/foo/foo_test.go#L12">pkg/foo/foo_test.go:12</a>)
+<li>`)
+	assert.Contains(t, buf.String(), "def</a>\n</ul>")
+
+	tc.sources = nil
+	assert.Nil(t, tc.SuspectFile())
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	staleJql = `project in (%s)
+AND labels = %s
+AND status != Closed
+ORDER BY created ASC`
+
+	staleActionComment = "comment"
+	staleActionLabel   = "label"
+	staleActionClose   = "close"
+
+	// staleMarker is an invisible Jira anchor marking comments that flagged an issue as stale.
+	staleMarker = "{anchor:junit2jira-stale}"
+)
+
+var staleActions = []string{staleActionComment, staleActionLabel, staleActionClose}
+
+// staleIssue is an open issue of a test that has not failed recently.
+type staleIssue struct {
+	issue *jira.Issue
+	// lastFailure is when the failure was last recorded on the issue.
+	lastFailure time.Time
+	reason      string
+}
+
+func closeStaleCommand(name string, args []string) error {
+	fs := newFlagSet(name, "Comment, label or close open issues of tests that have not failed recently.")
+	p := params{}
+	f := &runFlags{}
+	addJiraProjectFlags(fs, &p, f)
+	fs.StringVar(&p.staleSearchLabel, "label", failureLabel, "Label of issues to check.")
+	fs.DurationVar(&p.staleAfter, "stale-after", 30*24*time.Hour, "Issues without failures recorded for this long are stale (0 disables the check).")
+	fs.Var((*stringList)(&p.historyFiles), "history", "CSV file written by -csv-output in a previous run, glob patterns match a history of runs. Can be repeated.")
+	fs.IntVar(&p.passStreak, "pass-streak", 0, "Issues of tests that passed in this many latest runs of the -history are stale (0 disables the check).")
+	fs.StringVar(&p.staleAction, "stale-action", staleActionComment, "What to do with stale issues: "+strings.Join(staleActions, ", "))
+	fs.StringVar(&p.staleLabel, "stale-label", "CI_Stale", "Label added to stale issues with -stale-action=label.")
+	fs.StringVar(&p.closeTransition, "close-transition", "Closed", "Name or target status of the transition closing stale issues with -stale-action=close.")
+	fs.BoolVar(&p.dryRun, "dry-run", false, "When set to true issues will NOT be changed.")
+	fs.StringVar(&p.planOutput, "plan-output", "", "Write changes as a plan for the apply command to this file (use dash [-] for stdout)")
+	fs.StringVar(&p.planFormat, "plan-format", planFormatJson, "Format of the plan: "+planFormatJson+" or "+planFormatText)
+	fs.StringVar(&p.auditLog, "audit-log", "", "Append every change made to Jira as a JSON line to this file.")
+	addLogFlags(fs, f)
+	_ = fs.Parse(args)
+	f.apply(&p)
+	if !validStaleAction(p.staleAction) {
+		return withExitCode(exitInputError, errors.Errorf("unknown stale action %q, use one of: %s", p.staleAction, strings.Join(staleActions, ", ")))
+	}
+
+	history, err := loadHistory(p.historyFiles)
+	if err != nil {
+		return withExitCode(exitInputError, errors.Wrap(err, "could not read history"))
+	}
+	jiraClient, err := newJiraClient(p)
+	if err != nil {
+		return err
+	}
+	j := junit2jira{params: p, jiraClient: jiraClient}
+	if p.dryRun || p.planOutput != "" {
+		j.plan = &plan{JiraUrl: p.jiraUrl.String()}
+	}
+	j.audit, err = openAuditLog(p.auditLog)
+	if err != nil {
+		return withExitCode(exitInputError, err)
+	}
+	defer j.audit.Close()
+
+	stale, err := j.findStaleIssues(time.Now(), history)
+	if err != nil {
+		return err
+	}
+	log.Infof("Found %d stale issues", len(stale))
+	if p.staleAction == staleActionClose && len(stale) > 0 {
+		// Workflows differ between projects, so fail before commenting when the transition is not available.
+		if _, err := j.findTransition(stale[0].issue.Key, p.closeTransition); err != nil {
+			return withExitCode(exitInputError, errors.Wrap(err, "pre-flight check failed, use -close-transition with an available transition"))
+		}
+	}
+	var result error
+	for _, s := range stale {
+		if err := j.markStale(s); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+	if err := j.writePlan(); err != nil {
+		return errors.Wrap(err, "could not write plan")
+	}
+	return withExitCode(exitJiraErrors, result)
+}
+
+func validStaleAction(action string) bool {
+	for _, a := range staleActions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// findStaleIssues checks open issues with the label against the -stale-after and -pass-streak policies.
+func (j junit2jira) findStaleIssues(now time.Time, history map[string][]historyRun) ([]staleIssue, error) {
+	var stale []staleIssue
+	query := fmt.Sprintf(staleJql, j.searchProjects(), j.staleSearchLabel)
+	for startAt := 0; ; {
+		search, response, err := j.jiraClient.Issue.Search(query, &jira.SearchOptions{StartAt: startAt, MaxResults: 100, Fields: []string{"summary"}})
+		if err != nil {
+			logError(err, response)
+			return nil, fmt.Errorf("could not search: %w", err)
+		}
+		for _, found := range search {
+			// Search results do not contain all comments, so get them with the issue.
+			issue, response, err := j.jiraClient.Issue.Get(found.Key, &jira.GetQueryOptions{Fields: "summary,labels,created,comment"})
+			if err != nil {
+				logError(err, response)
+				return nil, fmt.Errorf("could not get issue %s: %w", found.Key, err)
+			}
+			if s, ok := j.checkStale(issue, now, history); ok {
+				stale = append(stale, s)
+			}
+		}
+		startAt += len(search)
+		if len(search) == 0 || startAt >= response.Total {
+			return stale, nil
+		}
+	}
+}
+
+// checkStale tells if the issue is stale and why.
+func (j junit2jira) checkStale(issue *jira.Issue, now time.Time, history map[string][]historyRun) (staleIssue, bool) {
+	s := staleIssue{issue: issue, lastFailure: lastFailure(issue)}
+	entry := logEntry(issue.Key, issue.Fields.Summary)
+	if lastStaleComment(issue).After(s.lastFailure) {
+		entry.Debug("Issue is already marked as stale")
+		return s, false
+	}
+	if streak := passStreak(history[issue.Fields.Summary], s.lastFailure); j.passStreak > 0 && streak >= j.passStreak {
+		s.reason = fmt.Sprintf("the test passed in the last %d runs", streak)
+	} else if j.staleAfter > 0 && !s.lastFailure.IsZero() && now.Sub(s.lastFailure) >= j.staleAfter {
+		s.reason = fmt.Sprintf("no failure was recorded since %s", s.lastFailure.Format("2006-01-02"))
+	} else {
+		return s, false
+	}
+	entry.Infof("Issue is stale: %s", s.reason)
+	return s, true
+}
+
+// lastFailure is when a failure was last recorded on the issue.
+// Failures reported without a build ID have no marker, so all comments count for issues without markers.
+func lastFailure(issue *jira.Issue) time.Time {
+	var last time.Time
+	for _, t := range failureTimes(issue) {
+		if t.After(last) {
+			last = t
+		}
+	}
+	if isFailureComment(issue.Fields.Description) || issue.Fields.Comments == nil {
+		return last
+	}
+	for _, c := range issue.Fields.Comments.Comments {
+		if c != nil && isFailureComment(c.Body) {
+			return last
+		}
+	}
+	for _, c := range issue.Fields.Comments.Comments {
+		if c == nil || strings.Contains(c.Body, staleMarker) {
+			continue
+		}
+		if created := commentTime(c); created.After(last) {
+			last = created
+		}
+	}
+	return last
+}
+
+// lastStaleComment is when the issue was last marked as stale, or zero.
+func lastStaleComment(issue *jira.Issue) time.Time {
+	var last time.Time
+	if issue.Fields.Comments == nil {
+		return last
+	}
+	for _, c := range issue.Fields.Comments.Comments {
+		if c != nil && strings.Contains(c.Body, staleMarker) {
+			if created := commentTime(c); created.After(last) {
+				last = created
+			}
+		}
+	}
+	return last
+}
+
+func commentTime(c *jira.Comment) time.Time {
+	for _, layout := range []string{"2006-01-02T15:04:05.000-0700", time.RFC3339} {
+		if t, err := time.Parse(layout, c.Created); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// markStale comments, labels or closes the issue according to -stale-action. A comment explains every change.
+func (j junit2jira) markStale(s staleIssue) error {
+	comment := fmt.Sprintf("This issue looks stale: %s.", s.reason)
+	switch j.staleAction {
+	case staleActionLabel:
+		comment += fmt.Sprintf(" Labeled as %s.", j.staleLabel)
+	case staleActionClose:
+		comment += " Closing it, a new issue will be created if the test fails again."
+	}
+	if err := j.addComment(s.issue, comment+"\n"+staleMarker); err != nil {
+		return err
+	}
+	switch j.staleAction {
+	case staleActionLabel:
+		if hasLabel(s.issue, j.staleLabel) {
+			return nil
+		}
+		return j.updateIssue(s.issue.Key, map[string]any{"labels": append(s.issue.Fields.Labels, j.staleLabel)})
+	case staleActionClose:
+		return j.transitionIssue(s.issue.Key, j.closeTransition)
+	}
+	return nil
+}
+
+func hasLabel(issue *jira.Issue, label string) bool {
+	for _, l := range issue.Fields.Labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// historyRun is a run of a test in the history.
+type historyRun struct {
+	timestamp time.Time
+	passed    bool
+}
+
+// loadHistory reads CSV files written by -csv-output in previous runs and returns
+// runs of each test ordered by time, by summary of its issue.
+func loadHistory(patterns []string) (map[string][]historyRun, error) {
+	runs := map[string][]historyRun{}
+	for _, pattern := range patterns {
+		files := []string{pattern}
+		if hasMeta(pattern) {
+			var err error
+			files, err = glob(pattern)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for _, file := range files {
+			if err := readHistory(file, runs); err != nil {
+				return nil, errors.Wrapf(err, "could not read %s", file)
+			}
+		}
+	}
+	for _, r := range runs {
+		sort.SliceStable(r, func(i, j int) bool { return r[i].timestamp.Before(r[j].timestamp) })
+	}
+	return runs, nil
+}
+
+// passStreak counts the latest runs the test passed in after its last recorded failure.
+// Runs without a timestamp are counted, as they cannot be told apart from later ones.
+func passStreak(runs []historyRun, lastFailure time.Time) int {
+	streak := 0
+	for i := len(runs) - 1; i >= 0 && runs[i].passed; i-- {
+		if !runs[i].timestamp.IsZero() && !runs[i].timestamp.After(lastFailure) {
+			break
+		}
+		streak++
+	}
+	return streak
+}
+
+func readHistory(file string, runs map[string][]historyRun) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	header, err := r.Read()
+	if err != nil {
+		return err
+	}
+	columns := map[string]int{}
+	for i, h := range header {
+		columns[h] = i
+	}
+	for _, c := range []string{"Classname", "Name", "Status"} {
+		if _, ok := columns[c]; !ok {
+			return errors.Errorf("missing %s column", c)
+		}
+	}
+	timestamp, hasTimestamp := columns["Timestamp"]
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		status := row[columns["Status"]]
+		if status == "skipped" {
+			continue
+		}
+		summary, err := testCase{Suite: row[columns["Classname"]], Name: row[columns["Name"]]}.summary()
+		if err != nil {
+			return err
+		}
+		run := historyRun{passed: status == "passed"}
+		if hasTimestamp {
+			run.timestamp, _ = time.Parse(time.RFC3339, row[timestamp])
+		}
+		runs[summary] = append(runs[summary], run)
+	}
+}
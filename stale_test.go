@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/janisz/junit2jira/fakejira"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloseStale(t *testing.T) {
+	s, u := newFakeJira(t)
+	now := time.Now()
+	day := 24 * time.Hour
+	summary := func(name string) string {
+		summary, err := testCase{Suite: "s", Name: name}.summary()
+		require.NoError(t, err)
+		return summary
+	}
+	failure := func(age time.Duration) fakejira.Comment {
+		return fakejira.Comment{Body: "failed again\n{anchor:junit2jira-1-0123456789ab}", Created: now.Add(-age)}
+	}
+	old := s.AddIssue(fakejira.Issue{Project: "ROX", Type: "Bug", Summary: summary("TestOld"), Labels: []string{"CI_Failure"},
+		Created: now.Add(-60 * day), Comments: []fakejira.Comment{failure(40 * day), {Body: "any news?", Created: now.Add(-day)}}})
+	recent := s.AddIssue(fakejira.Issue{Project: "ROX", Type: "Bug", Summary: summary("TestRecent"), Labels: []string{"CI_Failure"},
+		Created: now.Add(-60 * day), Comments: []fakejira.Comment{failure(day)}})
+	passing := s.AddIssue(fakejira.Issue{Project: "ROX", Type: "Bug", Summary: summary("TestPassing"), Labels: []string{"CI_Failure"},
+		Created: now.Add(-5 * day)})
+	s.AddIssue(fakejira.Issue{Project: "ROX", Type: "Bug", Summary: summary("TestSlow"), Labels: []string{"CI_Slow_Test"}, Created: now.Add(-60 * day)})
+	s.AddIssue(fakejira.Issue{Project: "ROX", Type: "Bug", Summary: summary("TestClosed"), Labels: []string{"CI_Failure"}, Created: now.Add(-60 * day), Status: fakejira.StatusClosed})
+
+	run := func(build int, results string) []byte {
+		csv := "BuildId,Timestamp,Classname,Name,Duration,Status\n"
+		timestamp := now.Add(time.Duration(build-5) * day).Format(time.RFC3339)
+		for _, r := range strings.Split(results, ",") {
+			name, status, _ := strings.Cut(r, "=")
+			csv += fmt.Sprintf("%d,%s,s,%s,1,%s\n", build, timestamp, name, status)
+		}
+		return []byte(csv)
+	}
+	history := writeFiles(t, t.TempDir(), map[string][]byte{
+		"1.csv": run(1, "TestPassing=failed,TestRecent=passed"),
+		"2.csv": run(2, "TestPassing=passed,TestRecent=passed"),
+		"3.csv": run(3, "TestPassing=passed,TestRecent=passed"),
+		"4.csv": run(4, "TestPassing=passed,TestRecent=skipped"),
+	})
+	runs, err := loadHistory([]string{filepath.Join(history, "*.csv")})
+	require.NoError(t, err)
+	assert.Equal(t, 3, passStreak(runs[summary("TestPassing")], now.Add(-5*day)))
+	assert.Equal(t, 3, passStreak(runs[summary("TestRecent")], time.Time{}))
+	// TestRecent passed in runs before its last failure only.
+	assert.Equal(t, 0, passStreak(runs[summary("TestRecent")], now.Add(-day)))
+
+	args := []string{"-jira-url", u.String(), "-history", filepath.Join(history, "*.csv"), "-pass-streak", "3"}
+
+	// Dry run plans the changes.
+	planFile := filepath.Join(t.TempDir(), "plan.json")
+	require.NoError(t, closeStaleCommand("close-stale", append(args, "-stale-action", "close", "-dry-run", "-plan-output", planFile)))
+	b, err := os.ReadFile(planFile)
+	require.NoError(t, err)
+	planned := plan{}
+	require.NoError(t, json.Unmarshal(b, &planned))
+	require.Len(t, planned.Actions, 4)
+	assert.Equal(t, planAction{Action: actionTransition, Key: old, Transition: "Closed"}, planned.Actions[1])
+	assert.Equal(t, planAction{Action: actionTransition, Key: passing, Transition: "Closed"}, planned.Actions[3])
+	for _, i := range s.Issues() {
+		for _, c := range i.Comments {
+			assert.NotContains(t, c.Body, staleMarker)
+		}
+	}
+
+	require.NoError(t, closeStaleCommand("close-stale", append(args, "-stale-action", "label", "-pass-streak", "4")))
+	issue, _ := s.Issue(old)
+	assert.Equal(t, []string{"CI_Failure", "CI_Stale"}, issue.Labels)
+	require.Len(t, issue.Comments, 3)
+	assert.Contains(t, issue.Comments[2].Body, "This issue looks stale: no failure was recorded since "+now.Add(-40*day).Format("2006-01-02")+". Labeled as CI_Stale.")
+	issue, _ = s.Issue(passing)
+	assert.Empty(t, issue.Comments)
+
+	// A transition missing in the workflow fails before any issue is commented.
+	err = closeStaleCommand("close-stale", append(args, "-stale-action", "close", "-close-transition", "Resolved"))
+	require.Error(t, err)
+	assert.Equal(t, exitInputError, exitCode(err))
+	assert.Contains(t, err.Error(), "no Resolved transition, available: In Progress, Closed")
+	issue, _ = s.Issue(passing)
+	assert.Empty(t, issue.Comments)
+
+	// Issues already marked as stale are skipped.
+	require.NoError(t, closeStaleCommand("close-stale", append(args, "-stale-action", "close")))
+	issue, _ = s.Issue(old)
+	assert.Len(t, issue.Comments, 3)
+	assert.Equal(t, fakejira.StatusOpen, issue.Status)
+	issue, _ = s.Issue(passing)
+	assert.Equal(t, fakejira.StatusClosed, issue.Status)
+	require.Len(t, issue.Comments, 1)
+	assert.Contains(t, issue.Comments[0].Body, "This issue looks stale: the test passed in the last 3 runs. Closing it")
+	issue, _ = s.Issue(recent)
+	assert.Len(t, issue.Comments, 1)
+	assert.Equal(t, fakejira.StatusOpen, issue.Status)
+}
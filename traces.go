@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	junit "github.com/joshdk/go-junit"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// OTLP span kinds and status codes.
+const (
+	spanKindInternal = 1
+	statusCodeOk     = 1
+	statusCodeError  = 2
+)
+
+// idSource generates trace and span IDs.
+var idSource io.Reader = rand.Reader
+
+// timestampLayouts are formats of the timestamp attribute of test suites and test cases.
+var timestampLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02 15:04:05"}
+
+// The types below are the OTLP/HTTP JSON encoding of an ExportTraceServiceRequest.
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceId           string          `json:"traceId"`
+	SpanId            string          `json:"spanId"`
+	ParentSpanId      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Events            []otlpEvent     `json:"events,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string          `json:"timeUnixNano"`
+	Name         string          `json:"name"`
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+func attribute(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{StringValue: value}}
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func newId(bytes int) string {
+	id := make([]byte, bytes)
+	if _, err := io.ReadFull(idSource, id); err != nil {
+		log.WithError(err).Warn("Could not generate a span ID")
+	}
+	return hex.EncodeToString(id)
+}
+
+// parseTraceParent returns the trace and span ID of a W3C traceparent header, e.g. from the TRACEPARENT variable.
+func parseTraceParent(traceParent string) (string, string, error) {
+	parts := strings.Split(traceParent, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return "", "", errors.Errorf("invalid trace parent %q, expected 00-<trace id>-<span id>-<flags>", traceParent)
+	}
+	for _, id := range parts[1:3] {
+		if _, err := hex.DecodeString(id); err != nil {
+			return "", "", errors.Wrapf(err, "invalid trace parent %q", traceParent)
+		}
+	}
+	return parts[1], parts[2], nil
+}
+
+// tracer converts suites into spans of a single trace.
+type tracer struct {
+	traceId  string
+	reported map[string]*testIssue
+	spans    []otlpSpan
+}
+
+// junit2otlp converts suites to a trace with a span for the run, each suite, test and subtest.
+// Spans start at the timestamps of suites and tests if reported, otherwise right after the previous one.
+func junit2otlp(testSuites []junit.Suite, issues []*testIssue, p params) (otlpTraces, error) {
+	t := &tracer{traceId: newId(16), reported: reportedTests(issues)}
+	parentId := ""
+	if p.traceParent != "" {
+		var err error
+		t.traceId, parentId, err = parseTraceParent(p.traceParent)
+		if err != nil {
+			return otlpTraces{}, err
+		}
+	}
+
+	var total time.Duration
+	for _, ts := range testSuites {
+		total += ts.Totals.Duration
+	}
+	// Without timestamps, tests are assumed to have run right before junit2jira.
+	end, err := time.Parse(time.RFC3339, p.timestamp)
+	if err != nil {
+		end = time.Now()
+	}
+	start := end.Add(-total)
+
+	root := otlpSpan{
+		TraceId:      t.traceId,
+		SpanId:       newId(8),
+		ParentSpanId: parentId,
+		Name:         jobLabel(p),
+		Kind:         spanKindInternal,
+	}
+	first, last, cursor := start, start, start
+	for i, ts := range testSuites {
+		suiteStart, suiteEnd := t.addSuite(ts, root.SpanId, cursor)
+		cursor = suiteEnd
+		if i == 0 || suiteStart.Before(first) {
+			first = suiteStart
+		}
+		if i == 0 || suiteEnd.After(last) {
+			last = suiteEnd
+		}
+	}
+	root.StartTimeUnixNano, root.EndTimeUnixNano = unixNano(first), unixNano(last)
+	root.Status = t.status(t.spans)
+	t.spans = append([]otlpSpan{root}, t.spans...)
+
+	resource := []otlpAttribute{attribute("service.name", "junit2jira")}
+	for _, a := range []otlpAttribute{
+		attribute("cicd.pipeline.name", p.JobName),
+		attribute("cicd.pipeline.run.id", p.BuildId),
+		attribute("build.tag", p.BuildTag),
+		attribute("orchestrator", p.Orchestrator),
+	} {
+		if a.Value.StringValue != "" {
+			resource = append(resource, a)
+		}
+	}
+	return otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: resource},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "junit2jira"}, Spans: t.spans}},
+	}}}, nil
+}
+
+// status is an error if any of the spans failed.
+func (t *tracer) status(spans []otlpSpan) otlpStatus {
+	for _, s := range spans {
+		if s.Status.Code == statusCodeError {
+			return otlpStatus{Code: statusCodeError}
+		}
+	}
+	return otlpStatus{Code: statusCodeOk}
+}
+
+// addSuite adds spans of a suite starting at its timestamp or at the given time and returns when it started and ended.
+func (t *tracer) addSuite(ts junit.Suite, parentId string, at time.Time) (time.Time, time.Time) {
+	if start, ok := parseTimestamp(ts.Properties["timestamp"]); ok {
+		at = start
+	}
+	span := otlpSpan{
+		TraceId:      t.traceId,
+		SpanId:       newId(8),
+		ParentSpanId: parentId,
+		Name:         ts.Name,
+		Kind:         spanKindInternal,
+		Attributes:   []otlpAttribute{attribute("test.suite.name", ts.Name)},
+	}
+	index := len(t.spans)
+	t.spans = append(t.spans, span)
+
+	start, end := at, at
+	cursor := at
+	for _, child := range ts.Suites {
+		_, childEnd := t.addSuite(child, span.SpanId, cursor)
+		cursor = childEnd
+		if childEnd.After(end) {
+			end = childEnd
+		}
+	}
+	// Subtests are children of their parent tests and run within them.
+	type testSpan struct {
+		id   string
+		next time.Time
+	}
+	tests := map[string]*testSpan{}
+	for _, tc := range ts.Tests {
+		parent := &testSpan{id: span.SpanId, next: cursor}
+		if i := strings.LastIndex(tc.Name, "/"); i > 0 && tests[tc.Name[:i]] != nil {
+			parent = tests[tc.Name[:i]]
+		}
+		testStart, ok := parseTimestamp(tc.Properties["timestamp"])
+		if !ok {
+			testStart = parent.next
+		}
+		testEnd := testStart.Add(tc.Duration)
+		parent.next = testEnd
+		if parent.id == span.SpanId {
+			cursor = testEnd
+		}
+		tests[tc.Name] = &testSpan{id: t.addTest(tc, parent.id, testStart, testEnd), next: testStart}
+		if testEnd.After(end) {
+			end = testEnd
+		}
+	}
+
+	t.spans[index].StartTimeUnixNano, t.spans[index].EndTimeUnixNano = unixNano(start), unixNano(end)
+	t.spans[index].Status = t.status(t.spans[index+1:])
+	return start, end
+}
+
+// addTest adds a span of a test with its failure as an exception event and returns the span ID.
+func (t *tracer) addTest(tc junit.Test, parentId string, start, end time.Time) string {
+	span := otlpSpan{
+		TraceId:           t.traceId,
+		SpanId:            newId(8),
+		ParentSpanId:      parentId,
+		Name:              tc.Name,
+		Kind:              spanKindInternal,
+		StartTimeUnixNano: unixNano(start),
+		EndTimeUnixNano:   unixNano(end),
+		Attributes: []otlpAttribute{
+			attribute("test.suite.name", tc.Classname),
+			attribute("test.case.name", tc.Name),
+			attribute("test.case.result.status", string(tc.Status)),
+		},
+		Status: otlpStatus{Code: statusCodeOk},
+	}
+	if i, ok := t.reported[durationKey(tc.Classname, tc.Name)]; ok && i.issue != nil {
+		span.Attributes = append(span.Attributes, attribute("jira.issue.key", i.issue.Key))
+	}
+	if tc.Status == junit.StatusFailed || tc.Status == junit.StatusError {
+		span.Status = otlpStatus{Code: statusCodeError, Message: firstLine(tc.Message)}
+		event := otlpEvent{
+			TimeUnixNano: unixNano(end),
+			Name:         "exception",
+			Attributes:   []otlpAttribute{attribute("exception.message", tc.Message)},
+		}
+		var e junit.Error
+		if errors.As(tc.Error, &e) && e.Type != "" {
+			event.Attributes = append(event.Attributes, attribute("exception.type", e.Type))
+		}
+		if tc.Error != nil {
+			event.Attributes = append(event.Attributes, attribute("exception.stacktrace", tc.Error.Error()))
+		}
+		span.Events = append(span.Events, event)
+	}
+	t.spans = append(t.spans, span)
+	return span.SpanId
+}
+
+func parseTimestamp(s string) (time.Time, bool) {
+	if s == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// exportTraces writes the trace to the JSON output and sends it to the OTLP endpoint.
+func (j junit2jira) exportTraces(testSuites []junit.Suite, issues []*testIssue) error {
+	if j.tracesOutput == "" && j.otlpEndpoint == "" {
+		return nil
+	}
+	traces, err := junit2otlp(testSuites, issues, j.params)
+	if err != nil {
+		return err
+	}
+	if j.tracesOutput != "" {
+		err := writeOutput(j.tracesOutput, func(out io.Writer) error {
+			return json.NewEncoder(out).Encode(traces)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if j.otlpEndpoint == "" {
+		return nil
+	}
+	if j.dryRun {
+		log.Infof("Dry run: would send traces to %s", j.otlpEndpoint)
+		return nil
+	}
+	return sendTraces(j.otlpEndpoint, traces)
+}
+
+// sendTraces sends traces with OTLP/HTTP in the JSON encoding. Headers are read from OTEL_EXPORTER_OTLP_HEADERS.
+func sendTraces(endpoint string, traces otlpTraces) error {
+	body, err := json.Marshal(traces)
+	if err != nil {
+		return err
+	}
+	if !strings.HasSuffix(endpoint, "/v1/traces") {
+		endpoint = strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "could not create OTLP request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for _, h := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if k, v, ok := strings.Cut(h, "="); ok {
+			req.Header.Set(strings.TrimSpace(k), strings.TrimSpace(v))
+		}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "could not send traces")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(resp.Body)
+		return errors.Errorf("could not send traces: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	log.Infof("Sent %d spans to %s", len(traces.ResourceSpans[0].ScopeSpans[0].Spans), endpoint)
+	return nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+	junit "github.com/joshdk/go-junit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// counter generates IDs counting up from 1.
+type counter struct{ n byte }
+
+func (c *counter) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	c.n++
+	p[len(p)-1] = c.n
+	return len(p), nil
+}
+
+func TestTraces(t *testing.T) {
+	idSource = &counter{}
+	defer func() { idSource = rand.Reader }()
+
+	suites := []junit.Suite{{
+		Name:       "retry",
+		Properties: map[string]string{"timestamp": "2023-05-04T10:00:00"},
+		Totals:     junit.Totals{Duration: 3 * time.Second},
+		Tests: []junit.Test{
+			{Name: "TestRetry", Classname: "retry", Duration: time.Second, Status: junit.StatusPassed},
+			{Name: "TestBackoff", Classname: "retry", Duration: 2 * time.Second, Status: junit.StatusFailed, Message: "expected 4s\\ngot 2s",
+				Error: junit.Error{Message: "expected 4s", Type: "AssertionError", Body: "retry_test.go:42"}},
+			{Name: "TestBackoff/exponential", Classname: "retry", Duration: time.Second, Status: junit.StatusFailed, Message: "Failed"},
+		},
+	}}
+	issues := []*testIssue{{issue: &jira.Issue{Key: "ROX-1"}, testCase: testCase{Suite: "retry", Name: "TestBackoff"}}}
+	traces, err := junit2otlp(suites, issues, params{JobName: "unit-tests", BuildId: "1", timestamp: "2023-05-04T12:00:00Z", traceParent: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"})
+	require.NoError(t, err)
+
+	require.Len(t, traces.ResourceSpans, 1)
+	assert.Equal(t, []otlpAttribute{
+		attribute("service.name", "junit2jira"),
+		attribute("cicd.pipeline.name", "unit-tests"),
+		attribute("cicd.pipeline.run.id", "1"),
+	}, traces.ResourceSpans[0].Resource.Attributes)
+	spans := traces.ResourceSpans[0].ScopeSpans[0].Spans
+	require.Len(t, spans, 5)
+	run, suite, retry, backoff, exponential := spans[0], spans[1], spans[2], spans[3], spans[4]
+
+	for _, s := range spans {
+		assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", s.TraceId)
+	}
+	assert.Equal(t, "unit-tests", run.Name)
+	assert.Equal(t, "b7ad6b7169203331", run.ParentSpanId)
+	assert.Equal(t, run.SpanId, suite.ParentSpanId)
+	assert.Equal(t, suite.SpanId, retry.ParentSpanId)
+	assert.Equal(t, suite.SpanId, backoff.ParentSpanId)
+	assert.Equal(t, backoff.SpanId, exponential.ParentSpanId)
+
+	start := time.Date(2023, 5, 4, 10, 0, 0, 0, time.UTC)
+	nanos := func(d time.Duration) string { return unixNano(start.Add(d)) }
+	assert.Equal(t, [2]string{nanos(0), nanos(3 * time.Second)}, [2]string{run.StartTimeUnixNano, run.EndTimeUnixNano})
+	assert.Equal(t, [2]string{nanos(0), nanos(3 * time.Second)}, [2]string{suite.StartTimeUnixNano, suite.EndTimeUnixNano})
+	assert.Equal(t, [2]string{nanos(0), nanos(time.Second)}, [2]string{retry.StartTimeUnixNano, retry.EndTimeUnixNano})
+	assert.Equal(t, [2]string{nanos(time.Second), nanos(3 * time.Second)}, [2]string{backoff.StartTimeUnixNano, backoff.EndTimeUnixNano})
+	assert.Equal(t, [2]string{nanos(time.Second), nanos(2 * time.Second)}, [2]string{exponential.StartTimeUnixNano, exponential.EndTimeUnixNano})
+
+	assert.Equal(t, otlpStatus{Code: statusCodeError}, run.Status)
+	assert.Equal(t, otlpStatus{Code: statusCodeOk}, retry.Status)
+	assert.Equal(t, otlpStatus{Code: statusCodeError, Message: "expected 4s\\ngot 2s"}, backoff.Status)
+	assert.Contains(t, backoff.Attributes, attribute("jira.issue.key", "ROX-1"))
+	assert.NotContains(t, retry.Attributes, attribute("jira.issue.key", "ROX-1"))
+	assert.Equal(t, []otlpEvent{{
+		TimeUnixNano: nanos(3 * time.Second),
+		Name:         "exception",
+		Attributes: []otlpAttribute{
+			attribute("exception.message", "expected 4s\\ngot 2s"),
+			attribute("exception.type", "AssertionError"),
+			attribute("exception.stacktrace", "retry_test.go:42"),
+		},
+	}}, backoff.Events)
+
+	// Without timestamps tests are placed right before the run timestamp.
+	suites[0].Properties = nil
+	traces, err = junit2otlp(suites, nil, params{timestamp: "2023-05-04T12:00:00Z"})
+	require.NoError(t, err)
+	run = traces.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	assert.Empty(t, run.ParentSpanId)
+	assert.Equal(t, "junit2jira", run.Name)
+	assert.Equal(t, unixNano(time.Date(2023, 5, 4, 11, 59, 57, 0, time.UTC)), run.StartTimeUnixNano)
+	assert.Equal(t, unixNano(time.Date(2023, 5, 4, 12, 0, 0, 0, time.UTC)), run.EndTimeUnixNano)
+
+	_, err = junit2otlp(suites, nil, params{traceParent: "00-abc"})
+	assert.Error(t, err)
+}
+
+func TestSendTraces(t *testing.T) {
+	var path, contentType, auth string
+	var body otlpTraces
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, contentType, auth = r.URL.Path, r.Header.Get("Content-Type"), r.Header.Get("Authorization")
+		b, _ := io.ReadAll(r.Body)
+		require.NoError(t, json.Unmarshal(b, &body))
+	}))
+	defer server.Close()
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "Authorization=Bearer token")
+
+	j := junit2jira{params: params{otlpEndpoint: server.URL, timestamp: time.Now().Format(time.RFC3339)}}
+	require.NoError(t, j.exportTraces([]junit.Suite{{Name: "suite", Tests: []junit.Test{{Name: "TestA"}}}}, nil))
+	assert.Equal(t, "/v1/traces", path)
+	assert.Equal(t, "application/json", contentType)
+	assert.Equal(t, "Bearer token", auth)
+	assert.Len(t, body.ResourceSpans[0].ScopeSpans[0].Spans, 3)
+
+	buf := bytes.NewBuffer(nil)
+	traces, err := junit2otlp(nil, nil, j.params)
+	require.NoError(t, err)
+	require.NoError(t, json.NewEncoder(buf).Encode(traces))
+	assert.Contains(t, buf.String(), `"spans":[{"traceId":`)
+}
+
+func TestRunTracesError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	_, u := newFakeJira(t)
+	summaryFile := filepath.Join(t.TempDir(), "summary.json")
+	p := params{
+		jiraUrl:         u,
+		jiraProject:     "ROX",
+		junitReportsDir: "testdata/jira/report.xml",
+		BuildId:         "1",
+		threshold:       10,
+		summaryOutput:   summaryFile,
+		otlpEndpoint:    server.URL,
+		timestamp:       time.Now().Format(time.RFC3339),
+	}
+	// Traces that could not be exported do not stop the run after Jira was changed.
+	err := run(p)
+	assert.Equal(t, exitFailure, exitCode(err))
+	assert.ErrorContains(t, err, "could not export traces")
+	assert.FileExists(t, summaryFile)
+}